@@ -0,0 +1,110 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/config"
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/utils"
+)
+
+const usage = `Usage:
+  xdatabase-proxy [--config FILE] [--SETTING VALUE ...]
+  xdatabase-proxy config validate [--config FILE] [--SETTING VALUE ...]
+  xdatabase-proxy cert generate [--config FILE] [--SETTING VALUE ...]
+
+Every setting can be given as an environment variable (TLS_ENABLED=false),
+a config file entry (tls_enabled: false) or a flag (--tls-enabled=false).
+Flags take precedence over environment variables, which take precedence
+over the config file.
+
+cert generate writes a self-signed certificate and PKCS#8 key to
+TLS_CERT_FILE and TLS_KEY_FILE, or both to stdout. It uses TLS_SANS,
+TLS_KEY_ALGORITHM and TLS_CERT_VALIDITY; without TLS_SANS the certificate
+covers the hostname, POD_IP and the TLS_SERVICE_NAME Service in POD_NAMESPACE.
+`
+
+// runCommand runs a subcommand and returns the process exit code.
+func runCommand(args []string) int {
+	switch {
+	case len(args) >= 2 && args[0] == "config" && args[1] == "validate":
+		return validateConfig(args[2:])
+	case len(args) >= 2 && args[0] == "cert" && args[1] == "generate":
+		return generateCert(args[2:])
+	case args[0] == "help", args[0] == "-h", args[0] == "--help":
+		fmt.Print(usage)
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", strings.Join(args, " "), usage)
+		return 2
+	}
+}
+
+// validateConfig loads the configuration like the proxy would and reports every problem.
+func validateConfig(args []string) int {
+	cfg, err := config.Load(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Configuration is invalid:\n%s\n", indent(err))
+		return 1
+	}
+	fmt.Printf("Configuration is valid (database=%s runtime=%s discovery=%s tls_enabled=%t tls_mode=%s)\n",
+		cfg.DatabaseType, cfg.Runtime, cfg.DiscoveryMode, cfg.TLSEnabled, cfg.TLSMode)
+	return 0
+}
+
+// generateCert writes a self-signed certificate like the proxy generates one,
+// with the settings resolved like the proxy resolves them.
+func generateCert(args []string) int {
+	cfg, err := config.LoadCertificateSettings(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Configuration is invalid:\n%s\n", indent(err))
+		return 2
+	}
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		fmt.Fprintln(os.Stderr, "TLS_CERT_FILE and TLS_KEY_FILE must be given together")
+		return 2
+	}
+
+	hosts := cfg.CertificateHosts()
+	certPEM, keyPEM, err := utils.GenerateSelfSignedCert(utils.CertOptions{
+		Hosts:        hosts,
+		KeyAlgorithm: cfg.TLSKeyAlgorithm,
+		Validity:     cfg.TLSCertValidity,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to generate certificate: %v\n", err)
+		return 1
+	}
+
+	if cfg.TLSCertFile == "" {
+		os.Stdout.Write(certPEM)
+		os.Stdout.Write(keyPEM)
+		return 0
+	}
+	if err := os.WriteFile(cfg.TLSCertFile, certPEM, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write certificate: %v\n", err)
+		return 1
+	}
+	if err := os.WriteFile(cfg.TLSKeyFile, keyPEM, 0600); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write private key: %v\n", err)
+		return 1
+	}
+	block, _ := pem.Decode(certPEM)
+	leaf, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to parse generated certificate: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Generated %s certificate for %s, valid until %s (serial %s)\n",
+		cfg.TLSKeyAlgorithm, strings.Join(hosts, ", "), leaf.NotAfter.UTC().Format(time.RFC3339), leaf.SerialNumber.Text(16))
+	return 0
+}
+
+// indent renders each line of a (joined) error as a list item.
+func indent(err error) string {
+	return "  - " + strings.ReplaceAll(err.Error(), "\n", "\n  - ")
+}
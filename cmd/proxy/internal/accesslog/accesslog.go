@@ -0,0 +1,138 @@
+package accesslog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/syslog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/logger"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// Output names accepted by New.
+const (
+	OutputStdout = "stdout"
+	OutputFile   = "file"
+	OutputSyslog = "syslog"
+)
+
+// Termination reasons
+const (
+	ReasonClientClosed       = "client_closed"
+	ReasonBackendClosed      = "backend_closed"
+	ReasonHandshakeFailed    = "handshake_failed"
+	ReasonBackendUnavailable = "backend_unavailable"
+	ReasonStartupFailed      = "startup_forward_failed"
+	ReasonKilled             = "killed"
+	ReasonAuthFailed         = "auth_failed"
+	ReasonAccessDenied       = "access_denied"
+	ReasonACMEChallenge      = "acme_challenge"
+)
+
+// Record is a single access-log entry, written when a client connection closes.
+// The JSON field names are a stable schema; add fields, never rename them.
+type Record struct {
+	Time         time.Time `json:"time"`
+	ConnectionID string    `json:"connection_id"`
+	ClientAddr   string    `json:"client_addr"`
+	SNI          string    `json:"sni,omitempty"`
+	User         string    `json:"user,omitempty"`
+	Database     string    `json:"database,omitempty"`
+	DeploymentID string    `json:"deployment_id,omitempty"`
+	Pooled       bool      `json:"pooled"`
+	Backend      string    `json:"backend,omitempty"`
+	TLSVersion   string    `json:"tls_version,omitempty"`
+	TLSCipher    string    `json:"tls_cipher,omitempty"`
+	BytesIn      int64     `json:"bytes_client_to_backend"`
+	BytesOut     int64     `json:"bytes_backend_to_client"`
+	DurationMs   int64     `json:"duration_ms"`
+	Termination  string    `json:"termination"`
+	Error        string    `json:"error,omitempty"`
+}
+
+// Options configures the access-log sink.
+type Options struct {
+	Output string // stdout, file or syslog
+
+	// file
+	Path       string
+	MaxSizeMB  int
+	MaxBackups int
+	MaxAgeDays int
+
+	// syslog; an empty network logs to the local syslog daemon
+	SyslogNetwork string
+	SyslogAddress string
+}
+
+// Logger writes access-log records as JSON lines. A nil *Logger discards records.
+type Logger struct {
+	w  io.WriteCloser
+	mu sync.Mutex
+}
+
+// New opens the sink described by opts.
+func New(opts Options) (*Logger, error) {
+	switch opts.Output {
+	case "":
+		// stdout is shared with the operational log, so it is never implied
+		return nil, fmt.Errorf("access log output is required")
+	case OutputStdout:
+		return &Logger{w: nopCloser{os.Stdout}}, nil
+	case OutputFile:
+		if opts.Path == "" {
+			return nil, fmt.Errorf("access log file path is required")
+		}
+		return &Logger{w: &lumberjack.Logger{
+			Filename:   opts.Path,
+			MaxSize:    opts.MaxSizeMB,
+			MaxBackups: opts.MaxBackups,
+			MaxAge:     opts.MaxAgeDays,
+		}}, nil
+	case OutputSyslog:
+		w, err := syslog.Dial(opts.SyslogNetwork, opts.SyslogAddress, syslog.LOG_INFO|syslog.LOG_LOCAL0, "xdatabase-proxy")
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to syslog: %w", err)
+		}
+		return &Logger{w: w}, nil
+	default:
+		return nil, fmt.Errorf("unknown access log output: %s", opts.Output)
+	}
+}
+
+// Log writes rec with secrets in its error redacted. Write errors are dropped
+// so logging never affects traffic.
+func (l *Logger) Log(rec *Record) {
+	if l == nil {
+		return
+	}
+	redacted := *rec
+	redacted.Error = logger.RedactString(rec.Error)
+	line, err := json.Marshal(&redacted)
+	if err != nil {
+		return
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, _ = l.w.Write(line)
+}
+
+// Close flushes and closes the sink.
+func (l *Logger) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Close()
+}
+
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
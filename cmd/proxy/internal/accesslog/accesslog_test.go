@@ -0,0 +1,43 @@
+package accesslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestLogRedactsSecrets(t *testing.T) {
+	tests := []struct {
+		name  string
+		error string
+		keep  string
+	}{
+		{name: "assignment", error: "dial failed: password=hunter2", keep: "dial failed"},
+		{name: "url password", error: "connect postgres://alice:hunter2@db:5432/app: refused", keep: "refused"},
+		{name: "token", error: "token: hunter2 rejected", keep: "rejected"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			l := &Logger{w: nopCloser{&buf}}
+			rec := &Record{ConnectionID: "c1", User: "alice", Termination: ReasonBackendUnavailable, Error: tt.error}
+			l.Log(rec)
+
+			out := buf.String()
+			if strings.Contains(out, "hunter2") {
+				t.Errorf("secret logged: %s", out)
+			}
+			var got Record
+			if err := json.Unmarshal([]byte(out), &got); err != nil {
+				t.Fatalf("invalid JSON line %q: %v", out, err)
+			}
+			if !strings.Contains(got.Error, tt.keep) || got.User != "alice" {
+				t.Errorf("too much redacted: %s", out)
+			}
+			if rec.Error != tt.error {
+				t.Errorf("caller's record was modified: %q", rec.Error)
+			}
+		})
+	}
+}
@@ -0,0 +1,200 @@
+//go:build integration
+
+// The Pebble integration tests run against a local Pebble ACME server and its
+// challenge test server, which answers Pebble's DNS queries:
+//
+//	pebble-challtestsrv -defaultIPv4 127.0.0.1 -defaultIPv6 "" -http01 "" -https01 "" -tlsalpn01 "" &
+//	PEBBLE_VA_NOSLEEP=1 pebble -config test/config/pebble-config.json -dnsserver 127.0.0.1:8053 &
+//	PEBBLE_DIRECTORY=https://localhost:14000/dir PEBBLE_CA_FILE=test/certs/pebble.minica.pem \
+//		go test -tags integration -run Pebble ./cmd/proxy/internal/acmetls
+//
+// Pebble validates TLS-ALPN-01 on port 5001 (tlsPort in its configuration),
+// where the test serves a PostgreSQL proxy built by the proxy factory, so the
+// challenges are answered by the proxy listener. The acme-integration job of
+// the deploy workflow runs these tests.
+package acmetls_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/acmetls"
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/certcache"
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/config"
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/core"
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/discovery/memory"
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/factory"
+)
+
+// dnsHookEnv makes the test binary act as the DNS hook, so dns-01 records are
+// set through the challenge test server without an external script.
+const dnsHookEnv = "PEBBLE_TEST_DNS_HOOK"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(dnsHookEnv) != "" {
+		if err := dnsHook(os.Args[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// dnsHook handles "present|cleanup <fqdn> <value>".
+func dnsHook(args []string) error {
+	if len(args) != 3 {
+		return fmt.Errorf("usage: present|cleanup <fqdn> <value>, got %q", args)
+	}
+	body := map[string]string{"host": args[1] + "."}
+	path := "/clear-txt"
+	if args[0] == "present" {
+		body["value"] = args[2]
+		path = "/set-txt"
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	resp, err := http.Post(getenv("PEBBLE_CHALLTESTSRV", "http://localhost:8055")+path, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", path, resp.Status)
+	}
+	return nil
+}
+
+func TestPebbleIssueCertificate(t *testing.T) {
+	directory := os.Getenv("PEBBLE_DIRECTORY")
+	if directory == "" {
+		t.Skip("PEBBLE_DIRECTORY is not set")
+	}
+	self, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := serveProxy(t)
+
+	tests := []struct {
+		name      string
+		challenge string
+		domains   []string
+	}{
+		{name: "tls-alpn-01", challenge: acmetls.ChallengeTLSALPN, domains: []string{"alpn.proxy.test"}},
+		{name: "tls-alpn-01 several names", challenge: acmetls.ChallengeTLSALPN, domains: []string{"a.proxy.test", "b.proxy.test"}},
+		{name: "dns-01", challenge: acmetls.ChallengeDNS, domains: []string{"dns.proxy.test"}},
+		{name: "dns-01 wildcard", challenge: acmetls.ChallengeDNS, domains: []string{"*.wild.proxy.test"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+			defer cancel()
+
+			accounts := memory.NewMemoryTLSProvider()
+			opts := acmetls.Options{
+				DirectoryURL: directory,
+				Email:        "proxy@example.com",
+				Domains:      tt.domains,
+				Challenge:    tt.challenge,
+				DNSHook:      self,
+				CAFile:       os.Getenv("PEBBLE_CA_FILE"),
+			}
+			p, err := acmetls.NewProvider(memory.NewMemoryTLSProvider(), accounts, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			server.SetConnectionHandler(proxyHandler(t, p))
+			if tt.challenge == acmetls.ChallengeDNS {
+				t.Setenv(dnsHookEnv, "1")
+			}
+
+			certPEM, keyPEM, err := p.IssueCertificate(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := tls.X509KeyPair(certPEM, keyPEM); err != nil {
+				t.Fatalf("issued certificate does not match its key: %v", err)
+			}
+			block, _ := pem.Decode(certPEM)
+			leaf, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, domain := range tt.domains {
+				if !slices.Contains(leaf.DNSNames, domain) {
+					t.Errorf("certificate names %v lack %s", leaf.DNSNames, domain)
+				}
+			}
+			if _, err := accounts.GetCertificate(ctx); err != nil {
+				t.Errorf("account key was not stored: %v", err)
+			}
+
+			// A new provider reuses the stored account for the next order
+			again, err := acmetls.NewProvider(memory.NewMemoryTLSProvider(), accounts, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			server.SetConnectionHandler(proxyHandler(t, again))
+			if _, _, err := again.IssueCertificate(ctx); err != nil {
+				t.Fatalf("second order with the stored account: %v", err)
+			}
+		})
+	}
+}
+
+// serveProxy serves the proxy handler set on the returned server on
+// PEBBLE_TLS_PORT, where Pebble sends its TLS-ALPN-01 validations.
+func serveProxy(t *testing.T) *core.Server {
+	t.Helper()
+	l, err := net.Listen("tcp", net.JoinHostPort("", getenv("PEBBLE_TLS_PORT", "5001")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	server := &core.Server{Listener: l}
+	go server.Serve()
+	return server
+}
+
+// proxyHandler builds the PostgreSQL proxy of a TLS-enabled configuration
+// serving the certificates of p, as the proxy does at startup.
+func proxyHandler(t *testing.T, p *acmetls.Provider) core.ConnectionHandler {
+	t.Helper()
+	cfg := &config.Config{
+		DatabaseType: "postgresql",
+		TLSEnabled:   true,
+		TLSProfile:   "intermediate",
+	}
+	certs, err := certcache.New(context.Background(), p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// ACME validations end in the handshake and never reach a resolver
+	handler, err := factory.NewProxyFactory(cfg, nil, nil, core.NewConnectionRegistry()).
+		Create(context.Background(), certs, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return handler
+}
+
+func getenv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,409 @@
+package acmetls
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/core"
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/logger"
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/utils"
+	"golang.org/x/crypto/acme"
+)
+
+var log = logger.Component(logger.ComponentTLS)
+
+// Challenge types
+const (
+	ChallengeTLSALPN = "tls-alpn-01"
+	ChallengeDNS     = "dns-01"
+)
+
+// Options configures an ACME Provider.
+type Options struct {
+	DirectoryURL string
+	Email        string   // optional account contact
+	Domains      []string // names to request; the first one is the subject
+	Challenge    string   // ChallengeTLSALPN or ChallengeDNS
+	DNSHook      string   // run as "hook present|cleanup <fqdn> <value>" for dns-01
+	CAFile       string   // optional extra roots for the directory, e.g. a local Pebble server
+
+	// KeyAlgorithm is the certificate key type, ECDSA P-256 when empty.
+	// ACME CAs do not sign Ed25519 keys.
+	KeyAlgorithm utils.KeyAlgorithm
+}
+
+// Provider obtains certificates from an ACME CA. Issued certificates are read
+// from and stored through the wrapped TLSProvider; the account key is kept in
+// a second TLSProvider, so replicas sharing a Secret share the account too.
+type Provider struct {
+	core.WrappedStorage
+
+	accountStore core.TLSProvider
+	opts         Options
+	httpClient   *http.Client
+
+	// issueMu serialises issuance, which also guards client
+	issueMu sync.Mutex
+	client  *acme.Client
+
+	// challenges holds TLS-ALPN-01 certificates by domain while an authorization is pending
+	challenges sync.Map
+
+	temporaryOnce sync.Once
+	temporary     *tls.Certificate
+	temporaryErr  error
+}
+
+// NewProvider creates an ACME provider. The ACME server is first contacted
+// when a certificate is issued.
+func NewProvider(certs, accountStore core.TLSProvider, opts Options) (*Provider, error) {
+	httpClient := http.DefaultClient
+	if opts.CAFile != "" {
+		pemData, err := os.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ACME CA file: %w", err)
+		}
+		roots, err := x509.SystemCertPool()
+		if err != nil {
+			roots = x509.NewCertPool()
+		}
+		if !roots.AppendCertsFromPEM(pemData) {
+			return nil, fmt.Errorf("no certificates found in ACME CA file %s", opts.CAFile)
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{RootCAs: roots}
+		httpClient = &http.Client{Transport: transport}
+	}
+
+	if opts.KeyAlgorithm == "" {
+		opts.KeyAlgorithm = utils.KeyECDSAP256
+	}
+	return &Provider{
+		WrappedStorage: core.WrappedStorage{TLSProvider: certs},
+		accountStore:   accountStore,
+		opts:           opts,
+		httpClient:     httpClient,
+	}, nil
+}
+
+// GetCertificate returns the stored certificate. With TLS-ALPN-01 a missing
+// certificate is replaced by a temporary self-signed one, because the
+// challenge can only be answered once the proxy listener is serving.
+func (p *Provider) GetCertificate(ctx context.Context) (*tls.Certificate, error) {
+	cert, err := p.TLSProvider.GetCertificate(ctx)
+	if err == nil || p.opts.Challenge != ChallengeTLSALPN {
+		return cert, err
+	}
+	p.temporaryOnce.Do(func() {
+		p.temporary, p.temporaryErr = temporaryCertificate(p.opts.Domains, p.opts.KeyAlgorithm)
+	})
+	return p.temporary, p.temporaryErr
+}
+
+// IssuesAfterStartup reports whether issuance must wait for the proxy
+// listener, which answers TLS-ALPN-01 challenges.
+func (p *Provider) IssuesAfterStartup() bool {
+	return p.opts.Challenge == ChallengeTLSALPN
+}
+
+// VerifyIssued rejects the temporary certificate so that it is replaced.
+func (p *Provider) VerifyIssued(leaf *x509.Certificate) error {
+	if leaf.CheckSignature(leaf.SignatureAlgorithm, leaf.RawTBSCertificate, leaf.Signature) == nil {
+		return fmt.Errorf("temporary self-signed certificate, waiting for the ACME certificate")
+	}
+	return nil
+}
+
+// ChallengeCertificate implements core.TLSChallengeResponder.
+func (p *Provider) ChallengeCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, bool) {
+	cert, ok := p.challenges.Load(hello.ServerName)
+	if !ok {
+		return nil, false
+	}
+	log.Info("Answering ACME TLS-ALPN-01 challenge", "domain", hello.ServerName, "remote_addr", hello.Conn.RemoteAddr())
+	return cert.(*tls.Certificate), true
+}
+
+// IssueCertificate implements core.CertificateIssuer: it orders a certificate
+// for the configured domains, answers the authorizations and returns the
+// PEM-encoded chain and a new key.
+func (p *Provider) IssueCertificate(ctx context.Context) ([]byte, []byte, error) {
+	p.issueMu.Lock()
+	defer p.issueMu.Unlock()
+
+	client, err := p.acmeClient(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var ids []acme.AuthzID
+	for _, domain := range p.opts.Domains {
+		if net.ParseIP(domain) != nil {
+			ids = append(ids, acme.IPIDs(domain)...)
+		} else {
+			ids = append(ids, acme.DomainIDs(domain)...)
+		}
+	}
+	log.Info("Requesting ACME certificate", "domains", p.opts.Domains, "challenge", p.opts.Challenge)
+	order, err := client.AuthorizeOrder(ctx, ids)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create ACME order: %w", err)
+	}
+	// Only the order creation response carries its location
+	orderURI := order.URI
+	for _, url := range order.AuthzURLs {
+		if err := p.authorize(ctx, client, url); err != nil {
+			return nil, nil, err
+		}
+	}
+	if order, err = client.WaitOrder(ctx, orderURI); err != nil {
+		return nil, nil, fmt.Errorf("ACME order failed: %w", err)
+	}
+
+	key, err := utils.GenerateKey(p.opts.KeyAlgorithm)
+	if err != nil {
+		return nil, nil, err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, certificateRequest(p.opts.Domains), key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create certificate request: %w", err)
+	}
+	chain, _, err := client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		// Servers that finalize asynchronously may omit the order location the
+		// client polls; poll the known order instead
+		finalized, waitErr := client.WaitOrder(ctx, orderURI)
+		if waitErr != nil || finalized.CertURL == "" {
+			return nil, nil, fmt.Errorf("failed to finalize ACME order: %w", err)
+		}
+		if chain, err = client.FetchCert(ctx, finalized.CertURL, true); err != nil {
+			return nil, nil, fmt.Errorf("failed to download ACME certificate: %w", err)
+		}
+	}
+
+	if len(chain) == 0 {
+		return nil, nil, fmt.Errorf("ACME server returned an empty certificate chain")
+	}
+	certPEM, keyPEM, err := utils.EncodePair(chain[0], key)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, der := range chain[1:] {
+		certPEM = append(certPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+	log.Info("ACME certificate issued", "domains", p.opts.Domains)
+	return certPEM, keyPEM, nil
+}
+
+// authorize completes one pending authorization with the configured challenge.
+func (p *Provider) authorize(ctx context.Context, client *acme.Client, url string) error {
+	authz, err := client.GetAuthorization(ctx, url)
+	if err != nil {
+		return fmt.Errorf("failed to get ACME authorization: %w", err)
+	}
+	if authz.Status == acme.StatusValid {
+		return nil
+	}
+
+	var challenge *acme.Challenge
+	for _, c := range authz.Challenges {
+		if c.Type == p.opts.Challenge {
+			challenge = c
+			break
+		}
+	}
+	domain := authz.Identifier.Value
+	if challenge == nil {
+		return fmt.Errorf("ACME server offers no %s challenge for %s", p.opts.Challenge, domain)
+	}
+
+	switch p.opts.Challenge {
+	case ChallengeTLSALPN:
+		cert, err := client.TLSALPN01ChallengeCert(challenge.Token, domain)
+		if err != nil {
+			return fmt.Errorf("failed to create TLS-ALPN-01 certificate: %w", err)
+		}
+		p.challenges.Store(domain, &cert)
+		defer p.challenges.Delete(domain)
+	case ChallengeDNS:
+		value, err := client.DNS01ChallengeRecord(challenge.Token)
+		if err != nil {
+			return fmt.Errorf("failed to compute DNS-01 record: %w", err)
+		}
+		fqdn := "_acme-challenge." + domain
+		if err := p.runDNSHook(ctx, "present", fqdn, value); err != nil {
+			return err
+		}
+		defer func() {
+			if err := p.runDNSHook(context.WithoutCancel(ctx), "cleanup", fqdn, value); err != nil {
+				log.Warn("Failed to remove ACME DNS record", "fqdn", fqdn, "error", err)
+			}
+		}()
+	}
+
+	if _, err := client.Accept(ctx, challenge); err != nil {
+		return fmt.Errorf("failed to accept ACME challenge for %s: %w", domain, err)
+	}
+	if _, err := client.WaitAuthorization(ctx, authz.URI); err != nil {
+		return fmt.Errorf("ACME authorization for %s failed: %w", domain, err)
+	}
+	return nil
+}
+
+// runDNSHook runs the DNS hook, which must not return before the record is
+// visible to the ACME server.
+func (p *Provider) runDNSHook(ctx context.Context, action, fqdn, value string) error {
+	out, err := exec.CommandContext(ctx, p.opts.DNSHook, action, fqdn, value).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("DNS hook %s %s failed: %w: %s", action, fqdn, err, out)
+	}
+	return nil
+}
+
+// acmeClient returns a client for the registered account, loading or
+// creating the account key on first use.
+func (p *Provider) acmeClient(ctx context.Context) (*acme.Client, error) {
+	if p.client != nil {
+		return p.client, nil
+	}
+
+	key, err := p.accountKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	client := &acme.Client{
+		Key:          key,
+		DirectoryURL: p.opts.DirectoryURL,
+		HTTPClient:   p.httpClient,
+		UserAgent:    "xdatabase-proxy",
+	}
+
+	account := &acme.Account{}
+	if p.opts.Email != "" {
+		account.Contact = []string{"mailto:" + p.opts.Email}
+	}
+	if _, err := client.Register(ctx, account, acme.AcceptTOS); err != nil && !errors.Is(err, acme.ErrAccountAlreadyExists) {
+		return nil, fmt.Errorf("failed to register ACME account: %w", err)
+	}
+	p.client = client
+	return client, nil
+}
+
+// accountKey loads the account key from the account store, or generates and
+// stores one. TLSProviders store certificate/key pairs, so the key is stored
+// with a self-signed placeholder certificate.
+func (p *Provider) accountKey(ctx context.Context) (crypto.Signer, error) {
+	if cert, err := p.accountStore.GetCertificate(ctx); err == nil {
+		key, ok := cert.PrivateKey.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("unsupported ACME account key type %T", cert.PrivateKey)
+		}
+		return key, nil
+	}
+
+	log.Info("ACME account key not found. Generating a new one...")
+	// ACME signs requests with ECDSA or RSA account keys, whatever the certificate key
+	key, err := utils.GenerateKey(utils.KeyECDSAP256)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate ACME account key: %w", err)
+	}
+	certPEM, keyPEM, err := selfSigned(key, pkix.Name{CommonName: "xdatabase-proxy ACME account"}, nil, 100*365*24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.accountStore.Store(ctx, certPEM, keyPEM); err != nil {
+		return nil, fmt.Errorf("failed to store ACME account key: %w", err)
+	}
+	// Read back what was stored, which is another instance's key if it won a race
+	cert, err := p.accountStore.GetCertificate(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load ACME account key after storing it: %w", err)
+	}
+	stored, ok := cert.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported ACME account key type %T", cert.PrivateKey)
+	}
+	return stored, nil
+}
+
+// temporaryCertificate creates the short-lived self-signed certificate served
+// until the first ACME certificate is issued.
+func temporaryCertificate(domains []string, algorithm utils.KeyAlgorithm) (*tls.Certificate, error) {
+	key, err := utils.GenerateKey(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	certPEM, keyPEM, err := selfSigned(key, pkix.Name{Organization: []string{"xdatabase-proxy"}}, domains, 24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load temporary certificate: %w", err)
+	}
+	return &cert, nil
+}
+
+// selfSigned returns a PEM-encoded self-signed certificate for key and the encoded key.
+func selfSigned(key crypto.Signer, subject pkix.Name, domains []string, validity time.Duration) ([]byte, []byte, error) {
+	serial, err := utils.RandomSerial()
+	if err != nil {
+		return nil, nil, err
+	}
+	template := certificateTemplate(domains)
+	template.SerialNumber = serial
+	template.Subject = subject
+	template.NotBefore = time.Now()
+	template.NotAfter = time.Now().Add(validity)
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	template.BasicConstraintsValid = true
+	// RSA key exchange (TLS 1.2 without ECDHE) encrypts with the certificate key
+	if _, ok := key.(*rsa.PrivateKey); ok {
+		template.KeyUsage |= x509.KeyUsageKeyEncipherment
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create certificate: %w", err)
+	}
+	return utils.EncodePair(der, key)
+}
+
+func certificateTemplate(domains []string) *x509.Certificate {
+	template := &x509.Certificate{}
+	for _, domain := range domains {
+		if ip := net.ParseIP(domain); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, domain)
+		}
+	}
+	return template
+}
+
+func certificateRequest(domains []string) *x509.CertificateRequest {
+	template := certificateTemplate(domains)
+	request := &x509.CertificateRequest{
+		DNSNames:    template.DNSNames,
+		IPAddresses: template.IPAddresses,
+	}
+	if len(template.DNSNames) > 0 {
+		request.Subject.CommonName = template.DNSNames[0]
+	}
+	return request
+}
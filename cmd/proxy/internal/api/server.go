@@ -2,17 +2,38 @@ package api
 
 import (
 	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"slices"
+	"strings"
 	"sync/atomic"
 
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/core"
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/health"
 	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/logger"
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/metrics"
 )
 
+var log = logger.Component(logger.ComponentAPI)
+
 type HealthServer struct {
-	server *http.Server
-	ready  atomic.Bool
+	server  *http.Server
+	ready   atomic.Bool
+	checker atomic.Pointer[health.Checker]
+	conns   atomic.Pointer[core.ConnectionRegistry]
+	routes  atomic.Pointer[core.RouteStore]
+	token   atomic.Pointer[string]
+	reload  atomic.Pointer[ReloadFunc]
+	caPEM   atomic.Pointer[[]byte]
 }
 
+// ReloadFunc reloads the configuration and returns the changed settings that
+// need a restart to take effect.
+type ReloadFunc func(ctx context.Context) (restartRequired []string, err error)
+
 func NewHealthServer(addr string) *HealthServer {
 	mux := http.NewServeMux()
 	hs := &HealthServer{
@@ -27,15 +48,27 @@ func NewHealthServer(addr string) *HealthServer {
 
 	mux.HandleFunc("/health", hs.handleHealth)
 	mux.HandleFunc("/ready", hs.handleReady)
+	mux.HandleFunc("/backends", hs.handleBackends)
+	mux.HandleFunc("GET /loglevel", hs.admin(hs.handleLogLevel, false))
+	mux.HandleFunc("PUT /loglevel", hs.admin(hs.handleLogLevel, true))
+	mux.HandleFunc("POST /loglevel", hs.admin(hs.handleLogLevel, true))
+	mux.HandleFunc("GET /connections", hs.admin(hs.handleListConnections, true))
+	mux.HandleFunc("DELETE /connections/{id}", hs.admin(hs.handleKillConnection, true))
+	mux.HandleFunc("GET /routes", hs.admin(hs.handleListRoutes, false))
+	mux.HandleFunc("PUT /routes/{key}", hs.admin(hs.handleSetRoute, true))
+	mux.HandleFunc("DELETE /routes/{key}", hs.admin(hs.handleDeleteRoute, true))
+	mux.HandleFunc("POST /reload", hs.admin(hs.handleReload, true))
+	mux.HandleFunc("GET /ca.crt", hs.handleCACertificate)
+	mux.Handle("/metrics", metrics.Handler())
 
 	return hs
 }
 
 func (s *HealthServer) Start() {
 	go func() {
-		logger.Info("Health server listening", "addr", s.server.Addr)
+		log.Info("Health server listening", "addr", s.server.Addr)
 		if err := s.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			logger.Error("Health server error", "error", err)
+			log.Error("Health server error", "error", err)
 		}
 	}()
 }
@@ -48,6 +81,65 @@ func (s *HealthServer) SetReady(ready bool) {
 	s.ready.Store(ready)
 }
 
+// SetBackendChecker exposes the backend health checker state on /backends.
+func (s *HealthServer) SetBackendChecker(checker *health.Checker) {
+	s.checker.Store(checker)
+}
+
+// SetConnectionRegistry exposes the live connections on /connections.
+func (s *HealthServer) SetConnectionRegistry(registry *core.ConnectionRegistry) {
+	s.conns.Store(registry)
+}
+
+// SetRouteStore exposes runtime route changes on /routes. A nil store disables them.
+func (s *HealthServer) SetRouteStore(store core.RouteStore) {
+	s.routes.Store(&store)
+}
+
+// SetReloader enables POST /reload.
+func (s *HealthServer) SetReloader(reload ReloadFunc) {
+	s.reload.Store(&reload)
+}
+
+// SetCACertificate publishes the PEM-encoded proxy CA on /ca.crt. nil disables it.
+func (s *HealthServer) SetCACertificate(caPEM []byte) {
+	s.caPEM.Store(&caPEM)
+}
+
+// SetAdminToken sets the bearer token required by the admin endpoints.
+// Without a token, the connection endpoints and route, log level and
+// configuration changes are refused; the other admin endpoints are open.
+func (s *HealthServer) SetAdminToken(token string) {
+	s.token.Store(&token)
+}
+
+// admin wraps an admin endpoint with bearer token authentication. required
+// endpoints are refused when no token is configured.
+func (s *HealthServer) admin(next http.HandlerFunc, required bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var token string
+		if t := s.token.Load(); t != nil {
+			token = *t
+		}
+		if token == "" {
+			if required {
+				http.Error(w, "admin token is not configured (ADMIN_TOKEN)", http.StatusForbidden)
+				return
+			}
+			next(w, r)
+			return
+		}
+
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
 func (s *HealthServer) handleHealth(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("ok"))
@@ -62,3 +154,226 @@ func (s *HealthServer) handleReady(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte("not ready"))
 	}
 }
+
+func (s *HealthServer) handleBackends(w http.ResponseWriter, r *http.Request) {
+	checker := s.checker.Load()
+	if checker == nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("backend health checking is disabled"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(checker.Snapshot()); err != nil {
+		log.Error("Failed to encode backend health", "error", err)
+	}
+}
+
+// handleListConnections lists live connections, optionally filtered by the
+// deployment_id, user, database and backend query parameters.
+func (s *HealthServer) handleListConnections(w http.ResponseWriter, r *http.Request) {
+	registry := s.conns.Load()
+	if registry == nil {
+		http.Error(w, "connection registry is disabled", http.StatusNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	conns := registry.List(core.ConnectionFilter{
+		DeploymentID: query.Get("deployment_id"),
+		User:         query.Get("user"),
+		Database:     query.Get("database"),
+		Backend:      query.Get("backend"),
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(conns); err != nil {
+		log.Error("Failed to encode connections", "error", err)
+	}
+}
+
+// handleKillConnection terminates a live connection.
+func (s *HealthServer) handleKillConnection(w http.ResponseWriter, r *http.Request) {
+	registry := s.conns.Load()
+	if registry == nil {
+		http.Error(w, "connection registry is disabled", http.StatusNotFound)
+		return
+	}
+
+	id := r.PathValue("id")
+	if err := registry.Kill(id); err != nil {
+		if errors.Is(err, core.ErrConnectionNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Info("Connection killed via admin API", "connection_id", id, "remote_addr", r.RemoteAddr)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *HealthServer) routeStore(w http.ResponseWriter) (core.RouteStore, bool) {
+	var store core.RouteStore
+	if p := s.routes.Load(); p != nil {
+		store = *p
+	}
+	if store == nil {
+		http.Error(w, "runtime routes require static discovery", http.StatusNotFound)
+		return nil, false
+	}
+	return store, true
+}
+
+func (s *HealthServer) handleListRoutes(w http.ResponseWriter, r *http.Request) {
+	store, ok := s.routeStore(w)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(store.Routes()); err != nil {
+		log.Error("Failed to encode routes", "error", err)
+	}
+}
+
+type setRouteRequest struct {
+	Addresses []string `json:"addresses"`
+}
+
+// handleSetRoute creates or replaces a route:
+//
+//	PUT /routes/db1       {"addresses": ["10.0.1.5:5432", "10.0.1.6:5432"]}
+//	PUT /routes/db1.pool  {"addresses": ["10.0.1.5:6432"]}
+func (s *HealthServer) handleSetRoute(w http.ResponseWriter, r *http.Request) {
+	store, ok := s.routeStore(w)
+	if !ok {
+		return
+	}
+
+	var req setRouteRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err := store.SetRoute(r.PathValue("key"), req.Addresses); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Info("Route set via admin API", "key", r.PathValue("key"), "remote_addr", r.RemoteAddr)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *HealthServer) handleDeleteRoute(w http.ResponseWriter, r *http.Request) {
+	store, ok := s.routeStore(w)
+	if !ok {
+		return
+	}
+	if err := store.DeleteRoute(r.PathValue("key")); err != nil {
+		if errors.Is(err, core.ErrBackendNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Info("Route deleted via admin API", "key", r.PathValue("key"), "remote_addr", r.RemoteAddr)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type reloadResponse struct {
+	Status          string   `json:"status"`
+	RestartRequired []string `json:"restart_required"`
+}
+
+// handleReload reloads the configuration. A configuration that fails to load
+// or apply is rejected with 400 and the running one is kept.
+func (s *HealthServer) handleReload(w http.ResponseWriter, r *http.Request) {
+	reload := s.reload.Load()
+	if reload == nil {
+		http.Error(w, "reload is not available", http.StatusNotFound)
+		return
+	}
+	log.Info("Configuration reload requested via admin API", "remote_addr", r.RemoteAddr)
+	restartRequired, err := (*reload)(r.Context())
+	if err != nil {
+		log.Error("Configuration reload failed, keeping the running configuration", "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if restartRequired == nil {
+		restartRequired = []string{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(reloadResponse{Status: "reloaded", RestartRequired: restartRequired}); err != nil {
+		log.Error("Failed to encode reload response", "error", err)
+	}
+}
+
+// handleCACertificate serves the proxy CA so clients can pin it, e.g. as
+// sslrootcert with sslmode=verify-full. It is public like the certificate itself.
+func (s *HealthServer) handleCACertificate(w http.ResponseWriter, r *http.Request) {
+	var caPEM []byte
+	if p := s.caPEM.Load(); p != nil {
+		caPEM = *p
+	}
+	if caPEM == nil {
+		http.Error(w, "no proxy CA is configured (TLS_ISSUER=ca)", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-pem-file")
+	w.Write(caPEM)
+}
+
+type logLevelResponse struct {
+	Level      string            `json:"level"`
+	Components map[string]string `json:"components"`
+}
+
+// handleLogLevel reports the log levels on GET and changes them on PUT/POST:
+//
+//	PUT /loglevel?level=debug                     global level
+//	PUT /loglevel?level=debug&component=postgres  single component
+//	PUT /loglevel?level=reset&component=postgres  component follows the global level again
+func (s *HealthServer) handleLogLevel(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		if err := setLogLevel(r.URL.Query().Get("level"), r.URL.Query().Get("component")); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(logLevelResponse{
+		Level:      logger.GetLevel().String(),
+		Components: logger.ComponentLevels(),
+	}); err != nil {
+		log.Error("Failed to encode log levels", "error", err)
+	}
+}
+
+func setLogLevel(levelName, component string) error {
+	if component != "" && !slices.Contains(logger.ComponentNames(), component) {
+		return fmt.Errorf("unknown component %q (known: %s)", component, strings.Join(logger.ComponentNames(), ", "))
+	}
+
+	if strings.EqualFold(levelName, "reset") {
+		if component == "" {
+			return fmt.Errorf("level=reset requires a component")
+		}
+		logger.ResetComponentLevel(component)
+		logger.Info("Component log level reset", "component", component)
+		return nil
+	}
+
+	level, err := logger.ParseLevel(levelName)
+	if err != nil {
+		return fmt.Errorf("invalid level %q (expected debug, info, warn or error)", levelName)
+	}
+	if component == "" {
+		logger.SetLevel(level)
+	} else {
+		logger.SetComponentLevel(component, level)
+	}
+	logger.Info("Log level changed", "level", level.String(), "component", component)
+	return nil
+}
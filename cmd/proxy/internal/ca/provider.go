@@ -0,0 +1,196 @@
+package ca
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/core"
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/logger"
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/utils"
+)
+
+var log = logger.Component(logger.ComponentTLS)
+
+const (
+	// caValidity is the lifetime of a generated CA. Clients pin it, so it is
+	// never rotated automatically.
+	caValidity = 10 * 365 * 24 * time.Hour
+
+	// clockSkew backdates issued certificates for clients with a slow clock.
+	clockSkew = 5 * time.Minute
+)
+
+// Provider issues leaf certificates from a proxy CA. Leaf certificates are
+// read from and stored through the wrapped TLSProvider; the CA keypair is kept
+// in a second TLSProvider (a file pair, a Secret or memory).
+type Provider struct {
+	core.WrappedStorage
+
+	ca           *tls.Certificate
+	caPEM        []byte
+	hosts        []string
+	keyAlgorithm utils.KeyAlgorithm
+	validity     time.Duration
+}
+
+// NewProvider loads the CA from caStore, generating and storing a new one when
+// it does not exist and generate is set. Issued leaves are valid for hosts
+// (DNS names, wildcards or IPs) for validity and get a keyAlgorithm key.
+func NewProvider(ctx context.Context, leaves, caStore core.TLSProvider, generate bool, hosts []string, keyAlgorithm utils.KeyAlgorithm, validity time.Duration) (*Provider, error) {
+	caCert, err := caStore.GetCertificate(ctx)
+	if err != nil {
+		if !generate {
+			return nil, fmt.Errorf("CA not found and TLS_AUTO_GENERATE=false: %w", err)
+		}
+		log.Info("CA not found. Generating new proxy CA...")
+		if caCert, err = generateCA(ctx, caStore); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(caCert.Certificate) == 0 {
+		return nil, fmt.Errorf("CA has an empty certificate chain")
+	}
+	caLeaf, err := x509.ParseCertificate(caCert.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CA certificate: %w", err)
+	}
+	if !caLeaf.IsCA || caLeaf.KeyUsage&x509.KeyUsageCertSign == 0 {
+		return nil, fmt.Errorf("CA certificate %s is not allowed to sign certificates", caLeaf.Subject)
+	}
+	if time.Now().After(caLeaf.NotAfter) {
+		return nil, fmt.Errorf("CA certificate expired at %s", caLeaf.NotAfter.UTC().Format(time.RFC3339))
+	}
+	parsed := *caCert
+	parsed.Leaf = caLeaf
+
+	log.Info("Proxy CA loaded",
+		"subject", caLeaf.Subject.String(),
+		"not_after", caLeaf.NotAfter.UTC().Format(time.RFC3339))
+
+	return &Provider{
+		WrappedStorage: core.WrappedStorage{TLSProvider: leaves},
+		ca:             &parsed,
+		caPEM:          pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caLeaf.Raw}),
+		hosts:          hosts,
+		keyAlgorithm:   keyAlgorithm,
+		validity:       validity,
+	}, nil
+}
+
+// generateCA creates a CA and stores it. When another instance stored one
+// first, that one is used instead.
+func generateCA(ctx context.Context, caStore core.TLSProvider) (*tls.Certificate, error) {
+	key, err := utils.GenerateKey(utils.KeyECDSAP256)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate CA key: %w", err)
+	}
+	serial, err := utils.RandomSerial()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			Organization: []string{"xdatabase-proxy"},
+			CommonName:   "xdatabase-proxy CA",
+		},
+		NotBefore:             now.Add(-clockSkew),
+		NotAfter:              now.Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CA certificate: %w", err)
+	}
+	certPEM, keyPEM, err := utils.EncodePair(der, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := caStore.Store(ctx, certPEM, keyPEM); err != nil {
+		log.Warn("Failed to store CA, attempting to load existing CA", "error", err)
+	}
+	// Read back what was stored, which is another instance's CA if it won a race
+	caCert, err := caStore.GetCertificate(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load CA after storing it: %w", err)
+	}
+	return caCert, nil
+}
+
+// CACertificate returns the PEM-encoded CA certificate for clients to trust.
+func (p *Provider) CACertificate() []byte {
+	return p.caPEM
+}
+
+// IssueCertificate implements core.CertificateIssuer with a new key and a
+// leaf certificate signed by the CA.
+func (p *Provider) IssueCertificate(ctx context.Context) ([]byte, []byte, error) {
+	key, err := utils.GenerateKey(p.keyAlgorithm)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := utils.RandomSerial()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			Organization: []string{"xdatabase-proxy"},
+			CommonName:   "xdatabase-proxy",
+		},
+		NotBefore:             now.Add(-clockSkew),
+		NotAfter:              now.Add(p.validity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	// A leaf must not outlive its CA
+	if template.NotAfter.After(p.ca.Leaf.NotAfter) {
+		template.NotAfter = p.ca.Leaf.NotAfter
+	}
+	for _, host := range p.hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	if len(p.hosts) > 0 {
+		template.Subject.CommonName = p.hosts[0]
+	}
+
+	if _, ok := key.Public().(*rsa.PublicKey); ok {
+		template.KeyUsage |= x509.KeyUsageKeyEncipherment
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, p.ca.Leaf, key.Public(), p.ca.PrivateKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to sign certificate: %w", err)
+	}
+	return utils.EncodePair(der, key)
+}
+
+// VerifyIssued reports whether leaf was signed by the CA.
+func (p *Provider) VerifyIssued(leaf *x509.Certificate) error {
+	if err := leaf.CheckSignatureFrom(p.ca.Leaf); err != nil {
+		return fmt.Errorf("certificate was not issued by the proxy CA: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package certcache
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/core"
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/logger"
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/metrics"
+)
+
+var log = logger.Component(logger.ComponentTLS)
+
+// Cache serves the certificate of a TLSProvider to tls.Config.GetCertificate.
+// The certificate is loaded once and replaced on Refresh, so handshakes never
+// wait on the provider and new handshakes pick up a rotated certificate at once.
+// Certificates set with SetSNICertificates are served to clients asking for
+// their host name; the provider's certificate is the default.
+type Cache struct {
+	provider core.TLSProvider
+	cert     atomic.Pointer[tls.Certificate]
+	sni      atomic.Pointer[map[string]*tls.Certificate]
+	tickets  atomic.Pointer[[][32]byte]
+}
+
+// New loads the provider's current certificate.
+func New(ctx context.Context, provider core.TLSProvider) (*Cache, error) {
+	c := &Cache{provider: provider}
+	if err := c.Refresh(ctx); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Provider returns the TLS provider the certificate is read from.
+func (c *Cache) Provider() core.TLSProvider {
+	return c.provider
+}
+
+// Refresh reloads the certificate from the provider. On error the current
+// certificate stays in use.
+func (c *Cache) Refresh(ctx context.Context) error {
+	cert, err := c.provider.GetCertificate(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load certificate: %w", err)
+	}
+	if len(cert.Certificate) == 0 {
+		return fmt.Errorf("failed to load certificate: empty certificate chain")
+	}
+	if cert.Leaf == nil {
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return fmt.Errorf("failed to parse certificate: %w", err)
+		}
+		// Keep the provider's copy untouched
+		parsed := *cert
+		parsed.Leaf = leaf
+		cert = &parsed
+	}
+
+	previous := c.cert.Swap(cert)
+	metrics.SetCertificateExpiry(cert.Leaf.NotAfter)
+	if previous == nil || previous.Leaf.SerialNumber.Cmp(cert.Leaf.SerialNumber) != 0 || !previous.Leaf.NotAfter.Equal(cert.Leaf.NotAfter) {
+		log.Info("TLS certificate loaded",
+			"subject", cert.Leaf.Subject.String(),
+			"serial", cert.Leaf.SerialNumber.String(),
+			"not_after", cert.Leaf.NotAfter.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// Certificate returns the certificate currently served.
+func (c *Cache) Certificate() *tls.Certificate {
+	return c.cert.Load()
+}
+
+// SetSNICertificates replaces the certificates selected by SNI. Keys are
+// lowercase host names or wildcards ("*.example.com").
+func (c *Cache) SetSNICertificates(certs map[string]*tls.Certificate) {
+	c.sni.Store(&certs)
+}
+
+// Certificates returns the default certificate followed by the SNI
+// certificates, each once.
+func (c *Cache) Certificates() []*tls.Certificate {
+	certs := []*tls.Certificate{c.cert.Load()}
+	sni := c.sni.Load()
+	if sni == nil {
+		return certs
+	}
+	names := make([]string, 0, len(*sni))
+	for name := range *sni {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	seen := map[*tls.Certificate]bool{certs[0]: true}
+	for _, name := range names {
+		if cert := (*sni)[name]; !seen[cert] {
+			seen[cert] = true
+			certs = append(certs, cert)
+		}
+	}
+	return certs
+}
+
+// GetCertificate implements tls.Config.GetCertificate. The SNI certificate for
+// the requested host name is preferred, then one for its wildcard.
+func (c *Cache) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if sni := c.sni.Load(); sni != nil && hello.ServerName != "" {
+		name := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+		if cert, ok := (*sni)[name]; ok {
+			return cert, nil
+		}
+		if i := strings.IndexByte(name, '.'); i > 0 {
+			if cert, ok := (*sni)["*"+name[i:]]; ok {
+				return cert, nil
+			}
+		}
+	}
+	return c.cert.Load(), nil
+}
+
+// SetSessionTicketKeys replaces the session ticket keys, newest first, of
+// the configurations set up with Configure.
+func (c *Cache) SetSessionTicketKeys(keys [][32]byte) {
+	c.tickets.Store(&keys)
+}
+
+// Configure makes config serve the cached certificates and the session ticket
+// keys set with SetSessionTicketKeys. It wraps config.GetConfigForClient, so
+// it is called after that is set.
+func (c *Cache) Configure(config *tls.Config) {
+	config.GetCertificate = c.GetCertificate
+
+	var applied atomic.Pointer[[][32]byte]
+	next := config.GetConfigForClient
+	config.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		// New keys are picked up by the next handshake
+		if keys := c.tickets.Load(); keys != nil && applied.Swap(keys) != keys {
+			config.SetSessionTicketKeys(*keys)
+		}
+		if next != nil {
+			return next(hello)
+		}
+		return nil, nil
+	}
+}
+
+// Watch refreshes the certificate whenever the provider reports a change,
+// until ctx is done. Providers that cannot watch are only refreshed on reload.
+func (c *Cache) Watch(ctx context.Context) error {
+	watcher, ok := c.provider.(core.CertificateWatcher)
+	if !ok {
+		return nil
+	}
+	return watcher.WatchCertificate(ctx, func() {
+		if err := c.Refresh(ctx); err != nil {
+			log.Error("Failed to reload TLS certificate, keeping the current one", "error", err)
+		}
+	})
+}
@@ -1,10 +1,20 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"log/slog"
 	"os"
-	"strconv"
+	"slices"
 	"strings"
+	"time"
+
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/acmetls"
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/discovery/kubernetes"
+	postgresql_probe "github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/probe/postgresql"
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/storage/vault"
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/tlspolicy"
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/utils"
 )
 
 // RuntimeEnvironment represents the execution environment
@@ -22,6 +32,7 @@ type DiscoveryMode string
 const (
 	DiscoveryKubernetes DiscoveryMode = "kubernetes"
 	DiscoveryStatic     DiscoveryMode = "static"
+	DiscoveryFile       DiscoveryMode = "file"
 )
 
 // TLSMode represents TLS certificate source
@@ -31,6 +42,24 @@ const (
 	TLSModeFile       TLSMode = "file"
 	TLSModeKubernetes TLSMode = "kubernetes"
 	TLSModeMemory     TLSMode = "memory"
+	TLSModeVault      TLSMode = "vault" // HashiCorp Vault PKI role and/or KV v2 secret
+)
+
+// TLSIssuer represents who issues generated certificates
+type TLSIssuer string
+
+const (
+	TLSIssuerSelfSigned TLSIssuer = "self-signed"
+	TLSIssuerCA         TLSIssuer = "ca"   // leaf certificates from a persisted proxy CA
+	TLSIssuerACME       TLSIssuer = "acme" // certificates from an ACME CA such as Let's Encrypt
+)
+
+// HealthCheckMode represents how backends are actively probed
+type HealthCheckMode string
+
+const (
+	HealthCheckTCP      HealthCheckMode = "tcp"
+	HealthCheckPostgres HealthCheckMode = "postgres"
 )
 
 // Config holds all application configuration
@@ -39,19 +68,87 @@ type Config struct {
 	Debug        bool
 	DatabaseType string // postgresql, mysql, mongodb
 
+	// Logging
+	LogLevel         string // debug, info, warn, error; empty follows Debug
+	LogFormat        string // text, json
+	LogStartupParams string // comma-separated StartupMessage keys logged in clear
+
 	// Runtime
 	Runtime   RuntimeEnvironment
 	Namespace string // Only for Kubernetes runtime
+	PodIP     string // from the downward API, covered by generated certificates
 
 	// Server
 	HealthServerPort string
 	ProxyStartPort   string
 
 	// Backend Discovery
-	DiscoveryMode  DiscoveryMode
-	StaticBackends string
-	KubeConfigPath string
-	KubeContext    string
+	DiscoveryMode    DiscoveryMode
+	StaticBackends   string
+	StaticRoutesFile string // optional, persists runtime route changes
+	RouteCatalogFile string // YAML/JSON route catalog for file discovery
+	KubeConfigPath   string
+	KubeContext      string
+
+	// Role probing for static backends (primary/replica routing)
+	RoleProbeUser     string
+	RoleProbePassword string
+	RoleProbeDatabase string
+	RoleProbeSSLMode  postgresql_probe.SSLMode
+	RoleProbeInterval time.Duration
+
+	// Backend dialing
+	BackendDialTimeout       time.Duration
+	BackendDialFallbackDelay time.Duration
+	BackendDialRetries       int
+	BackendDialBackoff       time.Duration
+
+	// Queue mode (hold clients while no backend is available)
+	QueueEnabled        bool
+	QueueTimeout        time.Duration
+	QueueRetryInterval  time.Duration
+	QueueNoticeInterval time.Duration
+
+	// Scale-to-zero wake-up (Kubernetes discovery only)
+	ScaleToZeroEnabled     bool
+	ScaleToZeroWakeTimeout time.Duration
+	ScaleToZeroIdleTimeout time.Duration
+
+	// Admin API
+	AdminToken string
+
+	// Admin console
+	AdminConsoleEnabled      bool
+	AdminConsoleUser         string
+	AdminConsolePassword     string
+	AdminConsolePauseTimeout time.Duration
+
+	// Access log
+	AccessLogEnabled       bool
+	AccessLogOutput        string // file, syslog, stdout
+	AccessLogFile          string
+	AccessLogMaxSizeMB     int
+	AccessLogMaxBackups    int
+	AccessLogMaxAgeDays    int
+	AccessLogSyslogNetwork string // empty for the local syslog daemon
+	AccessLogSyslogAddress string
+
+	// Tracing
+	TracingEnabled     bool
+	TracingExporter    string // otlp, stdout
+	TracingSampleRatio float64
+
+	// Backend health checking
+	HealthCheckEnabled          bool
+	HealthCheckMode             HealthCheckMode
+	HealthCheckInterval         time.Duration
+	HealthCheckTimeout          time.Duration
+	HealthCheckFailureThreshold int
+	HealthCheckOpenDuration     time.Duration
+	HealthCheckUser             string
+	HealthCheckPassword         string
+	HealthCheckDatabase         string
+	HealthCheckSSLMode          postgresql_probe.SSLMode
 
 	// TLS Configuration
 	TLSEnabled              bool
@@ -59,148 +156,492 @@ type Config struct {
 	TLSCertFile             string
 	TLSKeyFile              string
 	TLSSecretName           string
-	TLSAutoGenerate         bool // Generate self-signed if cert doesn't exist
-	TLSAutoRenew            bool // Regenerate if cert is invalid/expired
-	TLSRenewalThresholdDays int  // Days before expiry to trigger renewal
+	TLSLeaderElection       bool     // elect one replica to generate and renew the TLS Secret's certificate
+	TLSLeaderElectionSet    bool     // TLS_LEADER_ELECTION was set explicitly, so the election must run
+	TLSLeaseName            string   // Lease used for TLSLeaderElection
+	TLSAutoGenerate         bool     // Generate self-signed if cert doesn't exist
+	TLSAutoRenew            bool     // Regenerate if cert is invalid/expired
+	TLSRenewalThresholdDays int      // Days before expiry to trigger renewal
+	TLSSANs                 []string // DNS names and IPs the certificate must cover
+	TLSIssuer               TLSIssuer
+	TLSCACertFile           string             // CA certificate when TLS_MODE=file and TLS_ISSUER=ca
+	TLSCAKeyFile            string             // CA private key when TLS_MODE=file and TLS_ISSUER=ca
+	TLSCASecretName         string             // CA Secret when TLS_MODE=kubernetes and TLS_ISSUER=ca
+	TLSCertValidity         time.Duration      // Lifetime of generated and issued certificates
+	TLSKeyAlgorithm         utils.KeyAlgorithm // key type of generated certificates
+	TLSServiceName          string             // Service whose DNS names generated certificates cover when TLS_SANS is empty
+	TLSSNIDir               string             // directory of <hostname>.crt/.key pairs selected by SNI
+	TLSSNISecrets           bool               // serve Secrets named by the xdatabase-proxy-tls-secret Service annotation by SNI
+
+	// TLS policy of the proxy listener
+	TLSProfile               string   // modern, intermediate or legacy
+	TLSMinVersion            string   // overrides the profile's minimum version, e.g. "1.2"
+	TLSMaxVersion            string   // caps the version, e.g. "1.2"
+	TLSCipherSuites          []string // overrides the profile's TLS 1.0-1.2 suites
+	TLSCurvePreferences      []string // key exchange curves in preference order
+	TLSSessionTickets        bool
+	TLSSessionTicketRotation time.Duration // lifetime of a session ticket key shared through the TLS provider
+
+	// ACME (TLS_ISSUER=acme or TLS_MODE=acme)
+	TLSACMEDirectory         string
+	TLSACMEEmail             string
+	TLSACMEChallenge         string
+	TLSACMEDNSHook           string // command creating and removing dns-01 TXT records
+	TLSACMECAFile            string // extra roots for the ACME directory's HTTPS certificate
+	TLSACMEAccountSecretName string // Secret holding the ACME account key in kubernetes mode
+
+	// Vault (TLS_MODE=vault)
+	TLSVaultAddr      string
+	TLSVaultNamespace string // Vault Enterprise namespace
+	TLSVaultCAFile    string // extra roots for Vault's HTTPS certificate
+	TLSVaultAuth      string // kubernetes, approle or token
+	TLSVaultAuthMount string // auth method mount path, defaults to the method name
+	TLSVaultRole      string // Kubernetes auth role
+	TLSVaultJWTFile   string // service account token for Kubernetes auth
+	TLSVaultRoleID    string
+	TLSVaultSecretID  string
+	TLSVaultToken     string
+	TLSVaultPKIMount  string
+	TLSVaultPKIRole   string // issue certificates from this PKI role
+	TLSVaultKVMount   string
+	TLSVaultKVPath    string // read and store the certificate in this KV v2 secret
 }
 
-// LoadFromEnv loads configuration from environment variables
+// LoadFromEnv loads configuration from environment variables only.
 func LoadFromEnv() (*Config, error) {
+	return Load(nil)
+}
+
+// Load builds the configuration from command-line flags, environment variables
+// and an optional YAML config file, in that order of precedence, over the
+// defaults. The file is named by --config or CONFIG_FILE. Every invalid value
+// is reported, joined into the returned error.
+func Load(args []string) (*Config, error) {
+	cfg, errs, err := load(args)
+	if err != nil {
+		return nil, err
+	}
+	errs = append(errs, cfg.validate()...)
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return cfg, nil
+}
+
+// LoadCertificateSettings builds the configuration like Load, but only
+// validates the settings of generated certificates, for commands that do not
+// run the proxy.
+func LoadCertificateSettings(args []string) (*Config, error) {
+	cfg, errs, err := load(args)
+	if err != nil {
+		return nil, err
+	}
+	errs = append(errs, cfg.validateCertificate()...)
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return cfg, nil
+}
+
+// load resolves the configuration and returns the values that could not be
+// parsed, without validating it.
+func load(args []string) (*Config, []error, error) {
+	flags, err := parseFlags(args)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	path, ok := flags["CONFIG"]
+	delete(flags, "CONFIG")
+	if !ok {
+		path = os.Getenv("CONFIG_FILE")
+	}
+	var file map[string]string
+	if path != "" {
+		if file, err = readFile(path); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	l := newLoader(flags, file)
 	cfg := &Config{
 		// Core
-		Debug:        getEnvBool("DEBUG", false),
-		DatabaseType: getEnv("DATABASE_TYPE", "postgresql"),
+		Debug:        l.getBool("DEBUG", false),
+		DatabaseType: l.getString("DATABASE_TYPE", "postgresql"),
+
+		// Logging
+		LogLevel:         l.getString("LOG_LEVEL", ""),
+		LogFormat:        strings.ToLower(l.getString("LOG_FORMAT", "text")),
+		LogStartupParams: l.getString("LOG_STARTUP_PARAMS", ""),
 
 		// Runtime - Auto-detect or explicit
-		Runtime:   determineRuntime(),
-		Namespace: determineNamespace(),
+		Runtime:   l.determineRuntime(),
+		Namespace: l.determineNamespace(),
 
 		// Server
-		HealthServerPort: getEnv("HEALTH_SERVER_PORT", "8080"),
-		ProxyStartPort:   getEnv("PROXY_START_PORT", "5432"),
+		HealthServerPort: l.getString("HEALTH_SERVER_PORT", "8080"),
+		ProxyStartPort:   l.getString("PROXY_START_PORT", "5432"),
 
 		// Backend Discovery
-		DiscoveryMode:  determineDiscoveryMode(),
-		StaticBackends: getEnv("STATIC_BACKENDS", ""),
-		KubeConfigPath: getEnv("KUBECONFIG", ""),
-		KubeContext:    getEnv("KUBE_CONTEXT", ""),
+		DiscoveryMode:    l.determineDiscoveryMode(),
+		StaticBackends:   l.getString("STATIC_BACKENDS", ""),
+		StaticRoutesFile: l.getString("STATIC_ROUTES_FILE", ""),
+		RouteCatalogFile: l.getString("ROUTE_CATALOG_FILE", ""),
+		KubeConfigPath:   l.getString("KUBECONFIG", ""),
+		KubeContext:      l.getString("KUBE_CONTEXT", ""),
+
+		// Role probing
+		RoleProbeUser:     l.getString("ROLE_PROBE_USER", ""),
+		RoleProbePassword: l.getString("ROLE_PROBE_PASSWORD", ""),
+		RoleProbeDatabase: l.getString("ROLE_PROBE_DATABASE", "postgres"),
+		RoleProbeSSLMode:  postgresql_probe.SSLMode(strings.ToLower(l.getString("ROLE_PROBE_SSLMODE", string(postgresql_probe.SSLPrefer)))),
+		RoleProbeInterval: l.getDuration("ROLE_PROBE_INTERVAL", 2*time.Second),
+
+		// Backend dialing
+		BackendDialTimeout:       l.getDuration("BACKEND_DIAL_TIMEOUT", 5*time.Second),
+		BackendDialFallbackDelay: l.getDuration("BACKEND_DIAL_FALLBACK_DELAY", 300*time.Millisecond),
+		BackendDialRetries:       l.getInt("BACKEND_DIAL_RETRIES", 2),
+		BackendDialBackoff:       l.getDuration("BACKEND_DIAL_BACKOFF", 200*time.Millisecond),
+
+		// Queue mode
+		QueueEnabled:        l.getBool("QUEUE_ENABLED", false),
+		QueueTimeout:        l.getDuration("QUEUE_TIMEOUT", 30*time.Second),
+		QueueRetryInterval:  l.getDuration("QUEUE_RETRY_INTERVAL", time.Second),
+		QueueNoticeInterval: l.getDuration("QUEUE_NOTICE_INTERVAL", 5*time.Second),
+
+		// Scale-to-zero wake-up
+		ScaleToZeroEnabled:     l.getBool("SCALE_TO_ZERO_ENABLED", false),
+		ScaleToZeroWakeTimeout: l.getDuration("SCALE_TO_ZERO_WAKE_TIMEOUT", 2*time.Minute),
+		ScaleToZeroIdleTimeout: l.getDuration("SCALE_TO_ZERO_IDLE_TIMEOUT", 30*time.Minute),
+
+		// Admin API
+		AdminToken: l.getString("ADMIN_TOKEN", ""),
+
+		// Admin console
+		AdminConsoleEnabled:      l.getBool("ADMIN_CONSOLE_ENABLED", false),
+		AdminConsoleUser:         l.getString("ADMIN_CONSOLE_USER", "admin"),
+		AdminConsolePassword:     l.getString("ADMIN_CONSOLE_PASSWORD", ""),
+		AdminConsolePauseTimeout: l.getDuration("ADMIN_CONSOLE_PAUSE_TIMEOUT", 2*time.Minute),
+
+		// Access log
+		AccessLogEnabled:       l.getBool("ACCESS_LOG_ENABLED", false),
+		AccessLogOutput:        strings.ToLower(l.getString("ACCESS_LOG_OUTPUT", "file")),
+		AccessLogFile:          l.getString("ACCESS_LOG_FILE", "/var/log/xdatabase-proxy/access.log"),
+		AccessLogMaxSizeMB:     l.getInt("ACCESS_LOG_MAX_SIZE_MB", 100),
+		AccessLogMaxBackups:    l.getInt("ACCESS_LOG_MAX_BACKUPS", 5),
+		AccessLogMaxAgeDays:    l.getInt("ACCESS_LOG_MAX_AGE_DAYS", 0),
+		AccessLogSyslogNetwork: l.getString("ACCESS_LOG_SYSLOG_NETWORK", ""),
+		AccessLogSyslogAddress: l.getString("ACCESS_LOG_SYSLOG_ADDRESS", ""),
+
+		// Tracing
+		TracingEnabled:     l.getBool("TRACING_ENABLED", false),
+		TracingExporter:    strings.ToLower(l.getString("TRACING_EXPORTER", "otlp")),
+		TracingSampleRatio: l.getFloat("TRACING_SAMPLE_RATIO", 1.0),
+
+		// Backend health checking
+		HealthCheckEnabled:          l.getBool("HEALTH_CHECK_ENABLED", false),
+		HealthCheckMode:             HealthCheckMode(strings.ToLower(l.getString("HEALTH_CHECK_MODE", string(HealthCheckTCP)))),
+		HealthCheckInterval:         l.getDuration("HEALTH_CHECK_INTERVAL", 5*time.Second),
+		HealthCheckTimeout:          l.getDuration("HEALTH_CHECK_TIMEOUT", 2*time.Second),
+		HealthCheckFailureThreshold: l.getInt("HEALTH_CHECK_FAILURE_THRESHOLD", 3),
+		HealthCheckOpenDuration:     l.getDuration("HEALTH_CHECK_OPEN_DURATION", 30*time.Second),
+		HealthCheckUser:             l.getString("HEALTH_CHECK_USER", l.getString("ROLE_PROBE_USER", "")),
+		HealthCheckPassword:         l.getString("HEALTH_CHECK_PASSWORD", l.getString("ROLE_PROBE_PASSWORD", "")),
+		HealthCheckDatabase:         l.getString("HEALTH_CHECK_DATABASE", l.getString("ROLE_PROBE_DATABASE", "postgres")),
+		HealthCheckSSLMode:          postgresql_probe.SSLMode(strings.ToLower(l.getString("HEALTH_CHECK_SSLMODE", l.getString("ROLE_PROBE_SSLMODE", string(postgresql_probe.SSLPrefer))))),
 
 		// TLS
-		TLSEnabled:              getEnvBool("TLS_ENABLED", true),
-		TLSMode:                 determineTLSMode(),
-		TLSCertFile:             getEnv("TLS_CERT_FILE", ""),
-		TLSKeyFile:              getEnv("TLS_KEY_FILE", ""),
-		TLSSecretName:           getEnv("TLS_SECRET_NAME", ""),
-		TLSAutoGenerate:         getEnvBool("TLS_AUTO_GENERATE", true),
-		TLSAutoRenew:            getEnvBool("TLS_AUTO_RENEW", true),
-		TLSRenewalThresholdDays: getEnvInt("TLS_RENEWAL_THRESHOLD_DAYS", 30),
+		TLSEnabled:              l.getBool("TLS_ENABLED", true),
+		TLSMode:                 l.determineTLSMode(),
+		TLSCertFile:             l.getString("TLS_CERT_FILE", ""),
+		TLSKeyFile:              l.getString("TLS_KEY_FILE", ""),
+		TLSSecretName:           l.getString("TLS_SECRET_NAME", ""),
+		TLSLeaderElection:       l.getBool("TLS_LEADER_ELECTION", true),
+		TLSLeaderElectionSet:    l.isSet("TLS_LEADER_ELECTION"),
+		TLSLeaseName:            l.getString("TLS_LEASE_NAME", ""),
+		TLSAutoGenerate:         l.getBool("TLS_AUTO_GENERATE", true),
+		TLSAutoRenew:            l.getBool("TLS_AUTO_RENEW", true),
+		TLSRenewalThresholdDays: l.getInt("TLS_RENEWAL_THRESHOLD_DAYS", 30),
+		TLSSANs:                 l.getList("TLS_SANS"),
+		TLSIssuer:               l.determineTLSIssuer(),
+		TLSCACertFile:           l.getString("TLS_CA_CERT_FILE", ""),
+		TLSCAKeyFile:            l.getString("TLS_CA_KEY_FILE", ""),
+		TLSCASecretName:         l.getString("TLS_CA_SECRET_NAME", ""),
+		TLSCertValidity:         l.getDuration("TLS_CERT_VALIDITY", 0),
+		TLSKeyAlgorithm:         l.determineKeyAlgorithm(),
+		TLSServiceName:          l.getString("TLS_SERVICE_NAME", ""),
+		PodIP:                   l.getString("POD_IP", ""),
+		TLSSNIDir:               l.getString("TLS_SNI_DIR", ""),
+		TLSSNISecrets:           l.getBool("TLS_SNI_SECRETS", false),
+
+		TLSProfile:               strings.ToLower(l.getString("TLS_PROFILE", tlspolicy.ProfileIntermediate)),
+		TLSMinVersion:            l.getString("TLS_MIN_VERSION", ""),
+		TLSMaxVersion:            l.getString("TLS_MAX_VERSION", ""),
+		TLSCipherSuites:          l.getList("TLS_CIPHER_SUITES"),
+		TLSCurvePreferences:      l.getList("TLS_CURVE_PREFERENCES"),
+		TLSSessionTickets:        l.getBool("TLS_SESSION_TICKETS", true),
+		TLSSessionTicketRotation: l.getDuration("TLS_SESSION_TICKET_ROTATION", 12*time.Hour),
+
+		TLSACMEDirectory:         l.getString("TLS_ACME_DIRECTORY", "https://acme-v02.api.letsencrypt.org/directory"),
+		TLSACMEEmail:             l.getString("TLS_ACME_EMAIL", ""),
+		TLSACMEChallenge:         strings.ToLower(l.getString("TLS_ACME_CHALLENGE", acmetls.ChallengeTLSALPN)),
+		TLSACMEDNSHook:           l.getString("TLS_ACME_DNS_HOOK", ""),
+		TLSACMECAFile:            l.getString("TLS_ACME_CA_FILE", ""),
+		TLSACMEAccountSecretName: l.getString("TLS_ACME_ACCOUNT_SECRET_NAME", ""),
+
+		TLSVaultAddr:      l.getString("TLS_VAULT_ADDR", ""),
+		TLSVaultNamespace: l.getString("TLS_VAULT_NAMESPACE", ""),
+		TLSVaultCAFile:    l.getString("TLS_VAULT_CA_FILE", ""),
+		TLSVaultAuth:      strings.ToLower(l.getString("TLS_VAULT_AUTH", vault.AuthKubernetes)),
+		TLSVaultAuthMount: l.getString("TLS_VAULT_AUTH_MOUNT", ""),
+		TLSVaultRole:      l.getString("TLS_VAULT_ROLE", ""),
+		TLSVaultJWTFile:   l.getString("TLS_VAULT_JWT_FILE", "/var/run/secrets/kubernetes.io/serviceaccount/token"),
+		TLSVaultRoleID:    l.getString("TLS_VAULT_ROLE_ID", ""),
+		TLSVaultSecretID:  l.getString("TLS_VAULT_SECRET_ID", ""),
+		TLSVaultToken:     l.getString("TLS_VAULT_TOKEN", ""),
+		TLSVaultPKIMount:  l.getString("TLS_VAULT_PKI_MOUNT", "pki"),
+		TLSVaultPKIRole:   l.getString("TLS_VAULT_PKI_ROLE", ""),
+		TLSVaultKVMount:   l.getString("TLS_VAULT_KV_MOUNT", "secret"),
+		TLSVaultKVPath:    l.getString("TLS_VAULT_KV_PATH", ""),
 	}
 
 	// Legacy support
-	cfg.applyLegacySupport()
-
-	// Validation
-	if err := cfg.validate(); err != nil {
-		return nil, err
+	cfg.applyLegacySupport(l)
+	if cfg.TLSLeaseName == "" && cfg.TLSSecretName != "" {
+		cfg.TLSLeaseName = cfg.TLSSecretName + "-leader"
 	}
-
-	return cfg, nil
+	if cfg.TLSCASecretName == "" && cfg.TLSSecretName != "" {
+		cfg.TLSCASecretName = cfg.TLSSecretName + "-ca"
+	}
+	if cfg.TLSACMEAccountSecretName == "" && cfg.TLSSecretName != "" {
+		cfg.TLSACMEAccountSecretName = cfg.TLSSecretName + "-acme-account"
+	}
+	if cfg.TLSVaultAuthMount == "" {
+		cfg.TLSVaultAuthMount = cfg.TLSVaultAuth
+	}
+	if cfg.TLSCertValidity == 0 {
+		// Issued certificates are short-lived and rotated; self-signed ones are pinned by clients
+		if cfg.TLSIssuer == TLSIssuerCA || (cfg.TLSMode == TLSModeVault && cfg.TLSVaultPKIRole != "") {
+			cfg.TLSCertValidity = 24 * time.Hour
+		} else {
+			cfg.TLSCertValidity = 365 * 24 * time.Hour
+		}
+	}
+	l.checkUnknown()
+	return cfg, l.errs, nil
 }
 
 // validate ensures configuration is coherent
-func (c *Config) validate() error {
+func (c *Config) validate() []error {
+	var errs []error
+
 	// Validate database type
 	validDatabases := []string{"postgresql", "mysql", "mongodb"}
 	if !contains(validDatabases, c.DatabaseType) {
-		return fmt.Errorf("unsupported DATABASE_TYPE: %s (supported: %s)",
-			c.DatabaseType, strings.Join(validDatabases, ", "))
+		errs = append(errs, fmt.Errorf("unsupported DATABASE_TYPE: %s (supported: %s)",
+			c.DatabaseType, strings.Join(validDatabases, ", ")))
+	}
+
+	if c.LogLevel != "" {
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(c.LogLevel)); err != nil {
+			errs = append(errs, fmt.Errorf("unsupported LOG_LEVEL: %s (supported: debug, info, warn, error)", c.LogLevel))
+		}
+	}
+	if c.LogFormat != "text" && c.LogFormat != "json" {
+		errs = append(errs, fmt.Errorf("unsupported LOG_FORMAT: %s (supported: text, json)", c.LogFormat))
 	}
 
 	// TLS validation only if TLS is enabled
 	if c.TLSEnabled {
 		if c.TLSMode == TLSModeFile {
 			if c.TLSCertFile == "" || c.TLSKeyFile == "" {
-				return fmt.Errorf("TLS_CERT_FILE and TLS_KEY_FILE must be set when using file-based TLS")
+				errs = append(errs, fmt.Errorf("TLS_CERT_FILE and TLS_KEY_FILE must be set when using file-based TLS"))
 			}
 		}
 
 		if c.TLSMode == TLSModeKubernetes {
 			if c.TLSSecretName == "" {
-				return fmt.Errorf("TLS_SECRET_NAME must be set when using kubernetes TLS mode")
+				errs = append(errs, fmt.Errorf("TLS_SECRET_NAME must be set when using kubernetes TLS mode"))
+			}
+			if c.DiscoveryMode != DiscoveryKubernetes {
+				errs = append(errs, fmt.Errorf("kubernetes TLS mode requires kubernetes discovery (cannot use %s discovery)", c.DiscoveryMode))
+			}
+		}
+
+		if c.TLSRenewalThresholdDays < 0 {
+			errs = append(errs, fmt.Errorf("TLS_RENEWAL_THRESHOLD_DAYS must not be negative"))
+		}
+		errs = append(errs, c.validateCertificate()...)
+		if _, err := c.TLSPolicy(); err != nil {
+			errs = append(errs, err)
+		}
+		if c.TLSSessionTickets && c.TLSSessionTicketRotation < time.Minute {
+			errs = append(errs, fmt.Errorf("TLS_SESSION_TICKET_ROTATION must be at least 1m"))
+		}
+
+		if c.TLSIssuer == TLSIssuerCA {
+			if c.TLSMode == TLSModeFile && (c.TLSCACertFile == "" || c.TLSCAKeyFile == "") {
+				errs = append(errs, fmt.Errorf("TLS_CA_CERT_FILE and TLS_CA_KEY_FILE must be set when TLS_ISSUER=ca uses file-based TLS"))
 			}
-			if c.DiscoveryMode == DiscoveryStatic {
-				return fmt.Errorf("kubernetes TLS mode requires kubernetes discovery (cannot use STATIC_BACKENDS)")
+			if c.TLSMode == TLSModeKubernetes && c.TLSCASecretName == c.TLSSecretName {
+				errs = append(errs, fmt.Errorf("TLS_CA_SECRET_NAME must differ from TLS_SECRET_NAME"))
+			}
+		}
+
+		if c.TLSIssuer == TLSIssuerACME {
+			if len(c.TLSSANs) == 0 {
+				errs = append(errs, fmt.Errorf("TLS_SANS must list the domains to request when TLS_ISSUER=acme"))
+			}
+			switch c.TLSACMEChallenge {
+			case acmetls.ChallengeTLSALPN:
+				for _, name := range c.TLSSANs {
+					if strings.HasPrefix(name, "*.") {
+						errs = append(errs, fmt.Errorf("wildcard %s requires TLS_ACME_CHALLENGE=dns-01", name))
+					}
+				}
+			case acmetls.ChallengeDNS:
+				if c.TLSACMEDNSHook == "" {
+					errs = append(errs, fmt.Errorf("TLS_ACME_DNS_HOOK must be set when TLS_ACME_CHALLENGE=dns-01"))
+				}
+			default:
+				errs = append(errs, fmt.Errorf("unsupported TLS_ACME_CHALLENGE: %s (supported: tls-alpn-01, dns-01)", c.TLSACMEChallenge))
+			}
+			if c.TLSKeyAlgorithm == utils.KeyEd25519 {
+				errs = append(errs, fmt.Errorf("TLS_KEY_ALGORITHM=ed25519 is not supported when TLS_ISSUER=acme"))
+			}
+			if c.TLSACMEAccountSecretName == c.TLSSecretName && c.TLSMode == TLSModeKubernetes {
+				errs = append(errs, fmt.Errorf("TLS_ACME_ACCOUNT_SECRET_NAME must differ from TLS_SECRET_NAME"))
+			}
+		}
+
+		if c.TLSMode == TLSModeVault {
+			errs = append(errs, c.validateVault()...)
+		}
+	}
+
+	if c.BackendDialTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("BACKEND_DIAL_TIMEOUT must be positive"))
+	}
+	if c.BackendDialRetries < 0 {
+		errs = append(errs, fmt.Errorf("BACKEND_DIAL_RETRIES must not be negative"))
+	}
+
+	if c.QueueEnabled && c.QueueTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("QUEUE_TIMEOUT must be positive when QUEUE_ENABLED=true"))
+	}
+
+	if c.StaticRoutesFile != "" && c.DiscoveryMode != DiscoveryStatic {
+		errs = append(errs, fmt.Errorf("STATIC_ROUTES_FILE requires static discovery"))
+	}
+
+	if c.RoleProbeUser != "" && !slices.Contains(postgresql_probe.SSLModes, c.RoleProbeSSLMode) {
+		errs = append(errs, fmt.Errorf("unsupported ROLE_PROBE_SSLMODE: %s (supported: disable, prefer, require)", c.RoleProbeSSLMode))
+	}
+
+	if c.DiscoveryMode == DiscoveryFile && c.RouteCatalogFile == "" {
+		errs = append(errs, fmt.Errorf("ROUTE_CATALOG_FILE is required for file discovery"))
+	}
+	if c.RouteCatalogFile != "" && c.DiscoveryMode != DiscoveryFile {
+		errs = append(errs, fmt.Errorf("ROUTE_CATALOG_FILE requires file discovery"))
+	}
+
+	if c.ScaleToZeroEnabled {
+		if c.DiscoveryMode != DiscoveryKubernetes {
+			errs = append(errs, fmt.Errorf("SCALE_TO_ZERO_ENABLED requires kubernetes discovery"))
+		}
+		if c.ScaleToZeroWakeTimeout <= 0 {
+			errs = append(errs, fmt.Errorf("SCALE_TO_ZERO_WAKE_TIMEOUT must be positive"))
+		}
+		if c.ScaleToZeroIdleTimeout < kubernetes.ScaleTickInterval {
+			errs = append(errs, fmt.Errorf("SCALE_TO_ZERO_IDLE_TIMEOUT must be at least %s", kubernetes.ScaleTickInterval))
+		}
+	}
+
+	if c.AdminConsoleEnabled {
+		if c.AdminConsolePassword == "" {
+			errs = append(errs, fmt.Errorf("ADMIN_CONSOLE_PASSWORD is required when ADMIN_CONSOLE_ENABLED=true"))
+		}
+		if !c.TLSEnabled {
+			errs = append(errs, fmt.Errorf("ADMIN_CONSOLE_ENABLED requires TLS_ENABLED=true, the console password is sent in clear text"))
+		}
+		if c.AdminConsolePauseTimeout <= 0 {
+			errs = append(errs, fmt.Errorf("ADMIN_CONSOLE_PAUSE_TIMEOUT must be positive"))
+		}
+	}
+
+	if c.AccessLogEnabled {
+		switch c.AccessLogOutput {
+		case "stdout", "syslog":
+		case "file":
+			if c.AccessLogFile == "" {
+				errs = append(errs, fmt.Errorf("ACCESS_LOG_FILE is required when ACCESS_LOG_OUTPUT=file"))
 			}
+		default:
+			errs = append(errs, fmt.Errorf("unsupported ACCESS_LOG_OUTPUT: %s (supported: stdout, file, syslog)", c.AccessLogOutput))
+		}
+		if c.AccessLogSyslogNetwork != "" && c.AccessLogSyslogAddress == "" {
+			errs = append(errs, fmt.Errorf("ACCESS_LOG_SYSLOG_ADDRESS is required when ACCESS_LOG_SYSLOG_NETWORK is set"))
+		}
+	}
+
+	if c.TracingEnabled {
+		if c.TracingExporter != "otlp" && c.TracingExporter != "stdout" {
+			errs = append(errs, fmt.Errorf("unsupported TRACING_EXPORTER: %s (supported: otlp, stdout)", c.TracingExporter))
+		}
+		if c.TracingSampleRatio < 0 || c.TracingSampleRatio > 1 {
+			errs = append(errs, fmt.Errorf("TRACING_SAMPLE_RATIO must be between 0 and 1"))
+		}
+	}
+
+	// Health check validation only if enabled
+	if c.HealthCheckEnabled {
+		if c.HealthCheckMode != HealthCheckTCP && c.HealthCheckMode != HealthCheckPostgres {
+			errs = append(errs, fmt.Errorf("unsupported HEALTH_CHECK_MODE: %s (supported: tcp, postgres)", c.HealthCheckMode))
+		}
+		if c.HealthCheckMode == HealthCheckPostgres && c.HealthCheckUser == "" {
+			errs = append(errs, fmt.Errorf("HEALTH_CHECK_USER (or ROLE_PROBE_USER) must be set when HEALTH_CHECK_MODE=postgres"))
+		}
+		if c.HealthCheckMode == HealthCheckPostgres && !slices.Contains(postgresql_probe.SSLModes, c.HealthCheckSSLMode) {
+			errs = append(errs, fmt.Errorf("unsupported HEALTH_CHECK_SSLMODE: %s (supported: disable, prefer, require)", c.HealthCheckSSLMode))
 		}
 	}
 
 	// Validate discovery mode
 	if c.DiscoveryMode == DiscoveryKubernetes && c.Runtime == RuntimeContainer && c.KubeConfigPath == "" {
-		return fmt.Errorf("kubernetes discovery in container runtime requires KUBECONFIG path")
+		errs = append(errs, fmt.Errorf("kubernetes discovery in container runtime requires KUBECONFIG path"))
 	}
 
-	return nil
+	return errs
 }
 
-// applyLegacySupport handles backward compatibility
-func (c *Config) applyLegacySupport() {
+// applyLegacySupport handles backward compatibility. A legacy setting only
+// applies when its replacement is not set by a source of the same or higher precedence.
+func (c *Config) applyLegacySupport(l *loader) {
 	// Legacy: POSTGRESQL_PROXY_ENABLED
-	if getEnvBool("POSTGRESQL_PROXY_ENABLED", false) {
+	if l.getBool("POSTGRESQL_PROXY_ENABLED", false) && l.overrides("POSTGRESQL_PROXY_ENABLED", "DATABASE_TYPE") {
 		c.DatabaseType = "postgresql"
 	}
 
 	// Legacy: POSTGRESQL_PROXY_START_PORT
-	if legacyPort := getEnv("POSTGRESQL_PROXY_START_PORT", ""); legacyPort != "" {
+	if legacyPort := l.getString("POSTGRESQL_PROXY_START_PORT", ""); legacyPort != "" && l.overrides("POSTGRESQL_PROXY_START_PORT", "PROXY_START_PORT") {
 		c.ProxyStartPort = legacyPort
 	}
 
 	// Legacy: TLS_ENABLE_SELF_SIGNED
-	if getEnvBool("TLS_ENABLE_SELF_SIGNED", false) {
+	if l.getBool("TLS_ENABLE_SELF_SIGNED", false) && l.overrides("TLS_ENABLE_SELF_SIGNED", "TLS_AUTO_GENERATE") {
 		c.TLSAutoGenerate = true
 	}
 
 	// Legacy: POD_NAMESPACE
-	if podNS := getEnv("POD_NAMESPACE", ""); podNS != "" && c.Namespace == "" {
+	if podNS := l.getString("POD_NAMESPACE", ""); podNS != "" && c.Namespace == "" {
 		c.Namespace = podNS
 	}
 }
 
-// Helper functions
-
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
-	}
-	return defaultValue
-}
-
-func getEnvBool(key string, defaultValue bool) bool {
-	value := os.Getenv(key)
-	if value == "" {
-		return defaultValue
-	}
-	boolValue, err := strconv.ParseBool(value)
-	if err != nil {
-		return defaultValue
-	}
-	return boolValue
-}
-
-func getEnvInt(key string, defaultValue int) int {
-	value := os.Getenv(key)
-	if value == "" {
-		return defaultValue
-	}
-	intValue, err := strconv.Atoi(value)
-	if err != nil {
-		return defaultValue
-	}
-	return intValue
-}
-
-func determineRuntime() RuntimeEnvironment {
+func (l *loader) determineRuntime() RuntimeEnvironment {
 	// Explicit runtime setting
-	if runtime := os.Getenv("RUNTIME"); runtime != "" {
+	if runtime, ok := l.lookup("RUNTIME"); ok {
 		switch strings.ToLower(runtime) {
 		case "kubernetes", "k8s":
 			return RuntimeKubernetes
@@ -209,6 +650,7 @@ func determineRuntime() RuntimeEnvironment {
 		case "vm", "virtual-machine", "bare-metal":
 			return RuntimeVM
 		}
+		l.errs = append(l.errs, fmt.Errorf("unsupported RUNTIME: %s (supported: kubernetes, container, vm)", runtime))
 	}
 
 	// Auto-detect: Check if running in Kubernetes
@@ -225,14 +667,14 @@ func determineRuntime() RuntimeEnvironment {
 	return RuntimeVM
 }
 
-func determineNamespace() string {
+func (l *loader) determineNamespace() string {
 	// Explicit namespace
-	if ns := os.Getenv("NAMESPACE"); ns != "" {
+	if ns, ok := l.lookup("NAMESPACE"); ok {
 		return ns
 	}
 
 	// Kubernetes downward API
-	if ns := os.Getenv("POD_NAMESPACE"); ns != "" {
+	if ns, ok := l.lookup("POD_NAMESPACE"); ok {
 		return ns
 	}
 
@@ -244,26 +686,37 @@ func determineNamespace() string {
 	return "default"
 }
 
-func determineDiscoveryMode() DiscoveryMode {
+func (l *loader) determineDiscoveryMode() DiscoveryMode {
 	// Explicit mode
-	if mode := os.Getenv("DISCOVERY_MODE"); mode != "" {
-		if strings.ToLower(mode) == "static" {
+	if mode, ok := l.lookup("DISCOVERY_MODE"); ok {
+		switch strings.ToLower(mode) {
+		case "kubernetes":
+			return DiscoveryKubernetes
+		case "static":
 			return DiscoveryStatic
+		case "file":
+			return DiscoveryFile
 		}
+		l.errs = append(l.errs, fmt.Errorf("unsupported DISCOVERY_MODE: %s (supported: kubernetes, static, file)", mode))
 		return DiscoveryKubernetes
 	}
 
-	// Auto-detect: Static if STATIC_BACKENDS is set
-	if os.Getenv("STATIC_BACKENDS") != "" {
+	// Auto-detect: File if ROUTE_CATALOG_FILE is set
+	if l.isSet("ROUTE_CATALOG_FILE") {
+		return DiscoveryFile
+	}
+
+	// Auto-detect: Static if STATIC_BACKENDS or STATIC_ROUTES_FILE is set
+	if l.isSet("STATIC_BACKENDS") || l.isSet("STATIC_ROUTES_FILE") {
 		return DiscoveryStatic
 	}
 
 	return DiscoveryKubernetes
 }
 
-func determineTLSMode() TLSMode {
+func (l *loader) determineTLSMode() TLSMode {
 	// Explicit mode
-	if mode := os.Getenv("TLS_MODE"); mode != "" {
+	if mode, ok := l.lookup("TLS_MODE"); ok {
 		switch strings.ToLower(mode) {
 		case "file", "filesystem":
 			return TLSModeFile
@@ -271,21 +724,128 @@ func determineTLSMode() TLSMode {
 			return TLSModeKubernetes
 		case "memory", "in-memory":
 			return TLSModeMemory
+		case "vault":
+			return TLSModeVault
+		case "acme":
+			// ACME certificates are stored where the other settings point,
+			// see determineTLSIssuer
+		default:
+			l.errs = append(l.errs, fmt.Errorf("unsupported TLS_MODE: %s (supported: file, kubernetes, memory, vault, acme)", mode))
 		}
 	}
 
 	// Auto-detect based on configuration
-	if os.Getenv("TLS_CERT_FILE") != "" {
+	if l.isSet("TLS_VAULT_ADDR") {
+		return TLSModeVault
+	}
+
+	if l.isSet("TLS_CERT_FILE") {
 		return TLSModeFile
 	}
 
-	if os.Getenv("TLS_SECRET_NAME") != "" {
+	if l.isSet("TLS_SECRET_NAME") {
 		return TLSModeKubernetes
 	}
 
 	return TLSModeMemory
 }
 
+func (l *loader) determineTLSIssuer() TLSIssuer {
+	// TLS_MODE=acme is a shorthand for TLS_ISSUER=acme
+	if mode, ok := l.lookup("TLS_MODE"); ok && strings.EqualFold(mode, "acme") {
+		if issuer, ok := l.lookup("TLS_ISSUER"); ok && !strings.EqualFold(issuer, string(TLSIssuerACME)) {
+			l.errs = append(l.errs, fmt.Errorf("TLS_MODE=acme conflicts with TLS_ISSUER=%s", issuer))
+		}
+		return TLSIssuerACME
+	}
+
+	issuer := l.getString("TLS_ISSUER", string(TLSIssuerSelfSigned))
+	switch TLSIssuer(strings.ToLower(issuer)) {
+	case TLSIssuerSelfSigned:
+		return TLSIssuerSelfSigned
+	case TLSIssuerCA:
+		return TLSIssuerCA
+	case TLSIssuerACME:
+		return TLSIssuerACME
+	}
+	l.errs = append(l.errs, fmt.Errorf("unsupported TLS_ISSUER: %s (supported: self-signed, ca, acme)", issuer))
+	return TLSIssuerSelfSigned
+}
+
+// determineKeyAlgorithm returns TLS_KEY_ALGORITHM. It defaults to RSA under
+// the legacy profile, whose RSA key exchange suites need an RSA certificate.
+func (l *loader) determineKeyAlgorithm() utils.KeyAlgorithm {
+	fallback := utils.KeyECDSAP256
+	if strings.EqualFold(l.getString("TLS_PROFILE", tlspolicy.ProfileIntermediate), tlspolicy.ProfileLegacy) {
+		fallback = utils.KeyRSA2048
+	}
+	return utils.KeyAlgorithm(strings.ToLower(l.getString("TLS_KEY_ALGORITHM", string(fallback))))
+}
+
+// CertificateHosts returns the names generated certificates are valid for:
+// TLS_SANS, or the hostname, pod IP and TLS_SERVICE_NAME DNS names.
+func (c *Config) CertificateHosts() []string {
+	if len(c.TLSSANs) > 0 {
+		return c.TLSSANs
+	}
+	return utils.DefaultHosts(c.PodIP, c.TLSServiceName, c.Namespace)
+}
+
+// TLSPolicy returns the versions, cipher suites and curves of the proxy
+// listener: TLS_PROFILE with the TLS_MIN_VERSION, TLS_MAX_VERSION,
+// TLS_CIPHER_SUITES and TLS_CURVE_PREFERENCES overrides.
+func (c *Config) TLSPolicy() (*tlspolicy.Policy, error) {
+	return tlspolicy.New(c.TLSProfile, c.TLSMinVersion, c.TLSMaxVersion, c.TLSCipherSuites, c.TLSCurvePreferences)
+}
+
+// validateCertificate checks the settings of generated certificates.
+func (c *Config) validateCertificate() []error {
+	var errs []error
+	if c.TLSCertValidity < time.Hour {
+		errs = append(errs, fmt.Errorf("TLS_CERT_VALIDITY must be at least 1h"))
+	}
+	if !slices.Contains(utils.KeyAlgorithms, c.TLSKeyAlgorithm) {
+		errs = append(errs, fmt.Errorf("unsupported TLS_KEY_ALGORITHM: %s (supported: ecdsa-p256, ecdsa-p384, ed25519, rsa-2048, rsa-4096)", c.TLSKeyAlgorithm))
+	} else if c.TLSProfile == tlspolicy.ProfileLegacy && c.TLSKeyAlgorithm != utils.KeyRSA2048 && c.TLSKeyAlgorithm != utils.KeyRSA4096 {
+		errs = append(errs, fmt.Errorf("TLS_PROFILE=legacy requires an RSA TLS_KEY_ALGORITHM (rsa-2048 or rsa-4096), old clients cannot use a %s certificate", c.TLSKeyAlgorithm))
+	}
+	return errs
+}
+
+// validateVault checks the settings of TLS_MODE=vault.
+func (c *Config) validateVault() []error {
+	var errs []error
+	if c.TLSVaultAddr == "" {
+		errs = append(errs, fmt.Errorf("TLS_VAULT_ADDR must be set when TLS_MODE=vault"))
+	}
+	if c.TLSVaultPKIRole == "" && c.TLSVaultKVPath == "" {
+		errs = append(errs, fmt.Errorf("TLS_VAULT_PKI_ROLE or TLS_VAULT_KV_PATH must be set when TLS_MODE=vault"))
+	}
+	if c.TLSIssuer != TLSIssuerSelfSigned {
+		errs = append(errs, fmt.Errorf("TLS_MODE=vault does not support TLS_ISSUER=%s (use TLS_VAULT_PKI_ROLE)", c.TLSIssuer))
+	}
+	if c.TLSVaultPKIRole != "" && len(c.TLSSANs) == 0 {
+		errs = append(errs, fmt.Errorf("TLS_SANS must list the names to request when TLS_VAULT_PKI_ROLE is set"))
+	}
+	switch c.TLSVaultAuth {
+	case vault.AuthKubernetes:
+		if c.TLSVaultRole == "" {
+			errs = append(errs, fmt.Errorf("TLS_VAULT_ROLE must be set when TLS_VAULT_AUTH=kubernetes"))
+		}
+	case vault.AuthAppRole:
+		if c.TLSVaultRoleID == "" || c.TLSVaultSecretID == "" {
+			errs = append(errs, fmt.Errorf("TLS_VAULT_ROLE_ID and TLS_VAULT_SECRET_ID must be set when TLS_VAULT_AUTH=approle"))
+		}
+	case vault.AuthToken:
+		if c.TLSVaultToken == "" {
+			errs = append(errs, fmt.Errorf("TLS_VAULT_TOKEN must be set when TLS_VAULT_AUTH=token"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unsupported TLS_VAULT_AUTH: %s (supported: kubernetes, approle, token)", c.TLSVaultAuth))
+	}
+	return errs
+}
+
 func contains(slice []string, item string) bool {
 	for _, s := range slice {
 		if s == item {
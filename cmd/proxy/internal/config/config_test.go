@@ -0,0 +1,97 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/utils"
+)
+
+func TestLoadCertificateSettings(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	data := "tls_sans: [db.example.com, 10.0.0.5]\ntls_key_algorithm: ecdsa-p384\ndiscovery_mode: kubernetes\n"
+	if err := os.WriteFile(file, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		args         []string
+		wantErr      bool
+		wantHosts    []string
+		wantKey      utils.KeyAlgorithm
+		wantValidity time.Duration
+	}{
+		{
+			// The file's kubernetes discovery without a cluster is not validated
+			name:         "config file",
+			args:         []string{"--config", file},
+			wantHosts:    []string{"db.example.com", "10.0.0.5"},
+			wantKey:      utils.KeyECDSAP384,
+			wantValidity: 365 * 24 * time.Hour,
+		},
+		{
+			name:         "flags over the file",
+			args:         []string{"--config", file, "--tls-sans", "other.example.com", "--tls-cert-validity", "2160h"},
+			wantHosts:    []string{"other.example.com"},
+			wantKey:      utils.KeyECDSAP384,
+			wantValidity: 2160 * time.Hour,
+		},
+		{
+			name:         "legacy profile defaults to RSA",
+			args:         []string{"--tls-sans", "db.example.com", "--tls-profile", "legacy"},
+			wantHosts:    []string{"db.example.com"},
+			wantKey:      utils.KeyRSA2048,
+			wantValidity: 365 * 24 * time.Hour,
+		},
+		{name: "legacy profile with an ECDSA key", args: []string{"--tls-profile", "legacy", "--tls-key-algorithm", "ecdsa-p256"}, wantErr: true},
+		{name: "short validity", args: []string{"--tls-cert-validity", "30m"}, wantErr: true},
+		{name: "unknown key algorithm", args: []string{"--tls-key-algorithm", "dsa"}, wantErr: true},
+		{name: "invalid duration", args: []string{"--tls-cert-validity", "a year"}, wantErr: true},
+		{name: "unknown flag", args: []string{"--tls-sanz", "db.example.com"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := LoadCertificateSettings(tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadCertificateSettings(%q) error = %v, wantErr %v", tt.args, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if hosts := cfg.CertificateHosts(); !slices.Equal(hosts, tt.wantHosts) {
+				t.Errorf("CertificateHosts() = %v, want %v", hosts, tt.wantHosts)
+			}
+			if cfg.TLSKeyAlgorithm != tt.wantKey || cfg.TLSCertValidity != tt.wantValidity {
+				t.Errorf("key %s, validity %s; want %s, %s", cfg.TLSKeyAlgorithm, cfg.TLSCertValidity, tt.wantKey, tt.wantValidity)
+			}
+		})
+	}
+}
+
+func TestLeaderElectionDefault(t *testing.T) {
+	// A static configuration that passes validation without a cluster
+	base := []string{"--tls-enabled", "false", "--discovery-mode", "static", "--static-backends", "db1=127.0.0.1:5432"}
+	tests := []struct {
+		args        []string
+		wantEnabled bool
+		wantSet     bool
+	}{
+		{args: nil, wantEnabled: true, wantSet: false},
+		{args: []string{"--tls-leader-election", "true"}, wantEnabled: true, wantSet: true},
+		{args: []string{"--tls-leader-election", "false"}, wantEnabled: false, wantSet: true},
+	}
+	for _, tt := range tests {
+		cfg, err := Load(append(base, tt.args...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.TLSLeaderElection != tt.wantEnabled || cfg.TLSLeaderElectionSet != tt.wantSet {
+			t.Errorf("load(%q): enabled %v, set %v; want %v, %v", tt.args,
+				cfg.TLSLeaderElection, cfg.TLSLeaderElectionSet, tt.wantEnabled, tt.wantSet)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package config
+
+import "strings"
+
+// restartSettings are only read at startup. Changing them in a reload is
+// reported instead of applied.
+var restartSettings = []struct {
+	name  string
+	value func(c *Config) any
+}{
+	{"DATABASE_TYPE", func(c *Config) any { return c.DatabaseType }},
+	{"PROXY_START_PORT", func(c *Config) any { return c.ProxyStartPort }},
+	{"HEALTH_SERVER_PORT", func(c *Config) any { return c.HealthServerPort }},
+	{"LOG_FORMAT", func(c *Config) any { return c.LogFormat }},
+	{"ACCESS_LOG_*", func(c *Config) any {
+		return [...]any{c.AccessLogEnabled, c.AccessLogOutput, c.AccessLogFile, c.AccessLogMaxSizeMB,
+			c.AccessLogMaxBackups, c.AccessLogMaxAgeDays, c.AccessLogSyslogNetwork, c.AccessLogSyslogAddress}
+	}},
+	{"TRACING_*", func(c *Config) any {
+		return [...]any{c.TracingEnabled, c.TracingExporter, c.TracingSampleRatio}
+	}},
+	{"HEALTH_CHECK_*", func(c *Config) any {
+		return [...]any{c.HealthCheckEnabled, c.HealthCheckMode, c.HealthCheckInterval, c.HealthCheckTimeout,
+			c.HealthCheckFailureThreshold, c.HealthCheckOpenDuration, c.HealthCheckUser, c.HealthCheckPassword,
+			c.HealthCheckDatabase, c.HealthCheckSSLMode}
+	}},
+}
+
+// RestartRequired returns the settings that differ in next but only take
+// effect on restart. c should be the configuration the process started with.
+func (c *Config) RestartRequired(next *Config) []string {
+	var changed []string
+	for _, s := range restartSettings {
+		if s.value(c) != s.value(next) {
+			changed = append(changed, s.name)
+		}
+	}
+	return changed
+}
+
+// SameDiscovery reports whether next discovers backends exactly like c, in
+// which case the running resolver is kept across a reload.
+func (c *Config) SameDiscovery(next *Config) bool {
+	return c.discovery() == next.discovery()
+}
+
+func (c *Config) discovery() any {
+	return [...]any{c.Runtime, c.Namespace, c.DiscoveryMode, c.StaticBackends, c.StaticRoutesFile,
+		c.RouteCatalogFile, c.KubeConfigPath, c.KubeContext, c.RoleProbeUser, c.RoleProbePassword,
+		c.RoleProbeDatabase, c.RoleProbeSSLMode, c.RoleProbeInterval, c.ScaleToZeroEnabled, c.ScaleToZeroWakeTimeout,
+		c.ScaleToZeroIdleTimeout}
+}
+
+// SameTLSProvider reports whether next reads and renews the certificate like
+// c, in which case the running provider is kept across a reload.
+func (c *Config) SameTLSProvider(next *Config) bool {
+	return c.tlsProvider() == next.tlsProvider()
+}
+
+func (c *Config) tlsProvider() any {
+	return [...]any{c.TLSEnabled, c.TLSMode, c.TLSCertFile, c.TLSKeyFile, c.TLSSecretName, c.TLSLeaderElection, c.TLSLeaderElectionSet, c.TLSLeaseName,
+		c.TLSAutoRenew, c.TLSRenewalThresholdDays, strings.Join(c.TLSSANs, ","), c.TLSIssuer, c.TLSCACertFile,
+		c.TLSCAKeyFile, c.TLSCASecretName, c.TLSCertValidity, c.TLSACMEDirectory, c.TLSACMEEmail, c.TLSACMEChallenge,
+		c.TLSACMEDNSHook, c.TLSACMECAFile, c.TLSACMEAccountSecretName, c.TLSSNIDir, c.TLSSNISecrets,
+		c.TLSKeyAlgorithm, c.TLSServiceName, c.PodIP, c.TLSSessionTickets, c.TLSSessionTicketRotation,
+		c.TLSVaultAddr, c.TLSVaultNamespace, c.TLSVaultCAFile, c.TLSVaultAuth, c.TLSVaultAuthMount, c.TLSVaultRole,
+		c.TLSVaultJWTFile, c.TLSVaultRoleID, c.TLSVaultSecretID, c.TLSVaultToken, c.TLSVaultPKIMount, c.TLSVaultPKIRole,
+		c.TLSVaultKVMount, c.TLSVaultKVPath}
+}
@@ -0,0 +1,271 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Every setting has a single name, its environment variable (e.g. TLS_ENABLED).
+// The same name is accepted in the config file as tls_enabled (or TLS_ENABLED)
+// and on the command line as --tls-enabled.
+
+// normalizeKey maps tls-enabled, tls_enabled and TLS_ENABLED to TLS_ENABLED.
+func normalizeKey(key string) string {
+	return strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(key), "-", "_"))
+}
+
+// parseFlags reads --key=value and --key value arguments. A flag that is
+// followed by another flag, or by nothing, is a boolean set to true. A
+// negative number such as -1 is a value, not a flag.
+func parseFlags(args []string) (map[string]string, error) {
+	flags := make(map[string]string)
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		name, ok := strings.CutPrefix(arg, "--")
+		if !ok {
+			name, ok = strings.CutPrefix(arg, "-")
+		}
+		if !ok || name == "" {
+			return nil, fmt.Errorf("unexpected argument %q", arg)
+		}
+
+		key, value, hasValue := strings.Cut(name, "=")
+		if !hasValue {
+			if i+1 < len(args) && !isFlag(args[i+1]) {
+				i++
+				value = args[i]
+			} else {
+				value = "true"
+			}
+		}
+		flags[normalizeKey(key)] = value
+	}
+	return flags, nil
+}
+
+// isFlag reports whether arg is a flag name rather than a value.
+func isFlag(arg string) bool {
+	name, ok := strings.CutPrefix(arg, "-")
+	if !ok || name == "" {
+		return false
+	}
+	// -1, -0.5 and -5s are values
+	return name[0] == '-' || name[0] < '0' || name[0] > '9'
+}
+
+// readFile reads a YAML (or JSON) config file of setting names to scalar values.
+// Lists are joined with commas, e.g. for LOG_STARTUP_PARAMS.
+func readFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	raw := make(map[string]any)
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	values := make(map[string]string, len(raw))
+	for key, value := range raw {
+		s, err := scalarString(value)
+		if err != nil {
+			return nil, fmt.Errorf("config file %s: %s: %w", path, key, err)
+		}
+		values[normalizeKey(key)] = s
+	}
+	return values, nil
+}
+
+func scalarString(value any) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case []any:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			if _, nested := item.([]any); nested {
+				return "", fmt.Errorf("nested lists are not supported")
+			}
+			s, err := scalarString(item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, s)
+		}
+		return strings.Join(items, ","), nil
+	default:
+		return "", fmt.Errorf("expected a scalar or a list, got %T", value)
+	}
+}
+
+// loader resolves settings with precedence flags > environment > file > default
+// and collects every parse error instead of falling back to defaults.
+type loader struct {
+	flags map[string]string
+	file  map[string]string
+	env   func(string) string
+
+	known map[string]bool
+	errs  []error
+}
+
+func newLoader(flags, file map[string]string) *loader {
+	return &loader{flags: flags, file: file, env: os.Getenv, known: make(map[string]bool)}
+}
+
+// lookup returns the value of key from the highest-precedence source that sets it.
+// An empty environment variable counts as unset.
+func (l *loader) lookup(key string) (string, bool) {
+	l.known[key] = true
+	if value, ok := l.flags[key]; ok {
+		return value, true
+	}
+	if value := l.env(key); value != "" {
+		return value, true
+	}
+	if value, ok := l.file[key]; ok && value != "" {
+		return value, true
+	}
+	return "", false
+}
+
+func (l *loader) isSet(key string) bool {
+	_, ok := l.lookup(key)
+	return ok
+}
+
+// Source precedence returned by rank.
+const (
+	rankUnset = iota
+	rankFile
+	rankEnv
+	rankFlag
+)
+
+// rank returns the precedence of the source that sets key.
+func (l *loader) rank(key string) int {
+	l.known[key] = true
+	if _, ok := l.flags[key]; ok {
+		return rankFlag
+	}
+	if l.env(key) != "" {
+		return rankEnv
+	}
+	if value, ok := l.file[key]; ok && value != "" {
+		return rankFile
+	}
+	return rankUnset
+}
+
+// overrides reports whether the legacy setting is set by a source of higher
+// precedence than its replacement key, so the replacement keeps precedence
+// whenever both come from the same source.
+func (l *loader) overrides(legacy, key string) bool {
+	return l.rank(legacy) > l.rank(key)
+}
+
+func (l *loader) invalid(key, value, kind string) {
+	l.errs = append(l.errs, fmt.Errorf("%s: invalid %s %q", key, kind, value))
+}
+
+func (l *loader) getString(key, defaultValue string) string {
+	if value, ok := l.lookup(key); ok {
+		return value
+	}
+	return defaultValue
+}
+
+func (l *loader) getBool(key string, defaultValue bool) bool {
+	value, ok := l.lookup(key)
+	if !ok {
+		return defaultValue
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		l.invalid(key, value, "boolean")
+		return defaultValue
+	}
+	return b
+}
+
+func (l *loader) getInt(key string, defaultValue int) int {
+	value, ok := l.lookup(key)
+	if !ok {
+		return defaultValue
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		l.invalid(key, value, "integer")
+		return defaultValue
+	}
+	return i
+}
+
+func (l *loader) getFloat(key string, defaultValue float64) float64 {
+	value, ok := l.lookup(key)
+	if !ok {
+		return defaultValue
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		l.invalid(key, value, "number")
+		return defaultValue
+	}
+	return f
+}
+
+func (l *loader) getDuration(key string, defaultValue time.Duration) time.Duration {
+	value, ok := l.lookup(key)
+	if !ok {
+		return defaultValue
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		l.invalid(key, value, "duration")
+		return defaultValue
+	}
+	return d
+}
+
+// getList splits a comma-separated setting, dropping empty items.
+func (l *loader) getList(key string) []string {
+	value, _ := l.lookup(key)
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// checkUnknown reports flags and file entries that do not name a setting,
+// which are almost always typos.
+func (l *loader) checkUnknown() {
+	report := func(source string, values map[string]string) {
+		var unknown []string
+		for key := range values {
+			if !l.known[key] {
+				unknown = append(unknown, key)
+			}
+		}
+		sort.Strings(unknown)
+		for _, key := range unknown {
+			l.errs = append(l.errs, fmt.Errorf("%s: unknown %s", key, source))
+		}
+	}
+	report("flag", l.flags)
+	report("config file setting", l.file)
+}
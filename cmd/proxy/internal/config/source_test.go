@@ -0,0 +1,60 @@
+package config
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestParseFlags(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want map[string]string
+	}{
+		{"equals", []string{"--proxy-start-port=6432"}, map[string]string{"PROXY_START_PORT": "6432"}},
+		{"separate value", []string{"--proxy-start-port", "6432"}, map[string]string{"PROXY_START_PORT": "6432"}},
+		{"single dash", []string{"-log-level", "debug"}, map[string]string{"LOG_LEVEL": "debug"}},
+		{"boolean", []string{"--tls-enabled", "--debug"}, map[string]string{"TLS_ENABLED": "true", "DEBUG": "true"}},
+		{"negative number", []string{"--backend-dial-retries", "-1"}, map[string]string{"BACKEND_DIAL_RETRIES": "-1"}},
+		{"negative after equals", []string{"--backend-dial-retries=-1"}, map[string]string{"BACKEND_DIAL_RETRIES": "-1"}},
+		{"negative duration", []string{"--queue-timeout", "-5s", "--debug"}, map[string]string{"QUEUE_TIMEOUT": "-5s", "DEBUG": "true"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseFlags(tt.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("parseFlags(%q) = %v, want %v", tt.args, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLegacyStartPortPrecedence(t *testing.T) {
+	tests := []struct {
+		name  string
+		flags map[string]string
+		env   map[string]string
+		file  map[string]string
+		want  string
+	}{
+		{"legacy only", nil, map[string]string{"POSTGRESQL_PROXY_START_PORT": "7000"}, nil, "7000"},
+		{"flag wins", map[string]string{"PROXY_START_PORT": "6432"}, map[string]string{"POSTGRESQL_PROXY_START_PORT": "7000"}, nil, "6432"},
+		{"env wins", nil, map[string]string{"PROXY_START_PORT": "6432", "POSTGRESQL_PROXY_START_PORT": "7000"}, nil, "6432"},
+		{"legacy env over file", nil, map[string]string{"POSTGRESQL_PROXY_START_PORT": "7000"}, map[string]string{"PROXY_START_PORT": "6432"}, "7000"},
+		{"unset", nil, nil, nil, "5432"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newLoader(tt.flags, tt.file)
+			l.env = func(key string) string { return tt.env[key] }
+			cfg := &Config{ProxyStartPort: l.getString("PROXY_START_PORT", "5432")}
+			cfg.applyLegacySupport(l)
+			if cfg.ProxyStartPort != tt.want {
+				t.Errorf("ProxyStartPort = %s, want %s", cfg.ProxyStartPort, tt.want)
+			}
+		})
+	}
+}
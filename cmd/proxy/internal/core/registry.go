@@ -0,0 +1,218 @@
+package core
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrConnectionNotFound is returned when a connection ID is not in the registry.
+var ErrConnectionNotFound = errors.New("connection not found")
+
+// Session holds what a handler learned about a connection during its handshake.
+type Session struct {
+	DatabaseType DatabaseType
+	DeploymentID string
+	User         string
+	Database     string
+	Pooled       bool
+	Backend      string
+}
+
+// Connection is a live client connection. Handlers fill in the session and
+// byte counters; Kill terminates it in a protocol-aware way once the handler
+// has installed a kill function.
+type Connection struct {
+	ID         string
+	ClientAddr string
+	StartedAt  time.Time
+
+	BytesToBackend atomic.Int64
+	BytesToClient  atomic.Int64
+
+	mu      sync.Mutex
+	session Session
+	kill    func()
+	killed  bool
+}
+
+// NewConnection creates an untracked connection entry for conn.
+// By default Kill closes conn.
+func NewConnection(conn net.Conn) *Connection {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return &Connection{
+		ID:         hex.EncodeToString(b),
+		ClientAddr: conn.RemoteAddr().String(),
+		StartedAt:  time.Now(),
+		kill:       func() { conn.Close() },
+	}
+}
+
+// SetSession records the session details.
+func (c *Connection) SetSession(s Session) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.session = s
+}
+
+// SetBackend records the backend address the session was connected to.
+func (c *Connection) SetBackend(addr string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.session.Backend = addr
+}
+
+// Session returns the session details.
+func (c *Connection) Session() Session {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.session
+}
+
+// SetKill replaces the function used to terminate the connection.
+func (c *Connection) SetKill(kill func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.kill = kill
+}
+
+// Kill terminates the connection. Only the first call has an effect.
+func (c *Connection) Kill() {
+	c.mu.Lock()
+	if c.killed {
+		c.mu.Unlock()
+		return
+	}
+	c.killed = true
+	kill := c.kill
+	c.mu.Unlock()
+
+	if kill != nil {
+		kill()
+	}
+}
+
+// Killed reports whether Kill was called.
+func (c *Connection) Killed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.killed
+}
+
+// ConnectionInfo is a point-in-time view of a Connection.
+type ConnectionInfo struct {
+	ID              string       `json:"id"`
+	ClientAddr      string       `json:"client_addr"`
+	DatabaseType    DatabaseType `json:"database_type,omitempty"`
+	DeploymentID    string       `json:"deployment_id,omitempty"`
+	User            string       `json:"user,omitempty"`
+	Database        string       `json:"database,omitempty"`
+	Pooled          bool         `json:"pooled"`
+	Backend         string       `json:"backend,omitempty"`
+	StartedAt       time.Time    `json:"started_at"`
+	DurationSeconds float64      `json:"duration_seconds"`
+	BytesToBackend  int64        `json:"bytes_client_to_backend"`
+	BytesToClient   int64        `json:"bytes_backend_to_client"`
+}
+
+// Info returns a snapshot of the connection.
+func (c *Connection) Info() ConnectionInfo {
+	s := c.Session()
+	return ConnectionInfo{
+		ID:              c.ID,
+		ClientAddr:      c.ClientAddr,
+		DatabaseType:    s.DatabaseType,
+		DeploymentID:    s.DeploymentID,
+		User:            s.User,
+		Database:        s.Database,
+		Pooled:          s.Pooled,
+		Backend:         s.Backend,
+		StartedAt:       c.StartedAt,
+		DurationSeconds: time.Since(c.StartedAt).Seconds(),
+		BytesToBackend:  c.BytesToBackend.Load(),
+		BytesToClient:   c.BytesToClient.Load(),
+	}
+}
+
+// ConnectionFilter selects connections; empty fields match everything.
+type ConnectionFilter struct {
+	DeploymentID string
+	User         string
+	Database     string
+	Backend      string
+}
+
+// Matches reports whether info passes the filter.
+func (f ConnectionFilter) Matches(info ConnectionInfo) bool {
+	return (f.DeploymentID == "" || f.DeploymentID == info.DeploymentID) &&
+		(f.User == "" || f.User == info.User) &&
+		(f.Database == "" || f.Database == info.Database) &&
+		(f.Backend == "" || f.Backend == info.Backend)
+}
+
+// ConnectionRegistry tracks the live client connections of a Server.
+type ConnectionRegistry struct {
+	conns map[string]*Connection
+	mu    sync.RWMutex
+}
+
+func NewConnectionRegistry() *ConnectionRegistry {
+	return &ConnectionRegistry{conns: make(map[string]*Connection)}
+}
+
+// Add registers c.
+func (r *ConnectionRegistry) Add(c *Connection) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.conns[c.ID] = c
+}
+
+// Remove unregisters the connection with id.
+func (r *ConnectionRegistry) Remove(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.conns, id)
+}
+
+// Get returns the connection with id.
+func (r *ConnectionRegistry) Get(id string) (*Connection, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	c, ok := r.conns[id]
+	return c, ok
+}
+
+// List returns the connections matching filter, oldest first.
+func (r *ConnectionRegistry) List(filter ConnectionFilter) []ConnectionInfo {
+	r.mu.RLock()
+	conns := make([]*Connection, 0, len(r.conns))
+	for _, c := range r.conns {
+		conns = append(conns, c)
+	}
+	r.mu.RUnlock()
+
+	infos := make([]ConnectionInfo, 0, len(conns))
+	for _, c := range conns {
+		if info := c.Info(); filter.Matches(info) {
+			infos = append(infos, info)
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].StartedAt.Before(infos[j].StartedAt) })
+	return infos
+}
+
+// Kill terminates the connection with id.
+func (r *ConnectionRegistry) Kill(id string) error {
+	c, ok := r.Get(id)
+	if !ok {
+		return ErrConnectionNotFound
+	}
+	c.Kill()
+	return nil
+}
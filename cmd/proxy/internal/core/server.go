@@ -2,6 +2,7 @@ package core
 
 import (
 	"net"
+	"sync/atomic"
 )
 
 // Server is the generic TCP proxy server.
@@ -9,6 +10,18 @@ import (
 type Server struct {
 	Listener          net.Listener
 	ConnectionHandler ConnectionHandler
+
+	// Registry, when set, tracks every live connection
+	Registry *ConnectionRegistry
+
+	// handler replaces ConnectionHandler once SetConnectionHandler is called
+	handler atomic.Pointer[ConnectionHandler]
+}
+
+// SetConnectionHandler replaces the handler for new connections, e.g. after a
+// configuration reload. Connections already accepted keep their handler.
+func (s *Server) SetConnectionHandler(handler ConnectionHandler) {
+	s.handler.Store(&handler)
 }
 
 // Serve starts accepting connections.
@@ -22,7 +35,28 @@ func (s *Server) Serve() error {
 	}
 }
 
+func (s *Server) currentHandler() ConnectionHandler {
+	if handler := s.handler.Load(); handler != nil {
+		return *handler
+	}
+	return s.ConnectionHandler
+}
+
 func (s *Server) handleConnection(clientConn net.Conn) {
-	// Delegate the entire lifecycle to the handler
-	s.ConnectionHandler.HandleConnection(clientConn)
+	handler := s.currentHandler()
+	if s.Registry == nil {
+		// Delegate the entire lifecycle to the handler
+		handler.HandleConnection(clientConn)
+		return
+	}
+
+	tracked := NewConnection(clientConn)
+	s.Registry.Add(tracked)
+	defer s.Registry.Remove(tracked.ID)
+
+	if trackedHandler, ok := handler.(TrackedConnectionHandler); ok {
+		trackedHandler.HandleTrackedConnection(clientConn, tracked)
+		return
+	}
+	handler.HandleConnection(clientConn)
 }
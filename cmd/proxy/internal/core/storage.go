@@ -0,0 +1,60 @@
+package core
+
+import (
+	"context"
+	"errors"
+)
+
+// WrappedStorage is embedded by TLS providers that obtain certificates
+// themselves and keep them in another TLSProvider, such as the proxy CA and
+// ACME. It forwards the optional interfaces of that storage, so certificate
+// watches, leader election and shared session ticket keys keep working through
+// the wrapper.
+type WrappedStorage struct {
+	TLSProvider
+}
+
+// WatchCertificate forwards to the storage, so certificates stored by other
+// instances are picked up.
+func (s WrappedStorage) WatchCertificate(ctx context.Context, onChange func()) error {
+	watcher, ok := s.TLSProvider.(CertificateWatcher)
+	if !ok {
+		return nil
+	}
+	return watcher.WatchCertificate(ctx, onChange)
+}
+
+// IsLeader forwards to the storage, so only the elected instance generates and
+// renews certificates. Storage without an election always leads.
+func (s WrappedStorage) IsLeader() bool {
+	election, ok := s.TLSProvider.(CertificateElection)
+	return !ok || election.IsLeader()
+}
+
+// LeaderChanged forwards to the storage.
+func (s WrappedStorage) LeaderChanged() <-chan struct{} {
+	election, ok := s.TLSProvider.(CertificateElection)
+	if !ok {
+		return nil
+	}
+	return election.LeaderChanged()
+}
+
+// LoadSessionTicketKeys forwards to the storage, so replicas share their
+// session ticket keys where they share certificates.
+func (s WrappedStorage) LoadSessionTicketKeys(ctx context.Context) ([]byte, error) {
+	store, ok := s.TLSProvider.(SessionTicketKeyStore)
+	if !ok {
+		return nil, errors.ErrUnsupported
+	}
+	return store.LoadSessionTicketKeys(ctx)
+}
+
+// StoreSessionTicketKeys forwards to the storage.
+func (s WrappedStorage) StoreSessionTicketKeys(ctx context.Context, data []byte) error {
+	store, ok := s.TLSProvider.(SessionTicketKeyStore)
+	if !ok {
+		return errors.ErrUnsupported
+	}
+	return store.StoreSessionTicketKeys(ctx, data)
+}
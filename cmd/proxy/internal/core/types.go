@@ -3,17 +3,31 @@ package core
 import (
 	"context"
 	"crypto/tls"
+	"errors"
+	"fmt"
 	"net"
+	"time"
+)
+
+// Resolution errors shared by all BackendResolver implementations.
+var (
+	ErrMissingDeploymentID = errors.New("metadata missing 'deployment_id'")
+	ErrBackendNotFound     = errors.New("backend not found")
+	ErrNoHealthyBackend    = errors.New("no healthy backend")
+	ErrAccessDenied        = errors.New("access denied")
 )
 
 // RoutingMetadata contains information extracted from the protocol handshake
 // used to determine the destination backend (e.g., "database": "finance").
+// Connection handlers also set "client_addr" and "tls" ("true" or "false")
+// so resolvers can enforce per-route access rules.
 type RoutingMetadata map[string]string
 
-// BackendResolver defines how to find a backend address based on metadata.
+// BackendResolver defines how to find backend addresses based on metadata.
 // It is purely a lookup mechanism and knows nothing about the network.
+// Candidates are returned in order of preference; the caller dials them in turn.
 type BackendResolver interface {
-	Resolve(ctx context.Context, metadata RoutingMetadata, databaseType DatabaseType) (string, error)
+	Resolve(ctx context.Context, metadata RoutingMetadata, databaseType DatabaseType) ([]string, error)
 }
 
 // ConnectionHandler defines the interface for handling a client connection.
@@ -23,6 +37,14 @@ type ConnectionHandler interface {
 	HandleConnection(conn net.Conn)
 }
 
+// TrackedConnectionHandler is implemented by handlers that report session
+// details and byte counts to the connection registry and can terminate a
+// session in a protocol-aware way.
+type TrackedConnectionHandler interface {
+	ConnectionHandler
+	HandleTrackedConnection(conn net.Conn, tracked *Connection)
+}
+
 // ProtocolHandler defines how to interpret the initial connection handshake.
 // It abstracts away the specific database wire protocol (Postgres, MySQL, etc).
 // Deprecated: Use ConnectionHandler for full lifecycle management.
@@ -42,6 +64,55 @@ type TLSProvider interface {
 	Store(ctx context.Context, certPEM, keyPEM []byte) error
 }
 
+// CertificateWatcher is implemented by TLS providers that can tell when the
+// stored certificate changes, e.g. a rotated file or an updated Secret.
+// onChange is called until ctx is done.
+type CertificateWatcher interface {
+	WatchCertificate(ctx context.Context, onChange func()) error
+}
+
+// CertificateIssuer is implemented by TLS providers that obtain new
+// certificates from an issuer (e.g. a CA) instead of generating self-signed ones.
+// The issued pair is PEM-encoded and is stored through the provider by the caller.
+type CertificateIssuer interface {
+	IssueCertificate(ctx context.Context) (certPEM, keyPEM []byte, err error)
+}
+
+// TLSChallengeResponder is implemented by TLS providers that answer ACME
+// TLS-ALPN-01 challenges on the proxy listener. It returns the challenge
+// certificate for hello, or false when no challenge is pending for it.
+type TLSChallengeResponder interface {
+	ChallengeCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, bool)
+}
+
+// CertificateElection is implemented by TLS providers whose storage is shared
+// by replicas that elect one of them to generate and renew the certificate.
+// The others wait for it to be stored and pick it up through their
+// CertificateWatcher.
+type CertificateElection interface {
+	// IsLeader reports whether this instance may generate the certificate.
+	IsLeader() bool
+	// LeaderChanged receives a value when this instance gains or loses the lead.
+	LeaderChanged() <-chan struct{}
+}
+
+// SessionTicketKeyStore is implemented by TLS providers that keep the TLS
+// session ticket keys next to the certificate, so replicas behind a load
+// balancer can resume each other's sessions. The keys are an opaque blob;
+// LoadSessionTicketKeys returns an error wrapping os.ErrNotExist when none are
+// stored and errors.ErrUnsupported when the provider cannot share them.
+type SessionTicketKeyStore interface {
+	LoadSessionTicketKeys(ctx context.Context) ([]byte, error)
+	StoreSessionTicketKeys(ctx context.Context, data []byte) error
+}
+
+// SNICertificateSource supplies certificates selected by the SNI host name,
+// keyed by lowercase host name or wildcard ("*.example.com"). onChange is
+// called with the complete set once loaded and whenever it changes, until ctx is done.
+type SNICertificateSource interface {
+	WatchSNICertificates(ctx context.Context, onChange func(map[string]*tls.Certificate)) error
+}
+
 type DatabaseType string
 
 const (
@@ -49,3 +120,87 @@ const (
 	DatabaseTypeMysql      DatabaseType = "mysql"
 	DatabaseTypeScylla     DatabaseType = "scylla"
 )
+
+// BackendRole identifies which member of a replicated cluster a connection targets.
+// It is carried in RoutingMetadata under the "role" key.
+type BackendRole string
+
+const (
+	BackendRolePrimary BackendRole = "primary"
+	BackendRoleReplica BackendRole = "replica"
+)
+
+// RolePreferReplica is the "role" of a client that asked for a replica but
+// accepts the primary when none is available (target_session_attrs=prefer-standby).
+const RolePreferReplica = "prefer-replica"
+
+// RequestedRole returns the role requested by the client, defaulting to primary.
+func (m RoutingMetadata) RequestedRole() BackendRole {
+	switch m["role"] {
+	case string(BackendRoleReplica), RolePreferReplica:
+		return BackendRoleReplica
+	}
+	return BackendRolePrimary
+}
+
+// PrefersReplica reports whether the primary is an acceptable fallback for a
+// replica request. Resolvers then return the primary candidates after the replicas.
+func (m RoutingMetadata) PrefersReplica() bool {
+	return m["role"] == RolePreferReplica
+}
+
+// BackendHealth tracks backend availability.
+// Resolvers consult it to skip unhealthy targets and connection handlers
+// report dial outcomes to it. Addresses are tracked from their first lookup.
+type BackendHealth interface {
+	IsHealthy(addr string) bool
+	ReportSuccess(addr string)
+	ReportFailure(addr string, err error)
+}
+
+// BackendTracker is implemented by a BackendHealth that probes backends
+// before they are looked up. Resolvers with configured backends pass it
+// their addresses whenever the configuration changes.
+type BackendTracker interface {
+	Track(addrs ...string)
+}
+
+// WakingError is returned by resolvers when the backend is being started
+// (scale-to-zero) and the client should be held until it becomes ready.
+type WakingError struct {
+	Target  string        // workload being started, e.g. "namespace/statefulset/name"
+	Timeout time.Duration // how long clients may wait for it
+}
+
+func (e *WakingError) Error() string {
+	return fmt.Sprintf("backend %s is starting", e.Target)
+}
+
+// ConnectionObserver is notified when a proxied connection to a backend opens and closes.
+// Resolvers may implement it to track backend usage.
+type ConnectionObserver interface {
+	ConnectionOpened(metadata RoutingMetadata, backendAddr string)
+	ConnectionClosed(metadata RoutingMetadata, backendAddr string)
+}
+
+// Route describes where a deployment is routed to.
+type Route struct {
+	DeploymentID string   `json:"deployment_id"`
+	Pooled       bool     `json:"pooled"`
+	Role         string   `json:"role,omitempty"`
+	Addresses    []string `json:"addresses"`
+	Source       string   `json:"source,omitempty"`
+}
+
+// RouteLister is implemented by resolvers that can enumerate their routes.
+type RouteLister interface {
+	Routes() []Route
+}
+
+// RouteStore is implemented by resolvers whose routes can be changed at runtime.
+// Keys are "deployment_id" or "deployment_id.pool".
+type RouteStore interface {
+	RouteLister
+	SetRoute(key string, addrs []string) error
+	DeleteRoute(key string) error
+}
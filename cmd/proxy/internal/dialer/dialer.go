@@ -0,0 +1,177 @@
+package dialer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/core"
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/logger"
+)
+
+// Dialer connects to the first reachable backend out of an ordered candidate list.
+// Candidates are raced Happy-Eyeballs style: the next one is started when the
+// previous has not connected within FallbackDelay. If every candidate fails the
+// whole round is retried up to Retries times with exponential backoff.
+type Dialer struct {
+	Timeout       time.Duration      // per-attempt connect timeout
+	FallbackDelay time.Duration      // head start given to each candidate before the next is tried
+	Retries       int                // extra rounds after the first one fails
+	Backoff       time.Duration      // wait before the first retry, doubled after each round
+	Health        core.BackendHealth // optional, receives per-address outcomes
+}
+
+// Attempt records a single failed connection attempt.
+type Attempt struct {
+	Address string
+	Err     error
+}
+
+// DialError is returned when every candidate failed in every round.
+type DialError struct {
+	Attempts []Attempt
+}
+
+func (e *DialError) Error() string {
+	tried := make([]string, 0, len(e.Attempts))
+	for _, a := range e.Attempts {
+		err := a.Err
+		// The address is already part of the message, keep only the cause
+		var opErr *net.OpError
+		if errors.As(err, &opErr) {
+			err = opErr.Err
+		}
+		tried = append(tried, fmt.Sprintf("%s (%v)", a.Address, err))
+	}
+	return "tried " + strings.Join(tried, ", ")
+}
+
+// Default returns a Dialer with the proxy's default settings.
+func Default() *Dialer {
+	return &Dialer{
+		Timeout:       5 * time.Second,
+		FallbackDelay: 300 * time.Millisecond,
+		Retries:       2,
+		Backoff:       200 * time.Millisecond,
+	}
+}
+
+// Dial returns the connection and the address it was established to.
+func (d *Dialer) Dial(ctx context.Context, candidates []string) (net.Conn, string, error) {
+	if len(candidates) == 0 {
+		return nil, "", fmt.Errorf("no backend candidates")
+	}
+
+	dialErr := &DialError{}
+	backoff := d.Backoff
+	for round := 0; round <= d.Retries; round++ {
+		if round > 0 {
+			logger.Debug("Retrying backend dial", "round", round, "backoff", backoff, "candidates", candidates)
+			select {
+			case <-ctx.Done():
+				dialErr.Attempts = append(dialErr.Attempts, Attempt{Address: "retry", Err: ctx.Err()})
+				return nil, "", dialErr
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+
+		conn, addr, attempts := d.race(ctx, candidates)
+		dialErr.Attempts = append(dialErr.Attempts, attempts...)
+		if conn != nil {
+			return conn, addr, nil
+		}
+	}
+	return nil, "", dialErr
+}
+
+type dialResult struct {
+	addr string
+	conn net.Conn
+	err  error
+}
+
+// race dials the candidates in order, starting the next one after FallbackDelay
+// or as soon as the previous one fails. The first successful connection wins.
+func (d *Dialer) race(ctx context.Context, candidates []string) (net.Conn, string, []Attempt) {
+	raceCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan dialResult, len(candidates))
+	start := func(addr string) {
+		go func() {
+			dialer := net.Dialer{Timeout: d.Timeout}
+			conn, err := dialer.DialContext(raceCtx, "tcp", addr)
+			results <- dialResult{addr: addr, conn: conn, err: err}
+		}()
+	}
+
+	var attempts []Attempt
+	var winner *dialResult
+	next, pending := 0, 0
+
+	start(candidates[next])
+	next++
+	pending++
+
+	fallback := time.NewTimer(d.FallbackDelay)
+	defer fallback.Stop()
+
+	for pending > 0 {
+		select {
+		case <-fallback.C:
+			if winner == nil && next < len(candidates) {
+				start(candidates[next])
+				next++
+				pending++
+				fallback.Reset(d.FallbackDelay)
+			}
+		case res := <-results:
+			pending--
+			if res.err != nil {
+				// Attempts aborted because another candidate won are not failures
+				if !errors.Is(res.err, context.Canceled) {
+					attempts = append(attempts, Attempt{Address: res.addr, Err: res.err})
+					d.report(res.addr, res.err)
+				} else if winner == nil {
+					attempts = append(attempts, Attempt{Address: res.addr, Err: res.err})
+				}
+				// A failure immediately hands over to the next candidate
+				if winner == nil && next < len(candidates) {
+					start(candidates[next])
+					next++
+					pending++
+					fallback.Reset(d.FallbackDelay)
+				}
+				continue
+			}
+			d.report(res.addr, nil)
+			if winner == nil {
+				winner = &res
+				// Abort the attempts still in flight
+				cancel()
+			} else {
+				res.conn.Close()
+			}
+		}
+	}
+
+	if winner == nil {
+		return nil, "", attempts
+	}
+	return winner.conn, winner.addr, attempts
+}
+
+func (d *Dialer) report(addr string, err error) {
+	if d.Health == nil {
+		return
+	}
+	if err != nil {
+		d.Health.ReportFailure(addr, err)
+	} else {
+		d.Health.ReportSuccess(addr)
+	}
+}
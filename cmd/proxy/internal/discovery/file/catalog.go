@@ -0,0 +1,214 @@
+package file
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/core"
+	"sigs.k8s.io/yaml"
+)
+
+// Client TLS requirements of a route.
+const (
+	TLSModeAllow   = "allow"   // plaintext and TLS clients are accepted (default)
+	TLSModeRequire = "require" // plaintext clients are rejected
+)
+
+// File is the on-disk catalog format. YAML and JSON are both accepted:
+//
+//	routes:
+//	  - deployment_id: db1
+//	    pooled: false
+//	    addresses:
+//	      - 10.0.1.5:5432
+//	      - address: 10.0.1.6:5432
+//	        weight: 3
+//	        role: replica
+//	    tls_mode: require
+//	    allowed_cidrs: [10.0.0.0/8]
+type File struct {
+	Routes []RouteSpec `json:"routes"`
+}
+
+// RouteSpec is one catalog entry.
+type RouteSpec struct {
+	DeploymentID string        `json:"deployment_id"`
+	Pooled       bool          `json:"pooled"`
+	Addresses    []AddressSpec `json:"addresses"`
+	TLSMode      string        `json:"tls_mode,omitempty"`
+	AllowedCIDRs []string      `json:"allowed_cidrs,omitempty"`
+}
+
+// AddressSpec is a backend address. It may be written as a plain "host:port" string.
+// Weight defaults to 1; a weight of 0 keeps the address listed but never routed to.
+// Role ("primary" or "replica") is optional; addresses without a role serve both.
+type AddressSpec struct {
+	Address string `json:"address"`
+	Weight  *int   `json:"weight,omitempty"`
+	Role    string `json:"role,omitempty"`
+}
+
+func (a *AddressSpec) UnmarshalJSON(data []byte) error {
+	var addr string
+	if err := json.Unmarshal(data, &addr); err == nil {
+		*a = AddressSpec{Address: addr}
+		return nil
+	}
+	type plain AddressSpec
+	return json.Unmarshal(data, (*plain)(a))
+}
+
+// backend is a validated address.
+type backend struct {
+	addr   string
+	weight int
+	role   core.BackendRole // empty serves every role
+}
+
+// route is a validated catalog entry.
+type route struct {
+	deploymentID string
+	pooled       bool
+	backends     []backend
+	requireTLS   bool
+	allowed      []*net.IPNet // empty allows every client
+}
+
+// catalog is an immutable, validated set of routes keyed by
+// "deployment_id" or "deployment_id.pool".
+type catalog map[string]*route
+
+func routeKey(deploymentID string, pooled bool) string {
+	if pooled {
+		return deploymentID + ".pool"
+	}
+	return deploymentID
+}
+
+// parseCatalog decodes and validates a catalog file. The whole file is
+// rejected on the first invalid entry.
+func parseCatalog(data []byte) (catalog, error) {
+	var f File
+	if err := yaml.UnmarshalStrict(data, &f); err != nil {
+		return nil, fmt.Errorf("failed to parse routes: %w", err)
+	}
+
+	routes := make(catalog, len(f.Routes))
+	for i, spec := range f.Routes {
+		r, err := spec.validate()
+		if err != nil {
+			return nil, fmt.Errorf("route %d (%s): %w", i, spec.DeploymentID, err)
+		}
+		key := routeKey(r.deploymentID, r.pooled)
+		if _, ok := routes[key]; ok {
+			return nil, fmt.Errorf("route %d: duplicate route %s", i, key)
+		}
+		routes[key] = r
+	}
+	return routes, nil
+}
+
+func (s RouteSpec) validate() (*route, error) {
+	if s.DeploymentID == "" || strings.ContainsAny(s.DeploymentID, " ,=|/.") {
+		return nil, fmt.Errorf("invalid deployment_id %q", s.DeploymentID)
+	}
+	if len(s.Addresses) == 0 {
+		return nil, fmt.Errorf("no addresses")
+	}
+
+	r := &route{deploymentID: s.DeploymentID, pooled: s.Pooled}
+
+	switch strings.ToLower(s.TLSMode) {
+	case "", TLSModeAllow:
+	case TLSModeRequire:
+		r.requireTLS = true
+	default:
+		return nil, fmt.Errorf("unsupported tls_mode %q (supported: allow, require)", s.TLSMode)
+	}
+
+	routable := false
+	for _, a := range s.Addresses {
+		if _, _, err := net.SplitHostPort(a.Address); err != nil {
+			return nil, fmt.Errorf("invalid address %q: %v", a.Address, err)
+		}
+		b := backend{addr: a.Address, weight: 1}
+		if a.Weight != nil {
+			if *a.Weight < 0 {
+				return nil, fmt.Errorf("address %s: weight must not be negative", a.Address)
+			}
+			b.weight = *a.Weight
+		}
+		switch core.BackendRole(a.Role) {
+		case "", core.BackendRolePrimary, core.BackendRoleReplica:
+			b.role = core.BackendRole(a.Role)
+		default:
+			return nil, fmt.Errorf("address %s: unsupported role %q (supported: primary, replica)", a.Address, a.Role)
+		}
+		if b.weight > 0 {
+			routable = true
+		}
+		r.backends = append(r.backends, b)
+	}
+	if !routable {
+		return nil, fmt.Errorf("every address has weight 0")
+	}
+
+	for _, cidr := range s.AllowedCIDRs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowed_cidrs entry %q: %v", cidr, err)
+		}
+		r.allowed = append(r.allowed, network)
+	}
+	return r, nil
+}
+
+// allows reports whether a client at addr (host:port or IP) may use the route.
+func (r *route) allows(addr string) bool {
+	if len(r.allowed) == 0 {
+		return true
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, network := range r.allowed {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// candidates returns the healthy backends serving role in weighted order.
+func (r *route) candidates(role core.BackendRole, health core.BackendHealth) ([]string, error) {
+	var eligible []backend
+	for _, b := range r.backends {
+		if b.weight > 0 && (b.role == "" || b.role == role) {
+			eligible = append(eligible, b)
+		}
+	}
+	if len(eligible) == 0 {
+		return nil, fmt.Errorf("%w: no %s available", core.ErrBackendNotFound, role)
+	}
+
+	if health != nil {
+		healthy := eligible[:0:0]
+		for _, b := range eligible {
+			if health.IsHealthy(b.addr) {
+				healthy = append(healthy, b)
+			}
+		}
+		if len(healthy) == 0 {
+			return nil, fmt.Errorf("%w: every %s has an open circuit", core.ErrNoHealthyBackend, role)
+		}
+		eligible = healthy
+	}
+	return weightedOrder(eligible), nil
+}
@@ -0,0 +1,174 @@
+package file
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/core"
+)
+
+func TestParseCatalog(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+		check   func(t *testing.T, c catalog)
+	}{
+		{
+			name: "string and object addresses",
+			data: `
+routes:
+  - deployment_id: db1
+    addresses:
+      - 10.0.1.5:5432
+      - address: 10.0.1.6:5432
+        weight: 3
+        role: replica
+      - address: 10.0.1.7:5432
+        weight: 0
+  - deployment_id: db1
+    pooled: true
+    addresses: [10.0.2.5:6432]
+    tls_mode: REQUIRE
+    allowed_cidrs: [10.0.0.0/8, "fd00::/8"]
+`,
+			check: func(t *testing.T, c catalog) {
+				want := []backend{
+					{addr: "10.0.1.5:5432", weight: 1},
+					{addr: "10.0.1.6:5432", weight: 3, role: core.BackendRoleReplica},
+					{addr: "10.0.1.7:5432", weight: 0},
+				}
+				db1 := c["db1"]
+				if db1 == nil || len(db1.backends) != len(want) {
+					t.Fatalf("db1 = %+v", db1)
+				}
+				for i, b := range want {
+					if db1.backends[i] != b {
+						t.Errorf("backend %d = %+v, want %+v", i, db1.backends[i], b)
+					}
+				}
+				pool := c["db1.pool"]
+				if pool == nil || !pool.requireTLS || len(pool.allowed) != 2 {
+					t.Fatalf("db1.pool = %+v", pool)
+				}
+				if !pool.allows("10.1.2.3:40000") || pool.allows("192.168.1.1:40000") {
+					t.Error("allowed_cidrs not applied")
+				}
+			},
+		},
+		{
+			name: "JSON",
+			data: `{"routes": [{"deployment_id": "db2", "addresses": ["db2.internal:5432"]}]}`,
+			check: func(t *testing.T, c catalog) {
+				if len(c) != 1 || c["db2"] == nil || c["db2"].backends[0].addr != "db2.internal:5432" {
+					t.Errorf("catalog = %+v", c)
+				}
+			},
+		},
+		{
+			name:  "empty",
+			data:  "routes: []",
+			check: func(t *testing.T, c catalog) {},
+		},
+		{
+			name: "duplicate route",
+			data: `
+routes:
+  - {deployment_id: db1, addresses: [10.0.1.5:5432]}
+  - {deployment_id: db1, addresses: [10.0.1.6:5432]}
+`,
+			wantErr: "duplicate route db1",
+		},
+		{
+			name:    "duplicate key",
+			data:    "routes: []\nroutes: []\n",
+			wantErr: "failed to parse routes",
+		},
+		{
+			name:    "unknown field",
+			data:    "routes:\n  - {deployment_id: db1, adresses: [10.0.1.5:5432]}\n",
+			wantErr: "failed to parse routes",
+		},
+		{
+			name:    "dotted deployment_id",
+			data:    "routes:\n  - {deployment_id: db1.ro, addresses: [10.0.1.5:5432]}\n",
+			wantErr: "invalid deployment_id",
+		},
+		{
+			name:    "no addresses",
+			data:    "routes:\n  - {deployment_id: db1}\n",
+			wantErr: "no addresses",
+		},
+		{
+			name:    "address without port",
+			data:    "routes:\n  - {deployment_id: db1, addresses: [10.0.1.5]}\n",
+			wantErr: "invalid address",
+		},
+		{
+			name:    "negative weight",
+			data:    "routes:\n  - {deployment_id: db1, addresses: [{address: 10.0.1.5:5432, weight: -1}]}\n",
+			wantErr: "weight must not be negative",
+		},
+		{
+			name: "all weights 0",
+			data: `
+routes:
+  - deployment_id: db1
+    addresses:
+      - {address: 10.0.1.5:5432, weight: 0}
+      - {address: 10.0.1.6:5432, weight: 0}
+`,
+			wantErr: "every address has weight 0",
+		},
+		{
+			name:    "unknown role",
+			data:    "routes:\n  - {deployment_id: db1, addresses: [{address: 10.0.1.5:5432, role: standby}]}\n",
+			wantErr: `unsupported role "standby"`,
+		},
+		{
+			name:    "unknown tls_mode",
+			data:    "routes:\n  - {deployment_id: db1, addresses: [10.0.1.5:5432], tls_mode: verify-full}\n",
+			wantErr: "unsupported tls_mode",
+		},
+		{
+			name:    "invalid CIDR",
+			data:    "routes:\n  - {deployment_id: db1, addresses: [10.0.1.5:5432], allowed_cidrs: [10.0.0.0/33]}\n",
+			wantErr: "invalid allowed_cidrs entry",
+		},
+		{
+			name:    "bare IP instead of CIDR",
+			data:    "routes:\n  - {deployment_id: db1, addresses: [10.0.1.5:5432], allowed_cidrs: [10.0.0.1]}\n",
+			wantErr: "invalid allowed_cidrs entry",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := parseCatalog([]byte(tt.data))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.check(t, c)
+		})
+	}
+}
+
+func TestWeightedOrder(t *testing.T) {
+	backends := []backend{{addr: "a:1", weight: 1}, {addr: "b:1", weight: 9}}
+	first := make(map[string]int)
+	for range 1000 {
+		order := weightedOrder(backends)
+		if len(order) != 2 || order[0] == order[1] {
+			t.Fatalf("order = %v", order)
+		}
+		first[order[0]]++
+	}
+	if first["b:1"] < 800 {
+		t.Errorf("heavier backend first in %d of 1000 picks, want about 900", first["b:1"])
+	}
+}
@@ -0,0 +1,237 @@
+package file
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/core"
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/logger"
+)
+
+var log = logger.Component(logger.ComponentResolver)
+
+// reloadDelay coalesces the burst of events an editor or a ConfigMap update produces.
+const reloadDelay = 200 * time.Millisecond
+
+// Resolver routes deployments from a YAML/JSON route catalog file.
+// The catalog is swapped atomically on reload; a file that fails to parse or
+// validate is rejected and the last good catalog stays in use.
+type Resolver struct {
+	path    string
+	catalog atomic.Pointer[catalog]
+
+	// health, when set, is used to skip backends with an open circuit
+	health core.BackendHealth
+	mu     sync.RWMutex
+}
+
+// NewResolver loads the catalog at path. It fails when the initial file is invalid.
+func NewResolver(path string) (*Resolver, error) {
+	r := &Resolver{path: path}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// SetHealth makes the resolver skip backends reported unhealthy. A
+// core.BackendTracker probes the catalog's backends, also after reloads.
+func (r *Resolver) SetHealth(health core.BackendHealth) {
+	r.mu.Lock()
+	r.health = health
+	r.mu.Unlock()
+	r.track()
+}
+
+// track passes the catalog's backends to the health tracker.
+func (r *Resolver) track() {
+	r.mu.RLock()
+	tracker, ok := r.health.(core.BackendTracker)
+	r.mu.RUnlock()
+	if ok {
+		tracker.Track(r.Addresses()...)
+	}
+}
+
+// Reload re-reads the catalog file. On error the current catalog is kept.
+func (r *Resolver) Reload() error {
+	data, err := os.ReadFile(r.path)
+	if err != nil {
+		return fmt.Errorf("failed to read route catalog: %w", err)
+	}
+	routes, err := parseCatalog(data)
+	if err != nil {
+		return fmt.Errorf("route catalog %s: %w", r.path, err)
+	}
+	r.catalog.Store(&routes)
+	r.track()
+	log.Info("Loaded route catalog", "path", r.path, "routes", len(routes))
+	return nil
+}
+
+// Watch reloads the catalog whenever its file changes, until ctx is done.
+// The parent directory is watched so that editors replacing the file and
+// Kubernetes ConfigMap symlink swaps are picked up as well.
+func (r *Resolver) Watch(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create route catalog watcher: %w", err)
+	}
+	dir := filepath.Dir(r.path)
+	if err := watcher.Add(dir); err != nil {
+		watcher.Close()
+		return fmt.Errorf("failed to watch %s: %w", dir, err)
+	}
+
+	go func() {
+		defer watcher.Close()
+		var pending <-chan time.Time
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if r.affects(event) {
+					pending = time.After(reloadDelay)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Warn("Route catalog watcher error", "error", err)
+			case <-pending:
+				pending = nil
+				if err := r.Reload(); err != nil {
+					log.Error("Rejected route catalog, keeping the last good version", "error", err)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// affects reports whether event may have changed the catalog file.
+func (r *Resolver) affects(event fsnotify.Event) bool {
+	if event.Op == fsnotify.Chmod {
+		return false
+	}
+	name := filepath.Clean(event.Name)
+	// ConfigMap volumes swap the "..data" symlink the file points through
+	return name == filepath.Clean(r.path) || filepath.Base(name) == "..data"
+}
+
+// Addresses returns every backend address in the catalog.
+func (r *Resolver) Addresses() []string {
+	var addrs []string
+	for _, rt := range *r.catalog.Load() {
+		for _, b := range rt.backends {
+			addrs = append(addrs, b.addr)
+		}
+	}
+	return addrs
+}
+
+// Routes implements core.RouteLister.
+func (r *Resolver) Routes() []core.Route {
+	current := *r.catalog.Load()
+	routes := make([]core.Route, 0, len(current))
+	for _, rt := range current {
+		route := core.Route{
+			DeploymentID: rt.deploymentID,
+			Pooled:       rt.pooled,
+			Source:       "file",
+		}
+		for _, b := range rt.backends {
+			route.Addresses = append(route.Addresses, b.addr)
+		}
+		routes = append(routes, route)
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].DeploymentID != routes[j].DeploymentID {
+			return routes[i].DeploymentID < routes[j].DeploymentID
+		}
+		return !routes[i].Pooled && routes[j].Pooled
+	})
+	return routes
+}
+
+func (r *Resolver) Resolve(ctx context.Context, metadata core.RoutingMetadata, databaseType core.DatabaseType) ([]string, error) {
+	deploymentID, ok := metadata["deployment_id"]
+	if !ok {
+		return nil, core.ErrMissingDeploymentID
+	}
+	key := routeKey(deploymentID, metadata["pooled"] == "true")
+	role := metadata.RequestedRole()
+
+	rt, ok := (*r.catalog.Load())[key]
+	if !ok {
+		return nil, fmt.Errorf("%w for key: %s", core.ErrBackendNotFound, key)
+	}
+
+	if rt.requireTLS && metadata["tls"] != "true" {
+		return nil, fmt.Errorf("%w: %s requires TLS", core.ErrAccessDenied, key)
+	}
+	if !rt.allows(metadata["client_addr"]) {
+		return nil, fmt.Errorf("%w: client %s is not allowed to use %s", core.ErrAccessDenied, metadata["client_addr"], key)
+	}
+
+	r.mu.RLock()
+	health := r.health
+	r.mu.RUnlock()
+
+	candidates, err := rt.candidates(role, health)
+	if metadata.PrefersReplica() {
+		// Primaries follow the replicas; backends serving every role are already listed
+		primaries, primaryErr := rt.candidates(core.BackendRolePrimary, health)
+		if err != nil {
+			candidates, err = primaries, primaryErr
+		} else {
+			for _, addr := range primaries {
+				if !slices.Contains(candidates, addr) {
+					candidates = append(candidates, addr)
+				}
+			}
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", key, err)
+	}
+
+	log.Debug("Routing to catalog backend", "deployment_id", deploymentID, "pooled", rt.pooled, "role", role, "candidates", candidates)
+	return candidates, nil
+}
+
+// weightedOrder returns the addresses in a random order where each pick is
+// proportional to its weight, so heavier backends are dialed first more often.
+func weightedOrder(backends []backend) []string {
+	remaining := append([]backend(nil), backends...)
+	total := 0
+	for _, b := range remaining {
+		total += b.weight
+	}
+
+	order := make([]string, 0, len(remaining))
+	for len(remaining) > 0 {
+		n := rand.IntN(total)
+		i := 0
+		for ; n >= remaining[i].weight; i++ {
+			n -= remaining[i].weight
+		}
+		order = append(order, remaining[i].addr)
+		total -= remaining[i].weight
+		remaining = append(remaining[:i], remaining[i+1:]...)
+	}
+	return order
+}
@@ -0,0 +1,69 @@
+package file
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/core"
+)
+
+func TestReloadKeepsLastGoodCatalog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "routes.yaml")
+	write := func(data string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	resolve := func(r *Resolver) ([]string, error) {
+		return r.Resolve(context.Background(), core.RoutingMetadata{"deployment_id": "db1"}, core.DatabaseTypePostgresql)
+	}
+
+	write("routes:\n  - {deployment_id: db1, addresses: [10.0.1.5:5432]}\n")
+	r, err := NewResolver(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, bad := range []string{
+		"routes:\n  - {deployment_id: db1, addresses: [{address: 10.0.1.6:5432, weight: 0}]}\n",
+		"routes: [",
+	} {
+		write(bad)
+		if err := r.Reload(); err == nil {
+			t.Fatalf("Reload accepted %q", bad)
+		}
+		addrs, err := resolve(r)
+		if err != nil || len(addrs) != 1 || addrs[0] != "10.0.1.5:5432" {
+			t.Fatalf("after rejected reload: Resolve = %v, %v; want the previous catalog", addrs, err)
+		}
+	}
+
+	os.Remove(path)
+	if err := r.Reload(); err == nil {
+		t.Fatal("Reload of a missing file succeeded")
+	}
+	if addrs, err := resolve(r); err != nil || addrs[0] != "10.0.1.5:5432" {
+		t.Fatalf("after missing file: Resolve = %v, %v", addrs, err)
+	}
+
+	write("routes:\n  - {deployment_id: db1, addresses: [10.0.1.7:5432]}\n")
+	if err := r.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if addrs, err := resolve(r); err != nil || addrs[0] != "10.0.1.7:5432" {
+		t.Errorf("after good reload: Resolve = %v, %v", addrs, err)
+	}
+}
+
+func TestNewResolverRejectsInvalidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "routes.yaml")
+	if err := os.WriteFile(path, []byte("routes:\n  - {deployment_id: db1}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewResolver(path); err == nil {
+		t.Error("NewResolver accepted an invalid catalog")
+	}
+}
@@ -0,0 +1,137 @@
+package kubernetes
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/logger"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+var tlsLog = logger.Component(logger.ComponentTLS)
+
+// Lease timings, the client-go defaults used by Kubernetes controllers.
+const (
+	leaseDuration      = 15 * time.Second
+	leaseRenewDeadline = 10 * time.Second
+	leaseRetryPeriod   = 2 * time.Second
+)
+
+// LeaderElection elects, through a Lease, the one replica that generates and
+// renews the certificate of a shared TLS Secret.
+type LeaderElection struct {
+	clientset *kubernetes.Clientset
+	namespace string
+	name      string
+	identity  string
+
+	leading atomic.Bool
+	changed chan struct{}
+}
+
+// NewLeaderElection returns an election on the Lease namespace/name. The
+// replica is identified by its hostname, the pod name in Kubernetes.
+func NewLeaderElection(clientset *kubernetes.Clientset, namespace, name string) *LeaderElection {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "xdatabase-proxy"
+	}
+	// A suffix keeps a restarted pod from taking over its predecessor's lease record
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return &LeaderElection{
+		clientset: clientset,
+		namespace: namespace,
+		name:      name,
+		identity:  hostname + "_" + hex.EncodeToString(suffix),
+		changed:   make(chan struct{}, 1),
+	}
+}
+
+// Run takes part in the election until ctx is done and then releases the
+// Lease if it holds it. A replica that loses the lead stands again. It fails
+// when the Lease cannot be read, e.g. for lack of RBAC permissions, since
+// client-go would otherwise only retry and log through klog.
+func (e *LeaderElection) Run(ctx context.Context) error {
+	_, err := e.clientset.CoordinationV1().Leases(e.namespace).Get(ctx, e.name, metav1.GetOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("failed to read lease %s/%s: %w", e.namespace, e.name, err)
+	}
+
+	cfg := leaderelection.LeaderElectionConfig{
+		Lock: &resourcelock.LeaseLock{
+			LeaseMeta:  metav1.ObjectMeta{Namespace: e.namespace, Name: e.name},
+			Client:     e.clientset.CoordinationV1(),
+			LockConfig: resourcelock.ResourceLockConfig{Identity: e.identity},
+		},
+		LeaseDuration:   leaseDuration,
+		RenewDeadline:   leaseRenewDeadline,
+		RetryPeriod:     leaseRetryPeriod,
+		ReleaseOnCancel: true,
+		Name:            e.name,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(context.Context) {
+				tlsLog.Info("Leading TLS certificate generation", "lease", e.namespace+"/"+e.name, "identity", e.identity)
+				e.setLeading(true)
+			},
+			// Also called when Run returns without ever leading
+			OnStoppedLeading: func() {
+				if e.leading.Load() {
+					tlsLog.Info("Stopped leading TLS certificate generation", "lease", e.namespace+"/"+e.name)
+					e.setLeading(false)
+				}
+			},
+			OnNewLeader: func(identity string) {
+				if identity != e.identity {
+					tlsLog.Info("TLS certificate leader elected", "lease", e.namespace+"/"+e.name, "leader", identity)
+				}
+			},
+		},
+	}
+	elector, err := leaderelection.NewLeaderElector(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to set up leader election on lease %s/%s: %w", e.namespace, e.name, err)
+	}
+
+	go func() {
+		for {
+			// Returns when the lead is lost or ctx is done
+			elector.Run(ctx)
+			if ctx.Err() != nil {
+				return
+			}
+			if elector, err = leaderelection.NewLeaderElector(cfg); err != nil {
+				tlsLog.Error("Leader election stopped", "lease", e.namespace+"/"+e.name, "error", err)
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// IsLeader reports whether this replica holds the Lease.
+func (e *LeaderElection) IsLeader() bool {
+	return e.leading.Load()
+}
+
+// LeaderChanged receives a value when this replica gains or loses the lead.
+func (e *LeaderElection) LeaderChanged() <-chan struct{} {
+	return e.changed
+}
+
+func (e *LeaderElection) setLeading(leading bool) {
+	e.leading.Store(leading)
+	select {
+	case e.changed <- struct{}{}:
+	default:
+	}
+}
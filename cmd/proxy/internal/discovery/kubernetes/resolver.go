@@ -3,22 +3,52 @@ package kubernetes
 import (
 	"context"
 	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/core"
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/logger"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
+	listerscorev1 "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/tools/cache"
 )
 
+var log = logger.Component(logger.ComponentResolver)
+
+// roleLabels are the pod/service labels used by cluster managers to publish
+// the replication role, checked in order.
+//   - xdatabase-proxy-role: explicit override on a Service
+//   - cnpg.io/instanceRole: CloudNativePG
+//   - role: Patroni (master/replica), legacy CloudNativePG
+//   - spilo-role: Zalando postgres-operator (Patroni/Spilo)
+var roleLabels = []string{"xdatabase-proxy-role", "cnpg.io/instanceRole", "role", "spilo-role"}
+
 type K8sResolver struct {
 	store cache.Store
+	pods  listerscorev1.PodLister
+	next  atomic.Uint64
+
+	// health, when set, is used to skip backends with an open circuit
+	health core.BackendHealth
+
+	// scaler, when set, wakes scaled-to-zero workloads on first connection
+	scaler *Scaler
+
+	stopCh   chan struct{}
+	stopOnce sync.Once
 }
 
 func NewK8sResolver(clientset *kubernetes.Clientset) *K8sResolver {
 	factory := informers.NewSharedInformerFactory(clientset, 10*time.Minute)
 	serviceInformer := factory.Core().V1().Services().Informer()
+	podInformer := factory.Core().V1().Pods()
+	podInformer.Informer()
 
 	// Start the informer in the background
 	stopCh := make(chan struct{})
@@ -26,16 +56,60 @@ func NewK8sResolver(clientset *kubernetes.Clientset) *K8sResolver {
 	factory.WaitForCacheSync(stopCh)
 
 	return &K8sResolver{
-		store: serviceInformer.GetStore(),
+		store:  serviceInformer.GetStore(),
+		pods:   podInformer.Lister(),
+		stopCh: stopCh,
+	}
+}
+
+// Stop shuts down the resolver's informers, e.g. when it is replaced on reload.
+func (r *K8sResolver) Stop() {
+	r.stopOnce.Do(func() { close(r.stopCh) })
+}
+
+// SetHealth makes the resolver skip backends reported unhealthy.
+// It must be called before the resolver starts serving lookups.
+func (r *K8sResolver) SetHealth(health core.BackendHealth) {
+	r.health = health
+}
+
+// SetScaler enables scale-to-zero wake-up for Services labeled xdatabase-proxy-scale-to-zero=true.
+// It must be called before the resolver starts serving lookups.
+func (r *K8sResolver) SetScaler(scaler *Scaler) {
+	r.scaler = scaler
+}
+
+// ConnectionOpened implements core.ConnectionObserver for idle tracking.
+func (r *K8sResolver) ConnectionOpened(metadata core.RoutingMetadata, backendAddr string) {
+	if r.scaler != nil {
+		r.scaler.ConnectionOpened(metadata, backendAddr)
+	}
+}
+
+// ConnectionClosed implements core.ConnectionObserver for idle tracking.
+func (r *K8sResolver) ConnectionClosed(metadata core.RoutingMetadata, backendAddr string) {
+	if r.scaler != nil {
+		r.scaler.ConnectionClosed(metadata, backendAddr)
 	}
 }
 
-func (r *K8sResolver) Resolve(ctx context.Context, metadata core.RoutingMetadata, databaseType core.DatabaseType) (string, error) {
+func (r *K8sResolver) Resolve(ctx context.Context, metadata core.RoutingMetadata, databaseType core.DatabaseType) ([]string, error) {
 	deploymentID, ok := metadata["deployment_id"]
 	if !ok {
-		return "", fmt.Errorf("metadata missing 'deployment_id' (check connection string format: user.deployment_id[.pool])")
+		return nil, fmt.Errorf("%w (check connection string format: user.deployment_id[.pool])", core.ErrMissingDeploymentID)
 	}
 	pooled := metadata["pooled"] // "true" or "false"
+	role := metadata.RequestedRole()
+	preferReplica := metadata.PrefersReplica()
+
+	// A role-agnostic service (no role labels on it or its pods) is only
+	// suitable for primary traffic, and is tried after role-aware matches.
+	// With prefer-standby the primaries follow the replicas.
+	var candidates, primaries, fallbacks []string
+
+	// A matching scale-to-zero service without ready pods is woken up
+	// when nothing else can serve the connection.
+	var sleeping *corev1.Service
 
 	// Scan services for matching labels
 	for _, obj := range r.store.List() {
@@ -76,9 +150,190 @@ func (r *K8sResolver) Resolve(ctx context.Context, metadata core.RoutingMetadata
 				continue
 			}
 
-			return fmt.Sprintf("%s.%s.svc.cluster.local:%d", svc.Name, svc.Namespace, port), nil
+			serviceAddr := fmt.Sprintf("%s.%s.svc.cluster.local:%d", svc.Name, svc.Namespace, port)
+
+			if r.scaler != nil && labels[scaleToZeroLabel] == "true" {
+				if !r.hasReadyPods(svc) {
+					if sleeping == nil {
+						sleeping = svc
+					}
+					continue
+				}
+				r.scaler.Observe(ctx, svc, metadata)
+			}
+
+			// Role-specific service (e.g. CloudNativePG -rw/-ro, Zalando -repl)
+			if svcRole, ok := roleFromLabels(labels); ok {
+				if !r.isHealthy(serviceAddr) {
+					continue
+				}
+				if svcRole == role {
+					candidates = append(candidates, serviceAddr)
+				} else if preferReplica && svcRole == core.BackendRolePrimary {
+					primaries = append(primaries, serviceAddr)
+				}
+				continue
+			}
+
+			// Role-agnostic service: route straight to the pods holding the role
+			if addrs, managed := r.podsForRole(svc, role); managed {
+				candidates = append(candidates, addrs...)
+				if preferReplica {
+					addrs, _ = r.podsForRole(svc, core.BackendRolePrimary)
+					primaries = append(primaries, addrs...)
+				}
+				continue
+			}
+
+			if (role == core.BackendRolePrimary || preferReplica) && r.isHealthy(serviceAddr) {
+				fallbacks = append(fallbacks, serviceAddr)
+			}
+		}
+	}
+
+	candidates = append(append(candidates, primaries...), fallbacks...)
+	if len(candidates) > 0 {
+		return candidates, nil
+	}
+
+	if sleeping != nil {
+		return nil, r.scaler.Wake(ctx, sleeping, metadata)
+	}
+
+	return nil, fmt.Errorf("%w: service not found for deployment_id='%s', pooled='%s', role='%s'", core.ErrBackendNotFound, deploymentID, pooled, role)
+}
+
+// Routes implements core.RouteLister with the proxy-enabled services.
+func (r *K8sResolver) Routes() []core.Route {
+	var routes []core.Route
+	for _, obj := range r.store.List() {
+		svc, ok := obj.(*corev1.Service)
+		if !ok || svc.Labels["xdatabase-proxy-enabled"] != "true" || len(svc.Spec.Ports) == 0 {
+			continue
+		}
+		route := core.Route{
+			DeploymentID: svc.Labels["xdatabase-proxy-deployment-id"],
+			Pooled:       svc.Labels["xdatabase-proxy-pooled"] == "true",
+			Addresses:    []string{fmt.Sprintf("%s.%s.svc.cluster.local:%d", svc.Name, svc.Namespace, svc.Spec.Ports[0].Port)},
+			Source:       "service/" + svc.Namespace + "/" + svc.Name,
+		}
+		if role, ok := roleFromLabels(svc.Labels); ok {
+			route.Role = string(role)
+		}
+		routes = append(routes, route)
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].DeploymentID != routes[j].DeploymentID {
+			return routes[i].DeploymentID < routes[j].DeploymentID
+		}
+		return routes[i].Source < routes[j].Source
+	})
+	return routes
+}
+
+// podsForRole returns the ready pods selected by svc that hold role. managed
+// reports whether any selected pod carries a role label at all.
+func (r *K8sResolver) podsForRole(svc *corev1.Service, role core.BackendRole) (addrs []string, managed bool) {
+	if len(svc.Spec.Selector) == 0 || len(svc.Spec.Ports) == 0 {
+		return nil, false
+	}
+
+	pods, err := r.pods.Pods(svc.Namespace).List(labels.SelectorFromSet(svc.Spec.Selector))
+	if err != nil {
+		return nil, false
+	}
+
+	var candidates []string
+	for _, pod := range pods {
+		podRole, ok := roleFromLabels(pod.Labels)
+		if !ok {
+			continue
+		}
+		managed = true
+		if podRole != role || !isPodReady(pod) {
+			continue
+		}
+		port := targetPort(svc.Spec.Ports[0], pod)
+		if port == 0 {
+			continue
+		}
+		addr := fmt.Sprintf("%s:%d", pod.Status.PodIP, port)
+		if !r.isHealthy(addr) {
+			continue
+		}
+		candidates = append(candidates, addr)
+	}
+
+	if role == core.BackendRoleReplica && len(candidates) > 1 {
+		start := int(r.next.Add(1) % uint64(len(candidates)))
+		rotated := make([]string, 0, len(candidates))
+		rotated = append(rotated, candidates[start:]...)
+		candidates = append(rotated, candidates[:start]...)
+	}
+	return candidates, managed
+}
+
+// hasReadyPods reports whether any pod selected by svc is ready.
+// Services without a selector are assumed to be served.
+func (r *K8sResolver) hasReadyPods(svc *corev1.Service) bool {
+	if len(svc.Spec.Selector) == 0 {
+		return true
+	}
+	pods, err := r.pods.Pods(svc.Namespace).List(labels.SelectorFromSet(svc.Spec.Selector))
+	if err != nil {
+		return true
+	}
+	for _, pod := range pods {
+		if isPodReady(pod) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *K8sResolver) isHealthy(addr string) bool {
+	return r.health == nil || r.health.IsHealthy(addr)
+}
+
+func roleFromLabels(labels map[string]string) (core.BackendRole, bool) {
+	for _, key := range roleLabels {
+		switch labels[key] {
+		case "primary", "master":
+			return core.BackendRolePrimary, true
+		case "replica", "standby":
+			return core.BackendRoleReplica, true
 		}
 	}
+	return "", false
+}
 
-	return "", fmt.Errorf("service not found for deployment_id='%s', pooled='%s'", deploymentID, pooled)
+func isPodReady(pod *corev1.Pod) bool {
+	if pod.Status.PodIP == "" || pod.DeletionTimestamp != nil {
+		return false
+	}
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == corev1.PodReady {
+			return cond.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// targetPort resolves the service port's targetPort (numeric or named) against the pod.
+func targetPort(svcPort corev1.ServicePort, pod *corev1.Pod) int32 {
+	switch {
+	case svcPort.TargetPort.Type == intstr.String:
+		for _, c := range pod.Spec.Containers {
+			for _, p := range c.Ports {
+				if p.Name == svcPort.TargetPort.StrVal {
+					return p.ContainerPort
+				}
+			}
+		}
+		return 0
+	case svcPort.TargetPort.IntVal != 0:
+		return svcPort.TargetPort.IntVal
+	default:
+		return svcPort.Port
+	}
 }
@@ -0,0 +1,344 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/core"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// scaleToZeroLabel marks a Service whose workload may be scaled to zero.
+	scaleToZeroLabel = "xdatabase-proxy-scale-to-zero"
+	// scaleTargetAnnotation names the workload behind the Service ("statefulset/<name>" or
+	// "deployment/<name>"). Without it the workload is found through the Service selector.
+	scaleTargetAnnotation = "xdatabase-proxy-scale-target"
+	// lastActivityAnnotation is written on the workload by every proxy instance that has
+	// active connections, so idle scale-down is safe with several proxy replicas.
+	lastActivityAnnotation = "xdatabase-proxy-last-activity"
+
+	// ScaleTickInterval is how often activity is published and idle workloads
+	// are checked, and so the shortest usable idle timeout.
+	ScaleTickInterval = time.Minute
+)
+
+type workload struct {
+	namespace string
+	kind      string // "statefulset" or "deployment"
+	name      string
+}
+
+func (w workload) String() string {
+	return w.namespace + "/" + w.kind + "/" + w.name
+}
+
+type workloadState struct {
+	workload     workload
+	active       int
+	lastActivity time.Time
+	wokenAt      time.Time
+}
+
+// Scaler starts scaled-to-zero workloads on the first connection and scales
+// them back down once no proxy instance has seen a connection for IdleTimeout.
+type Scaler struct {
+	clientset   *kubernetes.Clientset
+	wakeTimeout time.Duration
+	idleTimeout time.Duration
+
+	targets   map[string]workload       // service namespace/name -> workload
+	routes    map[string]string         // routing key -> workload key
+	workloads map[string]*workloadState // workload key -> state
+	mu        sync.Mutex
+}
+
+func NewScaler(clientset *kubernetes.Clientset, wakeTimeout, idleTimeout time.Duration) *Scaler {
+	return &Scaler{
+		clientset:   clientset,
+		wakeTimeout: wakeTimeout,
+		idleTimeout: idleTimeout,
+		targets:     make(map[string]workload),
+		routes:      make(map[string]string),
+		workloads:   make(map[string]*workloadState),
+	}
+}
+
+// Start runs the activity heartbeat and idle scale-down loop until ctx is cancelled.
+func (s *Scaler) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(ScaleTickInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.tick(ctx)
+			}
+		}
+	}()
+}
+
+// Wake scales the workload behind svc to one replica (once per wake timeout)
+// and returns the error that tells the proxy to hold the client.
+func (s *Scaler) Wake(ctx context.Context, svc *corev1.Service, metadata core.RoutingMetadata) error {
+	w, err := s.workloadFor(ctx, svc)
+	if err != nil {
+		return fmt.Errorf("scale-to-zero service %s/%s: %w", svc.Namespace, svc.Name, err)
+	}
+
+	s.mu.Lock()
+	state := s.track(w, metadata)
+	alreadyWaking := time.Since(state.wokenAt) < s.wakeTimeout
+	if !alreadyWaking {
+		state.wokenAt = time.Now()
+	}
+	state.lastActivity = time.Now()
+	s.mu.Unlock()
+
+	if !alreadyWaking {
+		if err := s.wake(ctx, w); err != nil {
+			s.mu.Lock()
+			state.wokenAt = time.Time{}
+			s.mu.Unlock()
+			return fmt.Errorf("failed to wake %s: %w", w, err)
+		}
+	}
+
+	return &core.WakingError{Target: w.String(), Timeout: s.wakeTimeout}
+}
+
+// wake scales w to one replica if it is at zero. A workload that already has
+// replicas is only starting up (or was scaled by someone else) and is left alone.
+func (s *Scaler) wake(ctx context.Context, w workload) error {
+	_, replicas, err := s.get(ctx, w)
+	if err != nil {
+		return err
+	}
+	if replicas > 0 {
+		log.Debug("Workload is already starting", "workload", w.String(), "replicas", replicas)
+		return nil
+	}
+	log.Info("Waking scaled-to-zero workload", "workload", w.String())
+	return s.scale(ctx, w, 1)
+}
+
+// Observe records that metadata routes to the scale-to-zero service svc.
+func (s *Scaler) Observe(ctx context.Context, svc *corev1.Service, metadata core.RoutingMetadata) {
+	w, err := s.workloadFor(ctx, svc)
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	s.track(w, metadata).lastActivity = time.Now()
+	s.mu.Unlock()
+}
+
+// ConnectionOpened implements core.ConnectionObserver.
+func (s *Scaler) ConnectionOpened(metadata core.RoutingMetadata, backendAddr string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if state, ok := s.workloads[s.routes[routeKey(metadata)]]; ok {
+		state.active++
+		state.lastActivity = time.Now()
+	}
+}
+
+// ConnectionClosed implements core.ConnectionObserver.
+func (s *Scaler) ConnectionClosed(metadata core.RoutingMetadata, backendAddr string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if state, ok := s.workloads[s.routes[routeKey(metadata)]]; ok {
+		if state.active > 0 {
+			state.active--
+		}
+		state.lastActivity = time.Now()
+	}
+}
+
+// track returns the state for w and maps metadata's route to it. Caller holds s.mu.
+func (s *Scaler) track(w workload, metadata core.RoutingMetadata) *workloadState {
+	key := w.String()
+	state, ok := s.workloads[key]
+	if !ok {
+		state = &workloadState{workload: w}
+		s.workloads[key] = state
+	}
+	s.routes[routeKey(metadata)] = key
+	return state
+}
+
+func (s *Scaler) tick(ctx context.Context) {
+	type pending struct {
+		workload     workload
+		busy         bool
+		lastActivity time.Time
+	}
+
+	s.mu.Lock()
+	var states []pending
+	for _, state := range s.workloads {
+		states = append(states, pending{
+			workload:     state.workload,
+			busy:         state.active > 0,
+			lastActivity: state.lastActivity,
+		})
+	}
+	s.mu.Unlock()
+
+	for _, st := range states {
+		// Heartbeat: publish local activity for the other proxy replicas
+		if st.busy || time.Since(st.lastActivity) < ScaleTickInterval {
+			if err := s.annotateActivity(ctx, st.workload, time.Now()); err != nil {
+				log.Warn("Failed to record workload activity", "workload", st.workload.String(), "error", err)
+			}
+			continue
+		}
+		s.scaleDownIfIdle(ctx, st.workload)
+	}
+}
+
+func (s *Scaler) scaleDownIfIdle(ctx context.Context, w workload) {
+	meta, replicas, err := s.get(ctx, w)
+	if err != nil {
+		log.Warn("Failed to read workload", "workload", w.String(), "error", err)
+		return
+	}
+	if replicas == 0 {
+		return
+	}
+
+	// Without a readable annotation the idle time is unknown; start counting now
+	lastActivity, err := time.Parse(time.RFC3339, meta.Annotations[lastActivityAnnotation])
+	if err != nil {
+		if err := s.annotateActivity(ctx, w, time.Now()); err != nil {
+			log.Warn("Failed to record workload activity", "workload", w.String(), "error", err)
+		}
+		return
+	}
+	if time.Since(lastActivity) < s.idleTimeout {
+		return
+	}
+
+	log.Info("Scaling idle workload to zero", "workload", w.String(), "last_activity", lastActivity)
+	if err := s.scale(ctx, w, 0); err != nil {
+		log.Warn("Failed to scale workload to zero", "workload", w.String(), "error", err)
+	}
+}
+
+// workloadFor finds the StatefulSet or Deployment behind svc.
+func (s *Scaler) workloadFor(ctx context.Context, svc *corev1.Service) (workload, error) {
+	svcKey := svc.Namespace + "/" + svc.Name
+	s.mu.Lock()
+	w, ok := s.targets[svcKey]
+	s.mu.Unlock()
+	if ok {
+		return w, nil
+	}
+
+	if target := svc.Annotations[scaleTargetAnnotation]; target != "" {
+		kind, name, found := strings.Cut(target, "/")
+		kind = strings.ToLower(kind)
+		if !found || name == "" || (kind != "statefulset" && kind != "deployment") {
+			return workload{}, fmt.Errorf("invalid %s annotation %q (expected statefulset/<name> or deployment/<name>)", scaleTargetAnnotation, target)
+		}
+		w = workload{namespace: svc.Namespace, kind: kind, name: name}
+	} else {
+		found, err := s.findBySelector(ctx, svc)
+		if err != nil {
+			return workload{}, err
+		}
+		w = found
+	}
+
+	s.mu.Lock()
+	s.targets[svcKey] = w
+	s.mu.Unlock()
+	return w, nil
+}
+
+func (s *Scaler) findBySelector(ctx context.Context, svc *corev1.Service) (workload, error) {
+	if len(svc.Spec.Selector) == 0 {
+		return workload{}, fmt.Errorf("service has no selector and no %s annotation", scaleTargetAnnotation)
+	}
+	selector := labels.SelectorFromSet(svc.Spec.Selector)
+
+	statefulSets, err := s.clientset.AppsV1().StatefulSets(svc.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return workload{}, fmt.Errorf("failed to list statefulsets: %w", err)
+	}
+	for _, sts := range statefulSets.Items {
+		if selector.Matches(labels.Set(sts.Spec.Template.Labels)) {
+			return workload{namespace: svc.Namespace, kind: "statefulset", name: sts.Name}, nil
+		}
+	}
+
+	deployments, err := s.clientset.AppsV1().Deployments(svc.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return workload{}, fmt.Errorf("failed to list deployments: %w", err)
+	}
+	for _, deploy := range deployments.Items {
+		if selector.Matches(labels.Set(deploy.Spec.Template.Labels)) {
+			return workload{namespace: svc.Namespace, kind: "deployment", name: deploy.Name}, nil
+		}
+	}
+
+	return workload{}, fmt.Errorf("no statefulset or deployment matches the service selector")
+}
+
+func (s *Scaler) get(ctx context.Context, w workload) (metav1.ObjectMeta, int32, error) {
+	var meta metav1.ObjectMeta
+	var replicas *int32
+	switch w.kind {
+	case "statefulset":
+		sts, err := s.clientset.AppsV1().StatefulSets(w.namespace).Get(ctx, w.name, metav1.GetOptions{})
+		if err != nil {
+			return meta, 0, err
+		}
+		meta, replicas = sts.ObjectMeta, sts.Spec.Replicas
+	default:
+		deploy, err := s.clientset.AppsV1().Deployments(w.namespace).Get(ctx, w.name, metav1.GetOptions{})
+		if err != nil {
+			return meta, 0, err
+		}
+		meta, replicas = deploy.ObjectMeta, deploy.Spec.Replicas
+	}
+	if replicas == nil {
+		return meta, 1, nil
+	}
+	return meta, *replicas, nil
+}
+
+func (s *Scaler) scale(ctx context.Context, w workload, replicas int32) error {
+	patch := fmt.Sprintf(`{"metadata":{"annotations":{%q:%q}},"spec":{"replicas":%d}}`,
+		lastActivityAnnotation, time.Now().UTC().Format(time.RFC3339), replicas)
+	return s.patch(ctx, w, []byte(patch))
+}
+
+func (s *Scaler) annotateActivity(ctx context.Context, w workload, at time.Time) error {
+	patch := fmt.Sprintf(`{"metadata":{"annotations":{%q:%q}}}`, lastActivityAnnotation, at.UTC().Format(time.RFC3339))
+	return s.patch(ctx, w, []byte(patch))
+}
+
+func (s *Scaler) patch(ctx context.Context, w workload, patch []byte) error {
+	var err error
+	switch w.kind {
+	case "statefulset":
+		_, err = s.clientset.AppsV1().StatefulSets(w.namespace).Patch(ctx, w.name, types.MergePatchType, patch, metav1.PatchOptions{})
+	default:
+		_, err = s.clientset.AppsV1().Deployments(w.namespace).Patch(ctx, w.name, types.MergePatchType, patch, metav1.PatchOptions{})
+	}
+	return err
+}
+
+func routeKey(metadata core.RoutingMetadata) string {
+	return metadata["deployment_id"] + "|" + metadata["pooled"]
+}
@@ -0,0 +1,302 @@
+package kubernetes
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// tlsSecretAnnotation names the Secret, in the Service's namespace, whose
+	// certificate is served to clients asking for one of its DNS names.
+	tlsSecretAnnotation = "xdatabase-proxy-tls-secret"
+
+	// deploymentIDLabel is the deployment a Service routes to.
+	deploymentIDLabel = "xdatabase-proxy-deployment-id"
+
+	// sniReloadDelay coalesces a burst of Service and Secret changes into one reload.
+	sniReloadDelay = 200 * time.Millisecond
+
+	// sniSyncTimeout bounds the initial read of a referenced Secret.
+	sniSyncTimeout = 10 * time.Second
+
+	// sniRetryInterval retries Secrets that could not be watched.
+	sniRetryInterval = time.Minute
+)
+
+// SNISecrets serves the certificates of Secrets referenced by the
+// xdatabase-proxy-tls-secret annotation of Services, keyed by their DNS names.
+type SNISecrets struct {
+	clientset *kubernetes.Clientset
+
+	// secrets holds an informer per referenced Secret by namespace/name; only
+	// used by the reload loop
+	secrets map[string]*secretWatch
+}
+
+// secretWatch caches one Secret.
+type secretWatch struct {
+	store  cache.Store
+	cancel context.CancelFunc
+}
+
+// sniOwner is a Service referencing a Secret, which may only serve host names
+// of its own deployment or namespace.
+type sniOwner struct {
+	namespace    string
+	deploymentID string
+}
+
+func NewSNISecrets(clientset *kubernetes.Clientset) *SNISecrets {
+	return &SNISecrets{clientset: clientset, secrets: make(map[string]*secretWatch)}
+}
+
+// WatchSNICertificates implements core.SNICertificateSource. The certificates
+// are reloaded when an annotated Service or a referenced Secret changes.
+func (s *SNISecrets) WatchSNICertificates(ctx context.Context, onChange func(map[string]*tls.Certificate)) error {
+	factory := informers.NewSharedInformerFactory(s.clientset, 0)
+	informer := factory.Core().V1().Services().Informer()
+
+	changed := make(chan struct{}, 1)
+	notify := func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	}
+	_, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if svc, ok := obj.(*corev1.Service); ok && svc.Annotations[tlsSecretAnnotation] != "" {
+				notify()
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldSvc, ok1 := oldObj.(*corev1.Service)
+			newSvc, ok2 := newObj.(*corev1.Service)
+			if ok1 && ok2 && (oldSvc.Annotations[tlsSecretAnnotation] != newSvc.Annotations[tlsSecretAnnotation] ||
+				newSvc.Annotations[tlsSecretAnnotation] != "" && oldSvc.Labels[deploymentIDLabel] != newSvc.Labels[deploymentIDLabel]) {
+				notify()
+			}
+		},
+		DeleteFunc: func(interface{}) { notify() },
+	})
+	if err != nil {
+		return fmt.Errorf("failed to watch services for %s: %w", tlsSecretAnnotation, err)
+	}
+	factory.Start(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+		return fmt.Errorf("failed to sync services for %s", tlsSecretAnnotation)
+	}
+	// The initial list is loaded below
+	select {
+	case <-changed:
+	default:
+	}
+
+	store := informer.GetStore()
+	certs, retry := s.load(ctx, store, notify)
+	loaded := sniNames(certs)
+	log.Info("SNI certificates loaded from Secrets", "count", len(certs))
+	onChange(certs)
+
+	go func() {
+		var pending, retrying <-chan time.Time
+		for {
+			if retry && retrying == nil {
+				retrying = time.After(sniRetryInterval)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-changed:
+				pending = time.After(sniReloadDelay)
+				continue
+			case <-pending:
+				pending = nil
+			case <-retrying:
+				retrying = nil
+			}
+			var certs map[string]*tls.Certificate
+			certs, retry = s.load(ctx, store, notify)
+			if names := sniNames(certs); names != loaded {
+				loaded = names
+				log.Info("SNI certificates reloaded from Secrets", "count", len(certs))
+			}
+			onChange(certs)
+		}
+	}()
+	return nil
+}
+
+// load reads the Secrets referenced by annotated Services, watching each of
+// them with notify. Secrets that cannot be read are skipped with a warning;
+// retry reports whether one of them could not be watched. A Secret only serves
+// the host names of the Services referencing it, and a host name claimed by
+// several Secrets is served by none of them.
+func (s *SNISecrets) load(ctx context.Context, services cache.Store, notify func()) (certs map[string]*tls.Certificate, retry bool) {
+	refs := make(map[string][]sniOwner)
+	for _, obj := range services.List() {
+		svc, ok := obj.(*corev1.Service)
+		if !ok || svc.Annotations[tlsSecretAnnotation] == "" {
+			continue
+		}
+		key := svc.Namespace + "/" + svc.Annotations[tlsSecretAnnotation]
+		refs[key] = append(refs[key], sniOwner{namespace: svc.Namespace, deploymentID: svc.Labels[deploymentIDLabel]})
+	}
+	for key, watch := range s.secrets {
+		if _, ok := refs[key]; !ok {
+			watch.cancel()
+			delete(s.secrets, key)
+		}
+	}
+	keys := make([]string, 0, len(refs))
+	for key := range refs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	claims := make(map[string][]string) // host name to Secrets
+	loaded := make(map[string]*tls.Certificate)
+	for _, key := range keys {
+		watch, ok := s.secrets[key]
+		if !ok {
+			var err error
+			if watch, err = s.watchSecret(ctx, key, notify); err != nil {
+				log.Warn("Failed to watch SNI Secret, retrying", "secret", key, "retry_in", sniRetryInterval, "error", err)
+				retry = true
+				continue
+			}
+			s.secrets[key] = watch
+		}
+		cert, err := secretCertificate(watch.store, key)
+		if err != nil {
+			log.Warn("Skipping SNI certificate", "secret", key, "error", err)
+			continue
+		}
+		loaded[key] = cert
+		for _, host := range cert.Leaf.DNSNames {
+			host = strings.ToLower(host)
+			if !sniAllowed(host, refs[key]) {
+				log.Warn("SNI host name is outside the deployments and namespace of the Services referencing the Secret, ignoring it",
+					"host", host, "secret", key)
+				continue
+			}
+			if !slices.Contains(claims[host], key) {
+				claims[host] = append(claims[host], key)
+			}
+		}
+	}
+
+	certs = make(map[string]*tls.Certificate)
+	for host, secrets := range claims {
+		if len(secrets) > 1 {
+			log.Error("SNI host name is claimed by several Secrets, serving none of them", "host", host, "secrets", secrets)
+			continue
+		}
+		certs[host] = loaded[secrets[0]]
+	}
+	return certs, retry
+}
+
+// sniAllowed reports whether host belongs to one of the owners: its first
+// label, after a wildcard, is the owner's deployment ID or namespace, e.g.
+// db-prod.example.com or *.team-a.example.com.
+func sniAllowed(host string, owners []sniOwner) bool {
+	first, _, _ := strings.Cut(strings.TrimPrefix(host, "*."), ".")
+	for _, owner := range owners {
+		if first == owner.namespace || owner.deploymentID != "" && first == strings.ToLower(owner.deploymentID) {
+			return true
+		}
+	}
+	return false
+}
+
+// secretCertificate returns the certificate of the Secret key (namespace/name)
+// in store.
+func secretCertificate(store cache.Store, key string) (*tls.Certificate, error) {
+	obj, exists, err := store.GetByKey(key)
+	if err != nil {
+		return nil, err
+	}
+	secret, ok := obj.(*corev1.Secret)
+	if !exists || !ok {
+		return nil, fmt.Errorf("secret not found")
+	}
+	cert, err := tls.X509KeyPair(secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse x509 key pair: %w", err)
+	}
+	if cert.Leaf == nil {
+		if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return nil, fmt.Errorf("failed to parse certificate: %w", err)
+		}
+	}
+	return &cert, nil
+}
+
+// watchSecret starts an informer on the Secret key, like
+// K8sTLSProvider.WatchCertificate, and waits for its first list.
+func (s *SNISecrets) watchSecret(ctx context.Context, key string, notify func()) (*secretWatch, error) {
+	namespace, name, _ := strings.Cut(key, "/")
+	ctx, cancel := context.WithCancel(ctx)
+	factory := informers.NewSharedInformerFactoryWithOptions(s.clientset, 0,
+		informers.WithNamespace(namespace),
+		informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+			opts.FieldSelector = fields.OneTermEqualSelector("metadata.name", name).String()
+		}))
+	informer := factory.Core().V1().Secrets().Informer()
+
+	_, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(interface{}) {
+			// The initial list is read by the caller; only react to Secrets created later
+			if informer.HasSynced() {
+				notify()
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldSecret, ok1 := oldObj.(*corev1.Secret)
+			newSecret, ok2 := newObj.(*corev1.Secret)
+			if ok1 && ok2 && oldSecret.ResourceVersion == newSecret.ResourceVersion {
+				return // periodic resync
+			}
+			log.Info("SNI Secret changed, reloading certificates", "secret", key)
+			notify()
+		},
+		DeleteFunc: func(interface{}) { notify() },
+	})
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to watch secret: %w", err)
+	}
+	factory.Start(ctx.Done())
+
+	syncCtx, syncCancel := context.WithTimeout(ctx, sniSyncTimeout)
+	defer syncCancel()
+	if !cache.WaitForCacheSync(syncCtx.Done(), informer.HasSynced) {
+		cancel()
+		return nil, fmt.Errorf("failed to list secret within %s", sniSyncTimeout)
+	}
+	return &secretWatch{store: informer.GetStore(), cancel: cancel}, nil
+}
+
+// sniNames identifies a set of SNI certificates for change logging.
+func sniNames(certs map[string]*tls.Certificate) string {
+	names := make([]string, 0, len(certs))
+	for name := range certs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
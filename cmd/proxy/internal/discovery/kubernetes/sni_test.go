@@ -0,0 +1,35 @@
+package kubernetes
+
+import "testing"
+
+func TestSNIAllowed(t *testing.T) {
+	owners := []sniOwner{{namespace: "team-a", deploymentID: "db-prod"}}
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"db-prod.example.com", true},
+		{"team-a.example.com", true},
+		{"*.team-a.example.com", true},
+		{"*.db-prod.example.com", true},
+		{"db-prod", true},
+		{"db-other.example.com", false},
+		{"*.example.com", false},
+		{"example.com", false},
+		{"www.db-prod.example.com", false},
+		{"team-b.example.com", false},
+	}
+	for _, tt := range tests {
+		if got := sniAllowed(tt.host, owners); got != tt.want {
+			t.Errorf("sniAllowed(%q) = %v, want %v", tt.host, got, tt.want)
+		}
+	}
+
+	// Without a deployment ID only the namespace is allowed
+	if sniAllowed("db-prod.example.com", []sniOwner{{namespace: "team-a"}}) {
+		t.Error("deployment name allowed for a Service without a deployment ID")
+	}
+	if !sniAllowed("db-prod.example.com", []sniOwner{{namespace: "team-a"}, {namespace: "team-a", deploymentID: "DB-Prod"}}) {
+		t.Error("deployment name of a second referencing Service not allowed")
+	}
+}
@@ -1,20 +1,34 @@
 package kubernetes
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
 	"fmt"
+	"os"
+	"sync"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
 )
 
+// sessionTicketKey is the TLS Secret data key holding the session ticket keys.
+const sessionTicketKey = "session-ticket-keys"
+
 type K8sTLSProvider struct {
 	clientset  *kubernetes.Clientset
 	namespace  string
 	secretName string
+	election   *LeaderElection
+
+	mu            sync.Mutex
+	read          []byte // certificate last read from the Secret, nil when it did not exist
+	ticketVersion string // resourceVersion of the Secret when the session ticket keys were last read
 }
 
 func NewK8sTLSProvider(clientset *kubernetes.Clientset, namespace, secretName string) *K8sTLSProvider {
@@ -25,11 +39,23 @@ func NewK8sTLSProvider(clientset *kubernetes.Clientset, namespace, secretName st
 	}
 }
 
+// WithLeaderElection makes only the leader of election generate and renew
+// the certificate.
+func (p *K8sTLSProvider) WithLeaderElection(election *LeaderElection) *K8sTLSProvider {
+	p.election = election
+	return p
+}
+
 func (p *K8sTLSProvider) GetCertificate(ctx context.Context) (*tls.Certificate, error) {
 	secret, err := p.clientset.CoreV1().Secrets(p.namespace).Get(ctx, p.secretName, metav1.GetOptions{})
 	if err != nil {
+		if errors.IsNotFound(err) {
+			p.setRead(nil)
+		}
 		return nil, fmt.Errorf("failed to get secret %s/%s: %w", p.namespace, p.secretName, err)
 	}
+	// Remembered even for an unusable pair, so Store can replace it
+	p.setRead(secret.Data[corev1.TLSCertKey])
 
 	certBytes, ok := secret.Data[corev1.TLSCertKey]
 	if !ok {
@@ -48,29 +74,151 @@ func (p *K8sTLSProvider) GetCertificate(ctx context.Context) (*tls.Certificate,
 	return &cert, nil
 }
 
+// Store writes the pair to the Secret, creating it when it does not exist.
+// It fails instead of overwriting a certificate that another instance stored
+// after GetCertificate last read the Secret; the update itself is conditional
+// on the Secret's resourceVersion, and other keys and metadata are kept.
 func (p *K8sTLSProvider) Store(ctx context.Context, certPEM, keyPEM []byte) error {
-	secret := &corev1.Secret{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      p.secretName,
-			Namespace: p.namespace,
-		},
-		Type: corev1.SecretTypeTLS,
-		Data: map[string][]byte{
-			corev1.TLSCertKey:       certPEM,
-			corev1.TLSPrivateKeyKey: keyPEM,
-		},
+	secrets := p.clientset.CoreV1().Secrets(p.namespace)
+	secret, err := secrets.Get(ctx, p.secretName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      p.secretName,
+				Namespace: p.namespace,
+			},
+			Type: corev1.SecretTypeTLS,
+			Data: map[string][]byte{
+				corev1.TLSCertKey:       certPEM,
+				corev1.TLSPrivateKeyKey: keyPEM,
+			},
+		}
+		if _, err := secrets.Create(ctx, secret, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("failed to create secret %s/%s: %w", p.namespace, p.secretName, err)
+		}
+		p.setRead(certPEM)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get secret %s/%s: %w", p.namespace, p.secretName, err)
+	}
+
+	p.mu.Lock()
+	read := p.read
+	p.mu.Unlock()
+	if !bytes.Equal(secret.Data[corev1.TLSCertKey], read) {
+		return fmt.Errorf("certificate in secret %s/%s changed since it was read, not overwriting it", p.namespace, p.secretName)
+	}
+	if secret.Data == nil {
+		secret.Data = make(map[string][]byte)
+	}
+	secret.Data[corev1.TLSCertKey] = certPEM
+	secret.Data[corev1.TLSPrivateKeyKey] = keyPEM
+
+	// The fetched resourceVersion makes this fail instead of overwriting a concurrent change
+	if _, err := secrets.Update(ctx, secret, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to update secret %s/%s: %w", p.namespace, p.secretName, err)
 	}
+	p.setRead(certPEM)
+	return nil
+}
 
-	_, err := p.clientset.CoreV1().Secrets(p.namespace).Create(ctx, secret, metav1.CreateOptions{})
+func (p *K8sTLSProvider) setRead(certPEM []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.read = certPEM
+}
+
+// IsLeader implements core.CertificateElection. Without an election every
+// instance may write the certificate.
+func (p *K8sTLSProvider) IsLeader() bool {
+	return p.election == nil || p.election.IsLeader()
+}
+
+// LeaderChanged implements core.CertificateElection.
+func (p *K8sTLSProvider) LeaderChanged() <-chan struct{} {
+	if p.election == nil {
+		return nil
+	}
+	return p.election.LeaderChanged()
+}
+
+// LoadSessionTicketKeys implements core.SessionTicketKeyStore with an extra
+// key of the TLS Secret.
+func (p *K8sTLSProvider) LoadSessionTicketKeys(ctx context.Context) ([]byte, error) {
+	secret, err := p.clientset.CoreV1().Secrets(p.namespace).Get(ctx, p.secretName, metav1.GetOptions{})
 	if err != nil {
-		// If it already exists (race condition with another instance), that's OK
-		if errors.IsAlreadyExists(err) {
-			return nil
-		}
-		// For other errors, try to update
-		if _, updateErr := p.clientset.CoreV1().Secrets(p.namespace).Update(ctx, secret, metav1.UpdateOptions{}); updateErr != nil {
-			return fmt.Errorf("failed to create or update secret %s/%s: %v (create err: %v)", p.namespace, p.secretName, updateErr, err)
+		if errors.IsNotFound(err) {
+			return nil, fmt.Errorf("secret %s/%s: %w", p.namespace, p.secretName, os.ErrNotExist)
 		}
+		return nil, fmt.Errorf("failed to get secret %s/%s: %w", p.namespace, p.secretName, err)
+	}
+	p.mu.Lock()
+	p.ticketVersion = secret.ResourceVersion
+	p.mu.Unlock()
+	data, ok := secret.Data[sessionTicketKey]
+	if !ok {
+		return nil, fmt.Errorf("secret %s/%s has no %s: %w", p.namespace, p.secretName, sessionTicketKey, os.ErrNotExist)
 	}
+	return data, nil
+}
+
+// StoreSessionTicketKeys implements core.SessionTicketKeyStore. The Secret is
+// created with the certificate, so this fails until it exists.
+func (p *K8sTLSProvider) StoreSessionTicketKeys(ctx context.Context, data []byte) error {
+	secrets := p.clientset.CoreV1().Secrets(p.namespace)
+	secret, err := secrets.Get(ctx, p.secretName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get secret %s/%s: %w", p.namespace, p.secretName, err)
+	}
+	if secret.Data == nil {
+		secret.Data = make(map[string][]byte)
+	}
+	secret.Data[sessionTicketKey] = data
+
+	// Conditional on the resourceVersion the keys were read at, so concurrent
+	// rotations by two replicas cannot both win
+	p.mu.Lock()
+	if p.ticketVersion != "" {
+		secret.ResourceVersion = p.ticketVersion
+	}
+	p.mu.Unlock()
+	if _, err := secrets.Update(ctx, secret, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to update secret %s/%s: %w", p.namespace, p.secretName, err)
+	}
+	return nil
+}
+
+// WatchCertificate implements core.CertificateWatcher with an informer on the Secret.
+func (p *K8sTLSProvider) WatchCertificate(ctx context.Context, onChange func()) error {
+	factory := informers.NewSharedInformerFactoryWithOptions(p.clientset, 0,
+		informers.WithNamespace(p.namespace),
+		informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+			opts.FieldSelector = fields.OneTermEqualSelector("metadata.name", p.secretName).String()
+		}))
+	informer := factory.Core().V1().Secrets().Informer()
+
+	_, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			// The initial list is already loaded; only react to Secrets created later
+			if informer.HasSynced() {
+				onChange()
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldSecret, ok1 := oldObj.(*corev1.Secret)
+			newSecret, ok2 := newObj.(*corev1.Secret)
+			if ok1 && ok2 && oldSecret.ResourceVersion == newSecret.ResourceVersion {
+				return // periodic resync
+			}
+			log.Info("TLS Secret changed, reloading certificate", "namespace", p.namespace, "secret", p.secretName)
+			onChange()
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to watch secret %s/%s: %w", p.namespace, p.secretName, err)
+	}
+
+	factory.Start(ctx.Done())
 	return nil
 }
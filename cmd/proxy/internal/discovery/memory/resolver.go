@@ -3,22 +3,38 @@ package memory
 import (
 	"context"
 	"fmt"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/core"
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/logger"
 )
 
+var log = logger.Component(logger.ComponentResolver)
+
 type Resolver struct {
-	backends map[string]string
+	backends map[string][]string
 	mu       sync.RWMutex
+
+	// prober tracks primary/replica roles when a key maps to several addresses
+	prober *RoleProber
+	next   atomic.Uint64
+
+	// health, when set, is used to skip backends with an open circuit
+	health core.BackendHealth
+
+	// persistPath, when set, receives the mapping after every runtime change
+	persistPath string
 }
 
 // NewResolver creates a new memory resolver from a comma-separated string
-// Format: "deployment_id[.pool]=host:port,..."
+// Format: "deployment_id[.pool]=host:port[|host:port...],..."
 // Example: "db1=localhost:5432,db1.pool=localhost:6432"
+// Example: "db2=10.0.1.5:5432|10.0.1.6:5432" (cluster members, first one is the primary by default)
 func NewResolver(mappingStr string) (*Resolver, error) {
-	backends := make(map[string]string)
+	backends := make(map[string][]string)
 	if mappingStr == "" {
 		return &Resolver{backends: backends}, nil
 	}
@@ -30,19 +46,94 @@ func NewResolver(mappingStr string) (*Resolver, error) {
 			return nil, fmt.Errorf("invalid mapping format: %s", pair)
 		}
 		key := strings.TrimSpace(parts[0])
-		addr := strings.TrimSpace(parts[1])
-		backends[key] = addr
+		var addrs []string
+		for _, addr := range strings.Split(parts[1], "|") {
+			if addr = strings.TrimSpace(addr); addr != "" {
+				addrs = append(addrs, addr)
+			}
+		}
+		if len(addrs) == 0 {
+			return nil, fmt.Errorf("invalid mapping format: %s", pair)
+		}
+		backends[key] = addrs
 	}
 
 	return &Resolver{backends: backends}, nil
 }
 
-func (r *Resolver) Resolve(ctx context.Context, metadata core.RoutingMetadata, databaseType core.DatabaseType) (string, error) {
+// StartRoleProbe starts probing every configured address with pg_is_in_recovery()
+// so that primary and replica connections follow failovers.
+func (r *Resolver) StartRoleProbe(ctx context.Context, prober *RoleProber) {
+	r.mu.Lock()
+	r.prober = prober
+	addrs := r.clusterAddresses()
+	r.mu.Unlock()
+
+	prober.Start(ctx, addrs)
+}
+
+// SetHealth makes the resolver skip backends reported unhealthy. A
+// core.BackendTracker probes the configured backends from now on.
+func (r *Resolver) SetHealth(health core.BackendHealth) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.health = health
+	r.track()
+}
+
+// Addresses returns every configured backend address.
+func (r *Resolver) Addresses() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.addresses()
+}
+
+// track passes the configured backends to the health tracker. Caller holds r.mu.
+func (r *Resolver) track() {
+	if tracker, ok := r.health.(core.BackendTracker); ok {
+		tracker.Track(r.addresses()...)
+	}
+}
+
+// addresses returns every configured backend address. Caller holds r.mu.
+func (r *Resolver) addresses() []string {
+	var addrs []string
+	for _, list := range r.backends {
+		addrs = append(addrs, list...)
+	}
+	return addrs
+}
+
+// Routes implements core.RouteLister.
+func (r *Resolver) Routes() []core.Route {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	routes := make([]core.Route, 0, len(r.backends))
+	for key, addrs := range r.backends {
+		deploymentID, pooled := strings.CutSuffix(key, ".pool")
+		routes = append(routes, core.Route{
+			DeploymentID: deploymentID,
+			Pooled:       pooled,
+			Addresses:    append([]string(nil), addrs...),
+			Source:       "static",
+		})
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].DeploymentID != routes[j].DeploymentID {
+			return routes[i].DeploymentID < routes[j].DeploymentID
+		}
+		return !routes[i].Pooled && routes[j].Pooled
+	})
+	return routes
+}
+
+func (r *Resolver) Resolve(ctx context.Context, metadata core.RoutingMetadata, databaseType core.DatabaseType) ([]string, error) {
 	deploymentID, ok := metadata["deployment_id"]
 	if !ok {
-		return "", fmt.Errorf("metadata missing 'deployment_id'")
+		return nil, core.ErrMissingDeploymentID
 	}
 	pooled := metadata["pooled"]
+	role := metadata.RequestedRole()
 
 	// Construct lookup key: deployment_id or deployment_id.pool
 	key := deploymentID
@@ -51,13 +142,91 @@ func (r *Resolver) Resolve(ctx context.Context, metadata core.RoutingMetadata, d
 	}
 
 	r.mu.RLock()
-	addr, ok := r.backends[key]
+	addrs, ok := r.backends[key]
+	prober := r.prober
+	health := r.health
 	r.mu.RUnlock()
 
 	if !ok {
-		return "", fmt.Errorf("backend not found for key: %s", key)
+		return nil, fmt.Errorf("%w for key: %s", core.ErrBackendNotFound, key)
 	}
 
-	fmt.Printf("MemoryResolver: Routing %s (pooled=%s) to %s\n", deploymentID, pooled, addr)
-	return addr, nil
+	candidates, err := r.selectByRole(addrs, role, metadata.PrefersReplica(), prober, health)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", key, err)
+	}
+
+	log.Debug("Routing to static backend", "deployment_id", deploymentID, "pooled", pooled, "role", role, "candidates", candidates)
+	return candidates, nil
+}
+
+// selectByRole returns the healthy addresses serving the requested role, in dial order.
+// Single-address mappings serve every role. Without a prober the first
+// address is treated as the primary and the rest as replicas. Replicas are
+// rotated so that consecutive connections start with a different one. With
+// preferReplica the primaries follow the replicas.
+func (r *Resolver) selectByRole(addrs []string, role core.BackendRole, preferReplica bool, prober *RoleProber, health core.BackendHealth) ([]string, error) {
+	if len(addrs) == 1 {
+		if health != nil && !health.IsHealthy(addrs[0]) {
+			return nil, fmt.Errorf("%w: %s has an open circuit", core.ErrNoHealthyBackend, addrs[0])
+		}
+		return addrs, nil
+	}
+
+	var primaries, replicas []string
+	if prober == nil {
+		primaries, replicas = addrs[:1], addrs[1:]
+	} else {
+		for _, addr := range addrs {
+			switch prober.Role(addr) {
+			case core.BackendRolePrimary:
+				primaries = append(primaries, addr)
+			case core.BackendRoleReplica:
+				replicas = append(replicas, addr)
+			}
+		}
+	}
+
+	if health != nil {
+		primaries = filterHealthy(primaries, health)
+		replicas = filterHealthy(replicas, health)
+	}
+
+	if role == core.BackendRoleReplica && preferReplica {
+		if len(replicas) > 0 {
+			replicas = rotate(replicas, int(r.next.Add(1)%uint64(len(replicas))))
+		}
+		if candidates := append(replicas, primaries...); len(candidates) > 0 {
+			return candidates, nil
+		}
+		return nil, fmt.Errorf("%w: no replica or primary available", core.ErrBackendNotFound)
+	}
+
+	if role == core.BackendRoleReplica {
+		if len(replicas) == 0 {
+			return nil, fmt.Errorf("%w: no replica available", core.ErrBackendNotFound)
+		}
+		return rotate(replicas, int(r.next.Add(1)%uint64(len(replicas)))), nil
+	}
+
+	if len(primaries) == 0 {
+		return nil, fmt.Errorf("%w: no primary available", core.ErrBackendNotFound)
+	}
+	return primaries, nil
+}
+
+func filterHealthy(addrs []string, health core.BackendHealth) []string {
+	var healthy []string
+	for _, addr := range addrs {
+		if health.IsHealthy(addr) {
+			healthy = append(healthy, addr)
+		}
+	}
+	return healthy
+}
+
+func rotate(addrs []string, start int) []string {
+	out := make([]string, 0, len(addrs))
+	out = append(out, addrs[start:]...)
+	return append(out, addrs[:start]...)
 }
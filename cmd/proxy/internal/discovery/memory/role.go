@@ -0,0 +1,116 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/core"
+	postgresql_probe "github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/probe/postgresql"
+)
+
+// RoleProber periodically asks each static backend whether it is in recovery
+// and caches the answer. Unreachable backends have no role and are skipped.
+type RoleProber struct {
+	opts     postgresql_probe.Options
+	interval time.Duration
+
+	addrs []string
+	roles map[string]core.BackendRole
+	mu    sync.RWMutex
+}
+
+func NewRoleProber(opts postgresql_probe.Options, interval time.Duration) *RoleProber {
+	if interval <= 0 {
+		interval = 2 * time.Second
+	}
+	return &RoleProber{
+		opts:     opts,
+		interval: interval,
+		roles:    make(map[string]core.BackendRole),
+	}
+}
+
+// Start runs an initial probe synchronously and then keeps probing in the background.
+func (p *RoleProber) Start(ctx context.Context, addrs []string) {
+	p.SetAddresses(addrs)
+	p.probeAll(ctx)
+
+	go func() {
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				p.probeAll(ctx)
+			}
+		}
+	}()
+}
+
+// SetAddresses replaces the probed addresses. New addresses get a role on the next probe.
+func (p *RoleProber) SetAddresses(addrs []string) {
+	keep := make(map[string]bool, len(addrs))
+	for _, addr := range addrs {
+		keep[addr] = true
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.addrs = append([]string(nil), addrs...)
+	for addr := range p.roles {
+		if !keep[addr] {
+			delete(p.roles, addr)
+		}
+	}
+}
+
+// Role returns the last observed role of addr, or "" if unknown/unreachable.
+func (p *RoleProber) Role(addr string) core.BackendRole {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.roles[addr]
+}
+
+func (p *RoleProber) probeAll(ctx context.Context) {
+	p.mu.RLock()
+	addrs := p.addrs
+	p.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	for _, addr := range addrs {
+		wg.Add(1)
+		go func(addr string) {
+			defer wg.Done()
+			p.probe(ctx, addr)
+		}(addr)
+	}
+	wg.Wait()
+}
+
+func (p *RoleProber) probe(ctx context.Context, addr string) {
+	probeCtx, cancel := context.WithTimeout(ctx, p.interval)
+	defer cancel()
+
+	var role core.BackendRole
+	inRecovery, err := postgresql_probe.IsInRecovery(probeCtx, addr, p.opts)
+	switch {
+	case err != nil:
+		log.Debug("Role probe failed", "backend_addr", addr, "error", err)
+	case inRecovery:
+		role = core.BackendRoleReplica
+	default:
+		role = core.BackendRolePrimary
+	}
+
+	p.mu.Lock()
+	previous := p.roles[addr]
+	p.roles[addr] = role
+	p.mu.Unlock()
+
+	if previous != role {
+		log.Info("Backend role changed", "backend_addr", addr, "previous", previous, "role", role)
+	}
+}
@@ -0,0 +1,162 @@
+package memory
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/core"
+)
+
+// SetRoute adds or replaces the addresses of key ("deployment_id" or
+// "deployment_id.pool") and persists the mapping when a routes file is set.
+func (r *Resolver) SetRoute(key string, addrs []string) error {
+	if err := validateRoute(key, addrs); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	previous, existed := r.backends[key]
+	r.backends[key] = append([]string(nil), addrs...)
+	if err := r.save(); err != nil {
+		// Keep memory and file in sync
+		if existed {
+			r.backends[key] = previous
+		} else {
+			delete(r.backends, key)
+		}
+		return err
+	}
+	r.updateProber()
+	r.track()
+	log.Info("Static route updated", "key", key, "addresses", addrs)
+	return nil
+}
+
+// DeleteRoute removes key. It returns core.ErrBackendNotFound when key is not routed.
+func (r *Resolver) DeleteRoute(key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	previous, ok := r.backends[key]
+	if !ok {
+		return fmt.Errorf("%w for key: %s", core.ErrBackendNotFound, key)
+	}
+	delete(r.backends, key)
+	if err := r.save(); err != nil {
+		r.backends[key] = previous
+		return err
+	}
+	r.updateProber()
+	r.track()
+	log.Info("Static route deleted", "key", key)
+	return nil
+}
+
+// SetPersistence makes the resolver persist its mapping to path as JSON
+// ({"db1": ["host:5432"], "db1.pool": ["host:6432"]}). If the file exists its
+// mapping replaces the current one, so routes changed at runtime survive restarts;
+// a configured mapping that differs from the file is logged and ignored.
+func (r *Resolver) SetPersistence(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read routes file: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.persistPath = path
+
+	if err != nil {
+		// First start: seed the file from the configured mapping
+		return r.save()
+	}
+
+	backends := make(map[string][]string)
+	if err := json.Unmarshal(data, &backends); err != nil {
+		return fmt.Errorf("failed to parse routes file %s: %w", path, err)
+	}
+	for key, addrs := range backends {
+		if err := validateRoute(key, addrs); err != nil {
+			return fmt.Errorf("routes file %s: %w", path, err)
+		}
+	}
+	if len(r.backends) > 0 && !maps.EqualFunc(r.backends, backends, slices.Equal) {
+		log.Warn("STATIC_BACKENDS differs from the routes file, using the routes file",
+			"path", path, "configured_routes", len(r.backends), "file_routes", len(backends))
+	}
+	r.backends = backends
+	r.updateProber()
+	r.track()
+	log.Info("Loaded static routes from file", "path", path, "routes", len(backends))
+	return nil
+}
+
+// save writes the mapping to the routes file, atomically. Caller holds r.mu.
+func (r *Resolver) save() error {
+	if r.persistPath == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(r.backends, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(r.persistPath), ".routes-*.json")
+	if err != nil {
+		return fmt.Errorf("failed to persist routes: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to persist routes: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to persist routes: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), r.persistPath); err != nil {
+		return fmt.Errorf("failed to persist routes: %w", err)
+	}
+	return nil
+}
+
+// updateProber points the role prober at the current cluster members. Caller holds r.mu.
+func (r *Resolver) updateProber() {
+	if r.prober != nil {
+		r.prober.SetAddresses(r.clusterAddresses())
+	}
+}
+
+// clusterAddresses returns the addresses of keys with several members, which
+// need role probing to tell the primary apart. Caller holds r.mu.
+func (r *Resolver) clusterAddresses() []string {
+	var addrs []string
+	for _, list := range r.backends {
+		if len(list) > 1 {
+			addrs = append(addrs, list...)
+		}
+	}
+	return addrs
+}
+
+func validateRoute(key string, addrs []string) error {
+	deploymentID, _ := strings.CutSuffix(key, ".pool")
+	if deploymentID == "" || strings.ContainsAny(key, " ,=|/") || strings.Contains(deploymentID, ".") {
+		return fmt.Errorf("invalid route key %q (expected deployment_id or deployment_id.pool)", key)
+	}
+	if len(addrs) == 0 {
+		return fmt.Errorf("route %s has no addresses", key)
+	}
+	for _, addr := range addrs {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return fmt.Errorf("route %s: invalid address %q: %v", key, addr, err)
+		}
+	}
+	return nil
+}
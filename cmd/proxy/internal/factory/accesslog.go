@@ -0,0 +1,36 @@
+package factory
+
+import (
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/accesslog"
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/config"
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/logger"
+)
+
+// AccessLogFactory creates the connection access log based on configuration
+type AccessLogFactory struct {
+	cfg *config.Config
+}
+
+// NewAccessLogFactory creates a new access log factory
+func NewAccessLogFactory(cfg *config.Config) *AccessLogFactory {
+	return &AccessLogFactory{cfg: cfg}
+}
+
+// Create opens the access log sink. It returns nil when the access log is disabled.
+func (f *AccessLogFactory) Create() (*accesslog.Logger, error) {
+	if !f.cfg.AccessLogEnabled {
+		return nil, nil
+	}
+
+	logger.Info("Creating Access Log", "output", f.cfg.AccessLogOutput)
+
+	return accesslog.New(accesslog.Options{
+		Output:        f.cfg.AccessLogOutput,
+		Path:          f.cfg.AccessLogFile,
+		MaxSizeMB:     f.cfg.AccessLogMaxSizeMB,
+		MaxBackups:    f.cfg.AccessLogMaxBackups,
+		MaxAgeDays:    f.cfg.AccessLogMaxAgeDays,
+		SyslogNetwork: f.cfg.AccessLogSyslogNetwork,
+		SyslogAddress: f.cfg.AccessLogSyslogAddress,
+	})
+}
@@ -0,0 +1,55 @@
+package factory
+
+import (
+	"context"
+
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/config"
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/health"
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/logger"
+	postgresql_probe "github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/probe/postgresql"
+)
+
+// HealthCheckFactory creates the backend health checker based on configuration
+type HealthCheckFactory struct {
+	cfg *config.Config
+}
+
+// NewHealthCheckFactory creates a new health check factory
+func NewHealthCheckFactory(cfg *config.Config) *HealthCheckFactory {
+	return &HealthCheckFactory{cfg: cfg}
+}
+
+// Create creates and starts the health checker. It returns nil when health checking is disabled.
+func (f *HealthCheckFactory) Create(ctx context.Context) *health.Checker {
+	if !f.cfg.HealthCheckEnabled {
+		return nil
+	}
+
+	logger.Info("Creating Backend Health Checker",
+		"mode", f.cfg.HealthCheckMode,
+		"interval", f.cfg.HealthCheckInterval,
+		"failure_threshold", f.cfg.HealthCheckFailureThreshold)
+
+	var prober health.Prober
+	switch f.cfg.HealthCheckMode {
+	case config.HealthCheckPostgres:
+		prober = health.PostgresProber(postgresql_probe.Options{
+			User:     f.cfg.HealthCheckUser,
+			Password: f.cfg.HealthCheckPassword,
+			Database: f.cfg.HealthCheckDatabase,
+			SSLMode:  f.cfg.HealthCheckSSLMode,
+			Timeout:  f.cfg.HealthCheckTimeout,
+		})
+	default:
+		prober = health.TCPProber()
+	}
+
+	checker := health.NewChecker(prober, health.Options{
+		Interval:         f.cfg.HealthCheckInterval,
+		Timeout:          f.cfg.HealthCheckTimeout,
+		FailureThreshold: f.cfg.HealthCheckFailureThreshold,
+		OpenDuration:     f.cfg.HealthCheckOpenDuration,
+	})
+	checker.Start(ctx)
+	return checker
+}
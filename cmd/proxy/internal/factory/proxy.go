@@ -4,28 +4,41 @@ import (
 	"context"
 	"crypto/tls"
 	"fmt"
+	"slices"
 
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/accesslog"
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/certcache"
 	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/config"
 	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/core"
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/dialer"
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/health"
 	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/logger"
 	postgresql_proxy "github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/proxy/postgresql"
+	"golang.org/x/crypto/acme"
 )
 
 // ProxyFactory creates protocol-specific proxy handlers
 type ProxyFactory struct {
-	cfg *config.Config
+	cfg       *config.Config
+	health    *health.Checker
+	accessLog *accesslog.Logger
+	registry  *core.ConnectionRegistry
 }
 
-// NewProxyFactory creates a new proxy factory
-func NewProxyFactory(cfg *config.Config) *ProxyFactory {
-	return &ProxyFactory{cfg: cfg}
+// NewProxyFactory creates a new proxy factory.
+// checker is optional; when set, backend dial outcomes are reported to it.
+// accessLog is optional; when set, it receives a record per closed connection.
+// registry is the live connection registry served by the admin console.
+func NewProxyFactory(cfg *config.Config, checker *health.Checker, accessLog *accesslog.Logger, registry *core.ConnectionRegistry) *ProxyFactory {
+	return &ProxyFactory{cfg: cfg, health: checker, accessLog: accessLog, registry: registry}
 }
 
-// Create creates a connection handler based on database type
-func (f *ProxyFactory) Create(ctx context.Context, tlsProvider core.TLSProvider, resolver core.BackendResolver) (core.ConnectionHandler, error) {
+// Create creates a connection handler based on database type.
+// certs is nil when TLS is disabled.
+func (f *ProxyFactory) Create(ctx context.Context, certs *certcache.Cache, resolver core.BackendResolver) (core.ConnectionHandler, error) {
 	switch f.cfg.DatabaseType {
 	case "postgresql":
-		return f.createPostgreSQLProxy(ctx, tlsProvider, resolver)
+		return f.createPostgreSQLProxy(ctx, certs, resolver)
 	case "mysql":
 		return nil, fmt.Errorf("MySQL proxy not yet implemented")
 	case "mongodb":
@@ -35,26 +48,113 @@ func (f *ProxyFactory) Create(ctx context.Context, tlsProvider core.TLSProvider,
 	}
 }
 
-func (f *ProxyFactory) createPostgreSQLProxy(ctx context.Context, tlsProvider core.TLSProvider, resolver core.BackendResolver) (core.ConnectionHandler, error) {
+func (f *ProxyFactory) createPostgreSQLProxy(ctx context.Context, certs *certcache.Cache, resolver core.BackendResolver) (core.ConnectionHandler, error) {
 	logger.Info("Creating PostgreSQL Proxy Handler", "tls_enabled", f.cfg.TLSEnabled)
 
 	var tlsConfig *tls.Config
 
-	// TLS is optional
-	if f.cfg.TLSEnabled && tlsProvider != nil {
-		cert, err := tlsProvider.GetCertificate(ctx)
+	// TLS is optional. The certificate is looked up per handshake so rotations apply immediately.
+	if f.cfg.TLSEnabled && certs != nil {
+		policy, err := f.cfg.TLSPolicy()
 		if err != nil {
-			return nil, fmt.Errorf("failed to load certificate for PostgreSQL proxy: %w", err)
+			return nil, err
 		}
 		tlsConfig = &tls.Config{
-			Certificates: []tls.Certificate{*cert},
+			// Required by clients connecting with sslnegotiation=direct
+			NextProtos:             []string{"postgresql"},
+			SessionTicketsDisabled: !f.cfg.TLSSessionTickets,
+		}
+		policy.Apply(tlsConfig)
+		if responder, ok := certs.Provider().(core.TLSChallengeResponder); ok {
+			tlsConfig.GetConfigForClient = acmeChallengeConfig(responder)
 		}
+		certs.Configure(tlsConfig)
+		logger.Info("TLS policy", "profile", f.cfg.TLSProfile,
+			"min_version", tls.VersionName(tlsConfig.MinVersion), "max_version", maxVersionName(tlsConfig.MaxVersion),
+			"cipher_suites", len(tlsConfig.CipherSuites), "session_tickets", f.cfg.TLSSessionTickets)
 	} else {
 		logger.Warn("TLS is disabled. Connections will not be encrypted!")
 	}
 
-	return &postgresql_proxy.PostgresProxy{
+	var queue *postgresql_proxy.QueueOptions
+	if f.cfg.QueueEnabled {
+		logger.Info("Queue mode enabled", "timeout", f.cfg.QueueTimeout, "notice_interval", f.cfg.QueueNoticeInterval)
+		queue = &postgresql_proxy.QueueOptions{
+			Timeout:        f.cfg.QueueTimeout,
+			RetryInterval:  f.cfg.QueueRetryInterval,
+			NoticeInterval: f.cfg.QueueNoticeInterval,
+		}
+	}
+
+	proxy := &postgresql_proxy.PostgresProxy{
 		TLSConfig: tlsConfig,
 		Resolver:  resolver,
-	}, nil
+		Dialer:    f.createDialer(),
+		Queue:     queue,
+		AccessLog: f.accessLog,
+	}
+
+	if f.cfg.AdminConsoleEnabled {
+		logger.Info("Admin console enabled", "user", f.cfg.AdminConsoleUser+"."+postgresql_proxy.ConsoleDatabase)
+		proxy.Console = &postgresql_proxy.ConsoleOptions{
+			User:         f.cfg.AdminConsoleUser,
+			Password:     f.cfg.AdminConsolePassword,
+			PauseTimeout: f.cfg.AdminConsolePauseTimeout,
+			Registry:     f.registry,
+			Health:       f.health,
+		}
+		if routes, ok := resolver.(core.RouteLister); ok {
+			proxy.Console.Routes = routes
+		}
+		if certs != nil {
+			proxy.Console.Certificates = certs.Certificates
+		}
+	}
+
+	// Resolvers that track backend usage (e.g. scale-to-zero idle tracking)
+	if observer, ok := resolver.(core.ConnectionObserver); ok {
+		proxy.Observers = append(proxy.Observers, observer)
+	}
+
+	return proxy, nil
+}
+
+// maxVersionName names a tls.Config MaxVersion, where 0 means the newest
+// version Go supports.
+func maxVersionName(version uint16) string {
+	if version == 0 {
+		return "default"
+	}
+	return tls.VersionName(version)
+}
+
+func (f *ProxyFactory) createDialer() *dialer.Dialer {
+	d := &dialer.Dialer{
+		Timeout:       f.cfg.BackendDialTimeout,
+		FallbackDelay: f.cfg.BackendDialFallbackDelay,
+		Retries:       f.cfg.BackendDialRetries,
+		Backoff:       f.cfg.BackendDialBackoff,
+	}
+	if f.health != nil {
+		d.Health = f.health
+	}
+	return d
+}
+
+// acmeChallengeConfig answers ACME TLS-ALPN-01 validations with the pending
+// challenge certificate; every other handshake uses the regular configuration.
+func acmeChallengeConfig(responder core.TLSChallengeResponder) func(*tls.ClientHelloInfo) (*tls.Config, error) {
+	return func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		if !slices.Contains(hello.SupportedProtos, acme.ALPNProto) {
+			return nil, nil
+		}
+		cert, ok := responder.ChallengeCertificate(hello)
+		if !ok {
+			return nil, fmt.Errorf("no ACME challenge pending for %q", hello.ServerName)
+		}
+		return &tls.Config{
+			Certificates: []tls.Certificate{*cert},
+			NextProtos:   []string{acme.ALPNProto},
+		}, nil
+	}
 }
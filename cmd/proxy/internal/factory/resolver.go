@@ -7,50 +7,103 @@ import (
 
 	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/config"
 	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/core"
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/discovery/file"
 	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/discovery/kubernetes"
 	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/discovery/memory"
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/health"
 	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/logger"
+	postgresql_probe "github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/probe/postgresql"
 
 	k8s "k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 )
 
+var resolverLog = logger.Component(logger.ComponentResolver)
+
 // ResolverFactory creates backend resolvers based on configuration
 type ResolverFactory struct {
-	cfg *config.Config
+	cfg    *config.Config
+	health *health.Checker
 }
 
-// NewResolverFactory creates a new resolver factory
-func NewResolverFactory(cfg *config.Config) *ResolverFactory {
-	return &ResolverFactory{cfg: cfg}
+// NewResolverFactory creates a new resolver factory.
+// checker is optional; when set, resolvers skip backends with an open circuit.
+func NewResolverFactory(cfg *config.Config, checker *health.Checker) *ResolverFactory {
+	return &ResolverFactory{cfg: cfg, health: checker}
 }
 
 // Create creates a backend resolver based on configuration
 func (f *ResolverFactory) Create(ctx context.Context) (core.BackendResolver, *k8s.Clientset, error) {
 	switch f.cfg.DiscoveryMode {
 	case config.DiscoveryStatic:
-		return f.createStaticResolver()
+		return f.createStaticResolver(ctx)
 	case config.DiscoveryKubernetes:
-		return f.createKubernetesResolver()
+		return f.createKubernetesResolver(ctx)
+	case config.DiscoveryFile:
+		return f.createFileResolver(ctx)
 	default:
 		return nil, nil, fmt.Errorf("unknown discovery mode: %s", f.cfg.DiscoveryMode)
 	}
 }
 
-func (f *ResolverFactory) createStaticResolver() (core.BackendResolver, *k8s.Clientset, error) {
-	logger.Info("Creating Static Backend Resolver", "backends", f.cfg.StaticBackends)
+func (f *ResolverFactory) createStaticResolver(ctx context.Context) (core.BackendResolver, *k8s.Clientset, error) {
+	resolverLog.Info("Creating Static Backend Resolver", "backends", f.cfg.StaticBackends)
 
 	resolver, err := memory.NewResolver(f.cfg.StaticBackends)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to create static resolver: %w", err)
 	}
 
+	if f.cfg.StaticRoutesFile != "" {
+		if err := resolver.SetPersistence(f.cfg.StaticRoutesFile); err != nil {
+			return nil, nil, fmt.Errorf("failed to load static routes: %w", err)
+		}
+	}
+
+	// Role probing is only needed to tell cluster members apart
+	if f.cfg.RoleProbeUser != "" {
+		resolverLog.Info("Starting static backend role probe",
+			"user", f.cfg.RoleProbeUser,
+			"database", f.cfg.RoleProbeDatabase,
+			"sslmode", f.cfg.RoleProbeSSLMode,
+			"interval", f.cfg.RoleProbeInterval)
+		prober := memory.NewRoleProber(postgresql_probe.Options{
+			User:     f.cfg.RoleProbeUser,
+			Password: f.cfg.RoleProbePassword,
+			Database: f.cfg.RoleProbeDatabase,
+			SSLMode:  f.cfg.RoleProbeSSLMode,
+		}, f.cfg.RoleProbeInterval)
+		resolver.StartRoleProbe(ctx, prober)
+	}
+
+	if f.health != nil {
+		resolver.SetHealth(f.health)
+	}
+
 	return resolver, nil, nil
 }
 
-func (f *ResolverFactory) createKubernetesResolver() (core.BackendResolver, *k8s.Clientset, error) {
-	logger.Info("Creating Kubernetes Backend Resolver",
+func (f *ResolverFactory) createFileResolver(ctx context.Context) (core.BackendResolver, *k8s.Clientset, error) {
+	resolverLog.Info("Creating File Backend Resolver", "path", f.cfg.RouteCatalogFile)
+
+	resolver, err := file.NewResolver(f.cfg.RouteCatalogFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create file resolver: %w", err)
+	}
+	if err := resolver.Watch(ctx); err != nil {
+		return nil, nil, err
+	}
+
+	if f.health != nil {
+		resolver.SetHealth(f.health)
+	}
+
+	return resolver, nil, nil
+}
+
+func (f *ResolverFactory) createKubernetesResolver(ctx context.Context) (core.BackendResolver, *k8s.Clientset, error) {
+	resolverLog.Info("Creating Kubernetes Backend Resolver",
 		"runtime", f.cfg.Runtime,
 		"kubeconfig", f.cfg.KubeConfigPath,
 		"context", f.cfg.KubeContext)
@@ -67,7 +120,7 @@ func (f *ResolverFactory) createKubernetesResolver() (core.BackendResolver, *k8s
 	configOverrides := &clientcmd.ConfigOverrides{}
 	if f.cfg.KubeContext != "" {
 		configOverrides.CurrentContext = f.cfg.KubeContext
-		logger.Info("Using specific Kubernetes context", "context", f.cfg.KubeContext)
+		resolverLog.Info("Using specific Kubernetes context", "context", f.cfg.KubeContext)
 	}
 
 	var config *rest.Config
@@ -81,13 +134,13 @@ func (f *ResolverFactory) createKubernetesResolver() (core.BackendResolver, *k8s
 		).ClientConfig()
 
 		if err != nil {
-			logger.Warn("Failed to load kubeconfig, will try in-cluster config", "error", err)
+			resolverLog.Warn("Failed to load kubeconfig, will try in-cluster config", "error", err)
 		}
 	}
 
 	// Fallback to in-cluster config (for Kubernetes runtime)
 	if config == nil {
-		logger.Info("Attempting in-cluster Kubernetes configuration")
+		resolverLog.Info("Attempting in-cluster Kubernetes configuration")
 		config, err = clientcmd.BuildConfigFromFlags("", "")
 		if err != nil {
 			return nil, nil, fmt.Errorf("failed to build kubernetes config (tried kubeconfig and in-cluster): %w", err)
@@ -100,6 +153,24 @@ func (f *ResolverFactory) createKubernetesResolver() (core.BackendResolver, *k8s
 	}
 
 	resolver := kubernetes.NewK8sResolver(clientset)
-	logger.Info("Kubernetes resolver created successfully")
+	go func() {
+		<-ctx.Done()
+		resolver.Stop()
+	}()
+	if f.health != nil {
+		resolver.SetHealth(f.health)
+		// Backends configured before a reload are evicted once idle
+		f.health.Track()
+	}
+
+	if f.cfg.ScaleToZeroEnabled {
+		resolverLog.Info("Scale-to-zero wake-up enabled",
+			"wake_timeout", f.cfg.ScaleToZeroWakeTimeout,
+			"idle_timeout", f.cfg.ScaleToZeroIdleTimeout)
+		scaler := kubernetes.NewScaler(clientset, f.cfg.ScaleToZeroWakeTimeout, f.cfg.ScaleToZeroIdleTimeout)
+		scaler.Start(ctx)
+		resolver.SetScaler(scaler)
+	}
+	resolverLog.Info("Kubernetes resolver created successfully")
 	return resolver, clientset, nil
 }
@@ -2,22 +2,34 @@ package factory
 
 import (
 	"context"
+	"crypto"
+	"crypto/tls"
 	"crypto/x509"
-	"encoding/pem"
+	"errors"
 	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/acmetls"
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/ca"
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/certcache"
 	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/config"
 	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/core"
 	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/discovery/kubernetes"
 	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/discovery/memory"
 	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/logger"
 	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/storage/filesystem"
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/storage/vault"
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/tickets"
 	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/utils"
 
 	k8s "k8s.io/client-go/kubernetes"
 )
 
+var tlsLog = logger.Component(logger.ComponentTLS)
+
 // TLSFactory creates TLS providers based on configuration
 type TLSFactory struct {
 	cfg *config.Config
@@ -28,44 +40,157 @@ func NewTLSFactory(cfg *config.Config) *TLSFactory {
 	return &TLSFactory{cfg: cfg}
 }
 
-// Create creates a TLS provider based on configuration
+// Create creates a TLS provider based on configuration. Background work of
+// the provider, such as a leader election, runs until ctx is done.
 func (f *TLSFactory) Create(ctx context.Context, clientset *k8s.Clientset) (core.TLSProvider, error) {
+	var provider core.TLSProvider
+	var err error
 	switch f.cfg.TLSMode {
 	case config.TLSModeFile:
-		return f.createFileProvider()
+		provider, err = f.createFileProvider()
 	case config.TLSModeKubernetes:
-		return f.createKubernetesProvider(clientset)
+		provider, err = f.createKubernetesProvider(ctx, clientset)
 	case config.TLSModeMemory:
-		return f.createMemoryProvider()
+		provider, err = f.createMemoryProvider()
+	case config.TLSModeVault:
+		provider, err = f.createVaultProvider(ctx)
 	default:
 		return nil, fmt.Errorf("unknown TLS mode: %s", f.cfg.TLSMode)
 	}
+	if err != nil {
+		return nil, err
+	}
+	switch f.cfg.TLSIssuer {
+	case config.TLSIssuerCA:
+		return f.createCAProvider(ctx, provider, clientset)
+	case config.TLSIssuerACME:
+		return f.createACMEProvider(provider, clientset)
+	default:
+		return provider, nil
+	}
+}
+
+// createCAProvider wraps provider to issue its certificates from a proxy CA
+// kept next to them: a second file pair, a second Secret or memory.
+func (f *TLSFactory) createCAProvider(ctx context.Context, provider core.TLSProvider, clientset *k8s.Clientset) (core.TLSProvider, error) {
+	var caStore core.TLSProvider
+	switch f.cfg.TLSMode {
+	case config.TLSModeFile:
+		tlsLog.Info("Using proxy CA from files", "cert", f.cfg.TLSCACertFile, "key", f.cfg.TLSCAKeyFile)
+		caStore = filesystem.NewFileTLSProvider(f.cfg.TLSCACertFile, f.cfg.TLSCAKeyFile)
+	case config.TLSModeKubernetes:
+		tlsLog.Info("Using proxy CA from Kubernetes Secret", "namespace", f.cfg.Namespace, "secret", f.cfg.TLSCASecretName)
+		caStore = kubernetes.NewK8sTLSProvider(clientset, f.cfg.Namespace, f.cfg.TLSCASecretName)
+	default:
+		tlsLog.Info("Using in-memory proxy CA")
+		caStore = memory.NewMemoryTLSProvider()
+	}
+	return ca.NewProvider(ctx, provider, caStore, f.cfg.TLSAutoGenerate, f.cfg.CertificateHosts(), f.cfg.TLSKeyAlgorithm, f.cfg.TLSCertValidity)
 }
 
 func (f *TLSFactory) createFileProvider() (core.TLSProvider, error) {
-	logger.Info("Creating File-based TLS Provider",
+	tlsLog.Info("Creating File-based TLS Provider",
 		"cert", f.cfg.TLSCertFile,
 		"key", f.cfg.TLSKeyFile)
 	return filesystem.NewFileTLSProvider(f.cfg.TLSCertFile, f.cfg.TLSKeyFile), nil
 }
 
-func (f *TLSFactory) createKubernetesProvider(clientset *k8s.Clientset) (core.TLSProvider, error) {
+// createKubernetesProvider stores the certificate in TLS_SECRET_NAME. With
+// TLS_LEADER_ELECTION the replicas elect one of them through TLS_LEASE_NAME to
+// generate and renew it, until ctx is done. When the election cannot start,
+// startup fails if TLS_LEADER_ELECTION was set explicitly; with the default
+// every replica renews the certificate, as with TLS_LEADER_ELECTION=false.
+func (f *TLSFactory) createKubernetesProvider(ctx context.Context, clientset *k8s.Clientset) (core.TLSProvider, error) {
 	if clientset == nil {
 		return nil, fmt.Errorf("kubernetes TLS mode requires kubernetes client (use DISCOVERY_MODE=kubernetes or provide KUBECONFIG)")
 	}
 
-	logger.Info("Creating Kubernetes TLS Provider",
+	tlsLog.Info("Creating Kubernetes TLS Provider",
 		"namespace", f.cfg.Namespace,
-		"secret", f.cfg.TLSSecretName)
+		"secret", f.cfg.TLSSecretName,
+		"leader_election", f.cfg.TLSLeaderElection)
 
-	return kubernetes.NewK8sTLSProvider(clientset, f.cfg.Namespace, f.cfg.TLSSecretName), nil
+	provider := kubernetes.NewK8sTLSProvider(clientset, f.cfg.Namespace, f.cfg.TLSSecretName)
+	if !f.cfg.TLSLeaderElection {
+		return provider, nil
+	}
+	election := kubernetes.NewLeaderElection(clientset, f.cfg.Namespace, f.cfg.TLSLeaseName)
+	if err := election.Run(ctx); err != nil {
+		if f.cfg.TLSLeaderElectionSet {
+			return nil, fmt.Errorf("TLS_LEADER_ELECTION is enabled but the election cannot run: %w", err)
+		}
+		tlsLog.Warn("Leader election unavailable, renewing the certificate on every replica; grant access to the Lease or set TLS_LEADER_ELECTION=false",
+			"lease", f.cfg.TLSLeaseName, "error", err)
+		return provider, nil
+	}
+	return provider.WithLeaderElection(election), nil
 }
 
 func (f *TLSFactory) createMemoryProvider() (core.TLSProvider, error) {
-	logger.Info("Creating Memory TLS Provider")
+	tlsLog.Info("Creating Memory TLS Provider")
 	return memory.NewMemoryTLSProvider(), nil
 }
 
+func (f *TLSFactory) createVaultProvider(ctx context.Context) (core.TLSProvider, error) {
+	tlsLog.Info("Creating Vault TLS Provider",
+		"addr", f.cfg.TLSVaultAddr,
+		"auth", f.cfg.TLSVaultAuth,
+		"pki_role", f.cfg.TLSVaultPKIRole,
+		"kv_path", f.cfg.TLSVaultKVPath)
+	return vault.NewProvider(ctx, vault.Options{
+		Addr:      f.cfg.TLSVaultAddr,
+		Namespace: f.cfg.TLSVaultNamespace,
+		CAFile:    f.cfg.TLSVaultCAFile,
+		Auth:      f.cfg.TLSVaultAuth,
+		AuthMount: f.cfg.TLSVaultAuthMount,
+		Role:      f.cfg.TLSVaultRole,
+		JWTFile:   f.cfg.TLSVaultJWTFile,
+		RoleID:    f.cfg.TLSVaultRoleID,
+		SecretID:  f.cfg.TLSVaultSecretID,
+		Token:     f.cfg.TLSVaultToken,
+		PKIMount:  f.cfg.TLSVaultPKIMount,
+		PKIRole:   f.cfg.TLSVaultPKIRole,
+		KVMount:   f.cfg.TLSVaultKVMount,
+		KVPath:    f.cfg.TLSVaultKVPath,
+		Hosts:     f.cfg.TLSSANs,
+		Validity:  f.cfg.TLSCertValidity,
+	})
+}
+
+// createACMEProvider wraps provider to obtain its certificates over ACME.
+// The account key is kept next to them: a second file pair, a second Secret or memory.
+func (f *TLSFactory) createACMEProvider(provider core.TLSProvider, clientset *k8s.Clientset) (core.TLSProvider, error) {
+	var accountStore core.TLSProvider
+	switch f.cfg.TLSMode {
+	case config.TLSModeFile:
+		dir := filepath.Dir(f.cfg.TLSKeyFile)
+		certFile, keyFile := filepath.Join(dir, "acme-account.crt"), filepath.Join(dir, "acme-account.key")
+		tlsLog.Info("Using ACME account from files", "key", keyFile)
+		accountStore = filesystem.NewFileTLSProvider(certFile, keyFile)
+	case config.TLSModeKubernetes:
+		tlsLog.Info("Using ACME account from Kubernetes Secret", "namespace", f.cfg.Namespace, "secret", f.cfg.TLSACMEAccountSecretName)
+		accountStore = kubernetes.NewK8sTLSProvider(clientset, f.cfg.Namespace, f.cfg.TLSACMEAccountSecretName)
+	default:
+		tlsLog.Info("Using in-memory ACME account")
+		accountStore = memory.NewMemoryTLSProvider()
+	}
+
+	tlsLog.Info("Creating ACME TLS Provider",
+		"directory", f.cfg.TLSACMEDirectory,
+		"domains", f.cfg.TLSSANs,
+		"challenge", f.cfg.TLSACMEChallenge,
+		"key_algorithm", f.cfg.TLSKeyAlgorithm)
+	return acmetls.NewProvider(provider, accountStore, acmetls.Options{
+		DirectoryURL: f.cfg.TLSACMEDirectory,
+		Email:        f.cfg.TLSACMEEmail,
+		Domains:      f.cfg.TLSSANs,
+		Challenge:    f.cfg.TLSACMEChallenge,
+		DNSHook:      f.cfg.TLSACMEDNSHook,
+		CAFile:       f.cfg.TLSACMECAFile,
+		KeyAlgorithm: f.cfg.TLSKeyAlgorithm,
+	})
+}
+
 // EnsureCertificate ensures a valid certificate exists
 func (f *TLSFactory) EnsureCertificate(ctx context.Context, provider core.TLSProvider) error {
 	cert, err := provider.GetCertificate(ctx)
@@ -75,71 +200,415 @@ func (f *TLSFactory) EnsureCertificate(ctx context.Context, provider core.TLSPro
 		if !f.cfg.TLSAutoGenerate {
 			return fmt.Errorf("certificate not found and TLS_AUTO_GENERATE=false: %w", err)
 		}
-		logger.Info("Certificate not found. Generating new self-signed certificate...")
+		if election, ok := follower(provider); ok {
+			tlsLog.Info("Certificate not found. Waiting for the leader to generate it...")
+			return f.awaitLeader(ctx, provider, election)
+		}
+		tlsLog.Info("Certificate not found. Generating a new certificate...")
 		return f.generateAndStoreCertificate(ctx, provider)
 	}
 
 	// Certificate exists - validate it
-	if err := f.validateCertificate(cert, provider, ctx); err != nil {
-		return err
+	if err := f.validateCertificate(provider, cert, time.Now()); err != nil {
+		if !f.canRenew(provider, cert) {
+			if errors.Is(err, errCertificateExpiring) {
+				tlsLog.Warn("Certificate expires soon and is not renewed by the proxy", "reason", err)
+				return nil
+			}
+			return fmt.Errorf("certificate is not usable: %w", err)
+		}
+		if deferred, ok := provider.(deferredIssuer); ok && deferred.IssuesAfterStartup() {
+			tlsLog.Warn("Serving the current certificate until a new one is issued", "reason", err)
+			return nil
+		}
+		if election, ok := follower(provider); ok {
+			if errors.Is(err, errCertificateExpiring) {
+				tlsLog.Warn("Certificate expires soon and is renewed by the leader", "reason", err)
+				return nil
+			}
+			tlsLog.Warn("Waiting for the leader to renew the certificate", "reason", err)
+			return f.awaitLeader(ctx, provider, election)
+		}
+		tlsLog.Warn("Renewing certificate", "reason", err)
+		return f.renewCertificate(ctx, provider)
 	}
 
-	logger.Info("Certificate loaded and validated successfully")
+	tlsLog.Info("Certificate loaded and validated successfully")
 	return nil
 }
 
-func (f *TLSFactory) validateCertificate(cert interface{}, provider core.TLSProvider, ctx context.Context) error {
-	if !f.cfg.TLSAutoRenew {
-		logger.Info("Certificate validation skipped (TLS_AUTO_RENEW=false)")
-		return nil
+// errCertificateExpiring marks a certificate that is still valid but within
+// TLS_RENEWAL_THRESHOLD_DAYS of its expiry.
+var errCertificateExpiring = errors.New("certificate expires within the renewal threshold")
+
+// issuerVerifier is implemented by issuers that can tell whether they issued
+// a certificate, so a certificate from elsewhere is replaced.
+type issuerVerifier interface {
+	VerifyIssued(leaf *x509.Certificate) error
+}
+
+// deferredIssuer is implemented by issuers that need the proxy listener to be
+// serving, e.g. to answer ACME TLS-ALPN-01 challenges, so the certificate is
+// replaced by the renewal loop shortly after startup.
+type deferredIssuer interface {
+	IssuesAfterStartup() bool
+}
+
+// follower returns the provider's election when another replica leads it.
+func follower(provider core.TLSProvider) (core.CertificateElection, bool) {
+	election, ok := provider.(core.CertificateElection)
+	return election, ok && !election.IsLeader()
+}
+
+// awaitLeader waits until the leader stores a valid certificate, which the
+// provider's watch reports, or this instance becomes the leader and renews it
+// itself.
+func (f *TLSFactory) awaitLeader(ctx context.Context, provider core.TLSProvider, election core.CertificateElection) error {
+	watchCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	changed := make(chan struct{}, 1)
+	if watcher, ok := provider.(core.CertificateWatcher); ok {
+		err := watcher.WatchCertificate(watchCtx, func() {
+			select {
+			case changed <- struct{}{}:
+			default:
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	timeout := time.NewTimer(leaderCertificateTimeout)
+	defer timeout.Stop()
+	// Also catches a certificate stored before the watch started
+	ticker := time.NewTicker(leaderCertificateInterval)
+	defer ticker.Stop()
+	for {
+		if election.IsLeader() {
+			// A previous leader may have stored it meanwhile
+			cert, err := provider.GetCertificate(ctx)
+			if err != nil {
+				tlsLog.Info("Elected leader. Generating a new certificate...")
+				return f.generateAndStoreCertificate(ctx, provider)
+			}
+			if err := f.validateCertificate(provider, cert, time.Now()); err != nil && !errors.Is(err, errCertificateExpiring) {
+				tlsLog.Warn("Elected leader. Renewing certificate", "reason", err)
+				return f.renewCertificate(ctx, provider)
+			}
+			return nil
+		}
+		if cert, err := provider.GetCertificate(ctx); err == nil {
+			if err := f.validateCertificate(provider, cert, time.Now()); err == nil || errors.Is(err, errCertificateExpiring) {
+				tlsLog.Info("Loaded certificate stored by the leader")
+				return nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timeout.C:
+			return fmt.Errorf("no valid certificate stored by the leader within %s", leaderCertificateTimeout)
+		case <-changed:
+		case <-election.LeaderChanged():
+		case <-ticker.C:
+		}
+	}
+}
+
+// validateCertificate checks that the private key matches the certificate,
+// that the certificate is currently valid, comes from the provider's issuer and
+// covers every TLS_SANS entry, and that it is not due for renewal
+// (errCertificateExpiring).
+func (f *TLSFactory) validateCertificate(provider core.TLSProvider, cert *tls.Certificate, now time.Time) error {
+	leaf, err := leafCertificate(cert)
+	if err != nil {
+		return err
+	}
+
+	signer, ok := cert.PrivateKey.(crypto.Signer)
+	if !ok {
+		return fmt.Errorf("unsupported private key type %T", cert.PrivateKey)
+	}
+	if pub, ok := signer.Public().(interface{ Equal(crypto.PublicKey) bool }); !ok || !pub.Equal(leaf.PublicKey) {
+		return fmt.Errorf("private key does not match the certificate")
+	}
+
+	if now.Before(leaf.NotBefore) {
+		return fmt.Errorf("certificate is not valid before %s", leaf.NotBefore.UTC().Format(time.RFC3339))
+	}
+	if now.After(leaf.NotAfter) {
+		return fmt.Errorf("certificate expired at %s", leaf.NotAfter.UTC().Format(time.RFC3339))
+	}
+
+	if verifier, ok := provider.(issuerVerifier); ok {
+		if err := verifier.VerifyIssued(leaf); err != nil {
+			return err
+		}
 	}
 
-	// Note: Full certificate validation would include:
-	// 1. Parse the certificate
-	// 2. Check expiration date
-	// 3. Validate signature
-	// 4. Check certificate chain
+	for _, name := range f.cfg.TLSSANs {
+		if !covers(leaf, name) {
+			return fmt.Errorf("certificate does not cover %s", name)
+		}
+	}
 
-	logger.Info("Certificate validation passed")
+	if now.After(f.renewAt(leaf)) {
+		return fmt.Errorf("%w: expires at %s", errCertificateExpiring, leaf.NotAfter.UTC().Format(time.RFC3339))
+	}
 	return nil
 }
 
+// canRenew reports whether the proxy may replace cert: TLS_AUTO_RENEW is on and
+// the certificate either comes from the provider's issuer or is self-signed.
+// Certificates issued elsewhere are never overwritten.
+func (f *TLSFactory) canRenew(provider core.TLSProvider, cert *tls.Certificate) bool {
+	if !f.cfg.TLSAutoRenew {
+		return false
+	}
+	if _, ok := provider.(core.CertificateIssuer); ok {
+		return true
+	}
+	leaf, err := leafCertificate(cert)
+	if err != nil {
+		// Unreadable, so nothing worth keeping
+		return true
+	}
+	return leaf.CheckSignature(leaf.SignatureAlgorithm, leaf.RawTBSCertificate, leaf.Signature) == nil
+}
+
+// issueCertificate obtains a new certificate from the provider's issuer, or
+// generates a self-signed one for TLS_SANS.
+func (f *TLSFactory) issueCertificate(ctx context.Context, provider core.TLSProvider) ([]byte, []byte, error) {
+	if issuer, ok := provider.(core.CertificateIssuer); ok {
+		certPEM, keyPEM, err := issuer.IssueCertificate(ctx)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to issue certificate: %w", err)
+		}
+		return certPEM, keyPEM, nil
+	}
+	certPEM, keyPEM, err := utils.GenerateSelfSignedCert(utils.CertOptions{
+		Hosts:        f.cfg.CertificateHosts(),
+		KeyAlgorithm: f.cfg.TLSKeyAlgorithm,
+		Validity:     f.cfg.TLSCertValidity,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate self-signed certificate: %w", err)
+	}
+	return certPEM, keyPEM, nil
+}
+
 func (f *TLSFactory) generateAndStoreCertificate(ctx context.Context, provider core.TLSProvider) error {
-	certPEM, keyPEM, err := utils.GenerateSelfSignedCert()
+	certPEM, keyPEM, err := f.issueCertificate(ctx, provider)
 	if err != nil {
-		return fmt.Errorf("failed to generate self-signed certificate: %w", err)
+		return err
 	}
 
 	// Store the certificate (handles race condition for Kubernetes secrets)
 	if err := provider.Store(ctx, certPEM, keyPEM); err != nil {
 		// If store fails (possibly due to race condition), try to load again
-		logger.Warn("Failed to store certificate, attempting to load existing cert", "error", err)
+		tlsLog.Warn("Failed to store certificate, attempting to load existing cert", "error", err)
 		_, loadErr := provider.GetCertificate(ctx)
 		if loadErr != nil {
 			return fmt.Errorf("failed to load certificate after store failure: %w", loadErr)
 		}
-		logger.Info("Successfully loaded certificate created by another instance")
+		tlsLog.Info("Successfully loaded certificate created by another instance")
 		return nil
 	}
 
-	logger.Info("Successfully generated and stored self-signed certificate")
+	tlsLog.Info("Successfully generated and stored certificate")
+	return nil
+}
+
+// renewCertificate replaces the stored certificate with a new one.
+func (f *TLSFactory) renewCertificate(ctx context.Context, provider core.TLSProvider) error {
+	certPEM, keyPEM, err := f.issueCertificate(ctx, provider)
+	if err != nil {
+		return err
+	}
+	if err := provider.Store(ctx, certPEM, keyPEM); err != nil {
+		return fmt.Errorf("failed to store renewed certificate: %w", err)
+	}
+	tlsLog.Info("Successfully renewed and stored certificate")
 	return nil
 }
 
-// ValidateCertificateExpiry checks if certificate is expiring soon
-func ValidateCertificateExpiry(certPEM []byte, thresholdDays int) (bool, time.Time, error) {
-	block, _ := pem.Decode(certPEM)
-	if block == nil {
-		return false, time.Time{}, fmt.Errorf("failed to decode PEM certificate")
+// ShareSessionTicketKeys rotates the session ticket keys of certs through the
+// TLS provider until ctx is done, so replicas behind a load balancer resume
+// each other's sessions. Providers without shared storage leave each replica
+// with Go's own per-process keys.
+func (f *TLSFactory) ShareSessionTicketKeys(ctx context.Context, certs *certcache.Cache) {
+	if !f.cfg.TLSSessionTickets {
+		return
+	}
+	tickets.Rotate(ctx, certs.Provider(), f.cfg.TLSSessionTicketRotation, certs.SetSessionTicketKeys)
+}
+
+// WatchSNI serves the certificates of TLS_SNI_DIR and of the Secrets named by
+// annotated Services from certs by SNI, until ctx is done. A host name in the
+// directory takes precedence over the same name in a Secret.
+func (f *TLSFactory) WatchSNI(ctx context.Context, certs *certcache.Cache, clientset *k8s.Clientset) error {
+	var sources []core.SNICertificateSource
+	if f.cfg.TLSSNIDir != "" {
+		sources = append(sources, filesystem.NewSNIDirectory(f.cfg.TLSSNIDir))
 	}
+	if f.cfg.TLSSNISecrets {
+		if clientset == nil {
+			return fmt.Errorf("TLS_SNI_SECRETS requires kubernetes client (use DISCOVERY_MODE=kubernetes or provide KUBECONFIG)")
+		}
+		sources = append(sources, kubernetes.NewSNISecrets(clientset))
+	}
+
+	var mu sync.Mutex
+	loaded := make([]map[string]*tls.Certificate, len(sources))
+	for i, source := range sources {
+		err := source.WatchSNICertificates(ctx, func(sourceCerts map[string]*tls.Certificate) {
+			mu.Lock()
+			defer mu.Unlock()
+			loaded[i] = sourceCerts
+			merged := make(map[string]*tls.Certificate)
+			for j := len(loaded) - 1; j >= 0; j-- {
+				for name, cert := range loaded[j] {
+					merged[name] = cert
+				}
+			}
+			certs.SetSNICertificates(merged)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Renewal check bounds: the loop wakes at least hourly so a replaced
+// certificate is noticed, and at most once a minute so a certificate that is
+// issued already inside the threshold or keeps failing to renew cannot spin.
+const (
+	renewalCheckInterval = time.Hour
+	renewalRetryInterval = time.Minute
 
-	cert, err := x509.ParseCertificate(block.Bytes)
+	// leaderCertificateTimeout bounds how long a replica waits at startup for
+	// the leader to store a certificate.
+	leaderCertificateTimeout = 2 * time.Minute
+	// leaderCertificateInterval re-reads the certificate while waiting, in
+	// case a watch event was missed.
+	leaderCertificateInterval = 5 * time.Second
+
+	// startupRenewalDelay lets the listener start before a certificate that
+	// EnsureCertificate left for later is issued
+	startupRenewalDelay = 5 * time.Second
+)
+
+// RenewBeforeExpiry renews the certificate served by certs before it enters
+// the renewal threshold and swaps the new one in, until ctx is done.
+// It does nothing unless TLS_AUTO_RENEW is on.
+func (f *TLSFactory) RenewBeforeExpiry(ctx context.Context, certs *certcache.Cache) {
+	if !f.cfg.TLSAutoRenew {
+		return
+	}
+
+	go func() {
+		wait := f.nextRenewalCheck(certs.Certificate())
+		if f.validateCertificate(certs.Provider(), certs.Certificate(), time.Now()) != nil {
+			// Left for after startup by EnsureCertificate
+			wait = startupRenewalDelay
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(wait):
+			}
+			wait = f.checkRenewal(ctx, certs)
+		}
+	}()
+}
+
+// checkRenewal renews the served certificate if it needs it and returns the
+// time until the next check.
+func (f *TLSFactory) checkRenewal(ctx context.Context, certs *certcache.Cache) time.Duration {
+	provider, cert := certs.Provider(), certs.Certificate()
+	err := f.validateCertificate(provider, cert, time.Now())
+	if err == nil {
+		return f.nextRenewalCheck(cert)
+	}
+	if !f.canRenew(provider, cert) {
+		tlsLog.Warn("Certificate needs renewal but was not issued by the proxy", "reason", err)
+		return renewalCheckInterval
+	}
+	if _, ok := follower(provider); ok {
+		// The leader's certificate arrives through the watch
+		tlsLog.Debug("Certificate needs renewal, left to the leader", "reason", err)
+		return renewalRetryInterval
+	}
+	if _, ok := provider.(core.CertificateElection); ok {
+		// The previous leader may have renewed it just before handing over
+		if err := certs.Refresh(ctx); err == nil && f.validateCertificate(provider, certs.Certificate(), time.Now()) == nil {
+			return f.nextRenewalCheck(certs.Certificate())
+		}
+	}
+
+	tlsLog.Info("Renewing certificate", "reason", err)
+	if err := f.renewCertificate(ctx, provider); err != nil {
+		tlsLog.Error("Certificate renewal failed, keeping the current one", "error", err)
+		return renewalRetryInterval
+	}
+	if err := certs.Refresh(ctx); err != nil {
+		tlsLog.Error("Failed to load renewed certificate, keeping the current one", "error", err)
+		return renewalRetryInterval
+	}
+	if errors.Is(f.validateCertificate(provider, certs.Certificate(), time.Now()), errCertificateExpiring) {
+		tlsLog.Warn("Renewed certificate is valid for less than TLS_RENEWAL_THRESHOLD_DAYS")
+	}
+	return f.nextRenewalCheck(certs.Certificate())
+}
+
+// nextRenewalCheck returns the time until cert enters the renewal threshold,
+// bounded by the renewal check intervals.
+func (f *TLSFactory) nextRenewalCheck(cert *tls.Certificate) time.Duration {
+	leaf, err := leafCertificate(cert)
 	if err != nil {
-		return false, time.Time{}, fmt.Errorf("failed to parse certificate: %w", err)
+		return renewalRetryInterval
 	}
+	return min(max(time.Until(f.renewAt(leaf)), renewalRetryInterval), renewalCheckInterval)
+}
 
-	threshold := time.Now().AddDate(0, 0, thresholdDays)
-	isExpiring := cert.NotAfter.Before(threshold)
+// renewAt returns when leaf is due for renewal: TLS_RENEWAL_THRESHOLD_DAYS
+// before it expires, or after two thirds of its lifetime for short-lived
+// certificates such as those issued by the proxy CA.
+func (f *TLSFactory) renewAt(leaf *x509.Certificate) time.Time {
+	threshold := time.Duration(f.cfg.TLSRenewalThresholdDays) * 24 * time.Hour
+	threshold = min(threshold, leaf.NotAfter.Sub(leaf.NotBefore)/3)
+	return leaf.NotAfter.Add(-threshold)
+}
 
-	return isExpiring, cert.NotAfter, nil
+// covers reports whether leaf is valid for name. A wildcard name such as
+// *.db.example.com must be listed in the certificate as is.
+func covers(leaf *x509.Certificate, name string) bool {
+	if strings.HasPrefix(name, "*.") {
+		for _, dnsName := range leaf.DNSNames {
+			if strings.EqualFold(dnsName, name) {
+				return true
+			}
+		}
+		return false
+	}
+	return leaf.VerifyHostname(name) == nil
+}
+
+// leafCertificate returns the parsed leaf of cert.
+func leafCertificate(cert *tls.Certificate) (*x509.Certificate, error) {
+	if cert.Leaf != nil {
+		return cert.Leaf, nil
+	}
+	if len(cert.Certificate) == 0 {
+		return nil, fmt.Errorf("empty certificate chain")
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate: %w", err)
+	}
+	return leaf, nil
 }
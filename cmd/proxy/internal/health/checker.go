@@ -0,0 +1,254 @@
+package health
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/logger"
+)
+
+// CircuitState is the state of a backend's circuit breaker.
+type CircuitState string
+
+const (
+	CircuitClosed   CircuitState = "closed"    // traffic allowed
+	CircuitOpen     CircuitState = "open"      // traffic rejected until OpenDuration elapses
+	CircuitHalfOpen CircuitState = "half-open" // one trial connection allowed, its failure re-opens
+)
+
+// idleTTL is how long a backend keeps being probed after it was last resolved.
+// Tracked backends are probed regardless.
+const idleTTL = 10 * time.Minute
+
+// Options configures the checker.
+type Options struct {
+	Interval         time.Duration
+	Timeout          time.Duration
+	FailureThreshold int           // consecutive failures before the circuit opens
+	OpenDuration     time.Duration // time an open circuit rejects traffic before half-opening
+}
+
+// BackendStatus is a point-in-time view of one backend, exposed on the health API.
+type BackendStatus struct {
+	Address             string       `json:"address"`
+	Up                  bool         `json:"up"`
+	Circuit             CircuitState `json:"circuit"`
+	ConsecutiveFailures int          `json:"consecutive_failures"`
+	LastError           string       `json:"last_error,omitempty"`
+	LastCheck           time.Time    `json:"last_check,omitempty"`
+	LastUsed            time.Time    `json:"last_used"`
+}
+
+type backendState struct {
+	status   BackendStatus
+	openedAt time.Time
+	tracked  bool // registered by Track, exempt from idle eviction
+	trial    bool // a half-open trial connection is in flight
+}
+
+// Checker actively probes resolved backends and implements core.BackendHealth.
+// A backend is "down" as soon as a probe fails; it is only skipped by resolvers
+// once its circuit opens after FailureThreshold consecutive failures.
+type Checker struct {
+	opts   Options
+	prober Prober
+
+	backends map[string]*backendState
+	mu       sync.Mutex
+}
+
+func NewChecker(prober Prober, opts Options) *Checker {
+	if opts.Interval <= 0 {
+		opts.Interval = 5 * time.Second
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 2 * time.Second
+	}
+	if opts.FailureThreshold <= 0 {
+		opts.FailureThreshold = 3
+	}
+	if opts.OpenDuration <= 0 {
+		opts.OpenDuration = 30 * time.Second
+	}
+	return &Checker{
+		opts:     opts,
+		prober:   prober,
+		backends: make(map[string]*backendState),
+	}
+}
+
+// Start runs the probe loop until ctx is cancelled.
+func (c *Checker) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(c.opts.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				c.probeAll(ctx)
+			}
+		}
+	}()
+}
+
+// Track registers the configured backends (static routes, a route catalog)
+// for probing without marking them as used. They are probed until the next
+// Track call no longer lists them, after which they are evicted once idle.
+func (c *Checker) Track(addrs ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, state := range c.backends {
+		state.tracked = false
+	}
+	for _, addr := range addrs {
+		c.get(addr).tracked = true
+	}
+}
+
+// IsHealthy implements core.BackendHealth.
+func (c *Checker) IsHealthy(addr string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	state := c.get(addr)
+	state.status.LastUsed = time.Now()
+
+	switch state.status.Circuit {
+	case CircuitOpen:
+		if time.Since(state.openedAt) < c.opts.OpenDuration {
+			return false
+		}
+		state.status.Circuit = CircuitHalfOpen
+		logger.Info("Backend circuit half-open", "backend_addr", addr)
+	case CircuitHalfOpen:
+		// Only one trial at a time. A trial that is never dialed is settled
+		// by the next probe, which closes or re-opens the circuit.
+		if state.trial {
+			return false
+		}
+	default:
+		return true
+	}
+	state.trial = true
+	return true
+}
+
+// ReportSuccess implements core.BackendHealth.
+func (c *Checker) ReportSuccess(addr string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.recordSuccess(c.get(addr))
+}
+
+// ReportFailure implements core.BackendHealth.
+func (c *Checker) ReportFailure(addr string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.recordFailure(c.get(addr), err)
+}
+
+// Snapshot returns the state of all tracked backends, sorted by address.
+func (c *Checker) Snapshot() []BackendStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	out := make([]BackendStatus, 0, len(c.backends))
+	for _, state := range c.backends {
+		out = append(out, state.status)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Address < out[j].Address })
+	return out
+}
+
+// get returns the state for addr, creating it if needed. Caller holds c.mu.
+func (c *Checker) get(addr string) *backendState {
+	state, ok := c.backends[addr]
+	if !ok {
+		state = &backendState{status: BackendStatus{
+			Address:  addr,
+			Up:       true,
+			Circuit:  CircuitClosed,
+			LastUsed: time.Now(),
+		}}
+		c.backends[addr] = state
+	}
+	return state
+}
+
+func (c *Checker) recordSuccess(state *backendState) {
+	if state.status.Circuit != CircuitClosed || !state.status.Up {
+		logger.Info("Backend is healthy", "backend_addr", state.status.Address)
+	}
+	state.status.Up = true
+	state.status.Circuit = CircuitClosed
+	state.trial = false
+	state.status.ConsecutiveFailures = 0
+	state.status.LastError = ""
+}
+
+func (c *Checker) recordFailure(state *backendState, err error) {
+	state.status.Up = false
+	state.status.ConsecutiveFailures++
+	state.trial = false
+	if err != nil {
+		state.status.LastError = err.Error()
+	}
+
+	switch {
+	case state.status.Circuit == CircuitHalfOpen,
+		state.status.Circuit == CircuitClosed && state.status.ConsecutiveFailures >= c.opts.FailureThreshold:
+		state.status.Circuit = CircuitOpen
+		state.openedAt = time.Now()
+		logger.Warn("Backend circuit opened",
+			"backend_addr", state.status.Address,
+			"consecutive_failures", state.status.ConsecutiveFailures,
+			"error", err)
+	case state.status.Circuit == CircuitOpen:
+		// Keep rejecting traffic for a full OpenDuration after the latest failure
+		state.openedAt = time.Now()
+	}
+}
+
+func (c *Checker) probeAll(ctx context.Context) {
+	c.mu.Lock()
+	addrs := make([]string, 0, len(c.backends))
+	for addr, state := range c.backends {
+		if !state.tracked && time.Since(state.status.LastUsed) > idleTTL {
+			delete(c.backends, addr)
+			continue
+		}
+		addrs = append(addrs, addr)
+	}
+	c.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, addr := range addrs {
+		wg.Add(1)
+		go func(addr string) {
+			defer wg.Done()
+
+			probeCtx, cancel := context.WithTimeout(ctx, c.opts.Timeout)
+			defer cancel()
+			err := c.prober(probeCtx, addr)
+
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			state, ok := c.backends[addr]
+			if !ok {
+				return
+			}
+			state.status.LastCheck = time.Now()
+			if err != nil {
+				logger.Debug("Backend health probe failed", "backend_addr", addr, "error", err)
+				c.recordFailure(state, err)
+			} else {
+				c.recordSuccess(state)
+			}
+		}(addr)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,47 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestHalfOpenAdmitsOneTrial(t *testing.T) {
+	c := NewChecker(func(context.Context, string) error { return nil }, Options{
+		FailureThreshold: 1,
+		OpenDuration:     50 * time.Millisecond,
+	})
+	const addr = "10.0.0.1:5432"
+
+	c.ReportFailure(addr, errors.New("refused"))
+	if c.IsHealthy(addr) {
+		t.Fatal("open circuit admitted traffic")
+	}
+	time.Sleep(60 * time.Millisecond)
+
+	if !c.IsHealthy(addr) {
+		t.Fatal("half-open circuit rejected the trial connection")
+	}
+	if c.IsHealthy(addr) {
+		t.Fatal("half-open circuit admitted a second connection during the trial")
+	}
+
+	// A failed trial re-opens the circuit
+	c.ReportFailure(addr, errors.New("refused"))
+	if c.IsHealthy(addr) {
+		t.Fatal("failed trial did not re-open the circuit")
+	}
+	time.Sleep(60 * time.Millisecond)
+
+	// A successful trial closes it
+	if !c.IsHealthy(addr) {
+		t.Fatal("half-open circuit rejected the trial connection")
+	}
+	c.ReportSuccess(addr)
+	for i := 0; i < 2; i++ {
+		if !c.IsHealthy(addr) {
+			t.Fatal("closed circuit rejected traffic")
+		}
+	}
+}
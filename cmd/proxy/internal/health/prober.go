@@ -0,0 +1,37 @@
+package health
+
+import (
+	"context"
+	"net"
+
+	postgresql_probe "github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/probe/postgresql"
+)
+
+// Prober checks a single backend address. The context carries the probe timeout.
+type Prober func(ctx context.Context, addr string) error
+
+// TCPProber only checks that the backend accepts TCP connections.
+func TCPProber() Prober {
+	return func(ctx context.Context, addr string) error {
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+}
+
+// PostgresProber logs into the backend and runs SELECT 1.
+func PostgresProber(opts postgresql_probe.Options) Prober {
+	return func(ctx context.Context, addr string) error {
+		client, err := postgresql_probe.Connect(ctx, addr, opts)
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		_, err = client.QueryRow("SELECT 1")
+		return err
+	}
+}
@@ -0,0 +1,112 @@
+package logger
+
+import (
+	"log/slog"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// Components with their own logger
+const (
+	ComponentResolver = "resolver"
+	ComponentTLS      = "tls"
+	ComponentPostgres = "postgres"
+	ComponentAPI      = "api"
+)
+
+var (
+	components   = make(map[string]*Logger)
+	componentsMu sync.Mutex
+)
+
+// Logger is a component logger. Its records carry a "component" attribute and
+// are filtered by the component's level, which falls back to the global level.
+type Logger struct {
+	name       string
+	level      slog.LevelVar
+	overridden atomic.Bool
+
+	once   sync.Once
+	logger *slog.Logger
+}
+
+// Component returns the logger for name. It is safe to call before Init,
+// e.g. from a package-level variable.
+func Component(name string) *Logger {
+	componentsMu.Lock()
+	defer componentsMu.Unlock()
+	c, ok := components[name]
+	if !ok {
+		c = &Logger{name: name}
+		components[name] = c
+	}
+	return c
+}
+
+// SetComponentLevel overrides the level of component name.
+func SetComponentLevel(name string, l slog.Level) {
+	c := Component(name)
+	c.level.Set(l)
+	c.overridden.Store(true)
+}
+
+// ResetComponentLevel makes component name follow the global level again.
+func ResetComponentLevel(name string) {
+	Component(name).overridden.Store(false)
+}
+
+// ComponentLevels returns the effective level of every known component.
+func ComponentLevels() map[string]string {
+	componentsMu.Lock()
+	defer componentsMu.Unlock()
+	levels := make(map[string]string, len(components))
+	for name, c := range components {
+		levels[name] = c.Level().String()
+	}
+	return levels
+}
+
+// ComponentNames returns the known component names, sorted.
+func ComponentNames() []string {
+	componentsMu.Lock()
+	defer componentsMu.Unlock()
+	names := make([]string, 0, len(components))
+	for name := range components {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Level returns the component's effective level.
+func (c *Logger) Level() slog.Level {
+	if c.overridden.Load() {
+		return c.level.Level()
+	}
+	return level.Level()
+}
+
+// Slog returns the underlying slog.Logger.
+func (c *Logger) Slog() *slog.Logger {
+	c.once.Do(func() {
+		if defaultLogger == nil {
+			Init()
+		}
+		handler := baseHandler.WithAttrs([]slog.Attr{slog.String("component", c.name)})
+		c.logger = slog.New(&levelHandler{inner: handler, min: c.Level})
+	})
+	return c.logger
+}
+
+// Debug logs at Debug level.
+func (c *Logger) Debug(msg string, args ...any) { c.Slog().Debug(msg, args...) }
+
+// Info logs at Info level.
+func (c *Logger) Info(msg string, args ...any) { c.Slog().Info(msg, args...) }
+
+// Warn logs at Warn level.
+func (c *Logger) Warn(msg string, args ...any) { c.Slog().Warn(msg, args...) }
+
+// Error logs at Error level.
+func (c *Logger) Error(msg string, args ...any) { c.Slog().Error(msg, args...) }
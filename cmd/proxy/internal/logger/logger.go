@@ -2,37 +2,128 @@ package logger
 
 import (
 	"context"
+	"io"
 	"log/slog"
+	"net"
 	"os"
+	"strings"
 	"sync"
 )
 
 var (
 	defaultLogger *slog.Logger
+	baseHandler   slog.Handler
+	level         = new(slog.LevelVar)
 	once          sync.Once
 )
 
+// Options configures the global logger.
+type Options struct {
+	Level         string   // debug, info, warn or error; defaults to info
+	Format        string   // text or json
+	StartupParams []string // replaces the StartupMessage keys logged in clear, if set
+}
+
 // Init initializes the global logger based on environment variables.
-// DEBUG=true enables debug level logging.
+// LOG_LEVEL selects the level (debug, info, warn, error); DEBUG=true is kept as
+// a shorthand for LOG_LEVEL=debug. LOG_FORMAT=json switches to JSON output.
+// LOG_STARTUP_PARAMS replaces the comma-separated allowlist of StartupMessage
+// keys logged in clear.
 func Init() {
+	opts := Options{Level: os.Getenv("LOG_LEVEL"), Format: os.Getenv("LOG_FORMAT")}
+	if opts.Level == "" && os.Getenv("DEBUG") == "true" {
+		opts.Level = "debug"
+	}
+	if env := os.Getenv("LOG_STARTUP_PARAMS"); env != "" {
+		opts.StartupParams = strings.Split(env, ",")
+	}
+	InitWithOptions(opts)
+}
+
+// InitWithOptions initializes the global logger from opts. Only the first
+// initialization takes effect.
+func InitWithOptions(o Options) {
 	once.Do(func() {
-		level := slog.LevelInfo
-		if os.Getenv("DEBUG") == "true" {
-			level = slog.LevelDebug
+		if len(o.StartupParams) > 0 {
+			SetStartupParamAllowlist(o.StartupParams)
 		}
 
-		opts := &slog.HandlerOptions{
-			Level: level,
-			// Add source file information if in debug mode
-			AddSource: level == slog.LevelDebug,
+		level.Set(slog.LevelInfo)
+		if l, err := ParseLevel(o.Level); err == nil {
+			level.Set(l)
 		}
 
-		handler := slog.NewTextHandler(os.Stdout, opts)
-		defaultLogger = slog.New(handler)
+		// Add source file information if started in debug mode
+		opts := handlerOptions(level.Level() == slog.LevelDebug)
+		baseHandler = newHandler(o.Format, os.Stdout, opts)
+		defaultLogger = slog.New(&levelHandler{inner: baseHandler, min: level.Level})
 		slog.SetDefault(defaultLogger)
 	})
 }
 
+// handlerOptions returns the options of every handler; they redact secrets
+// before a record is written.
+func handlerOptions(addSource bool) *slog.HandlerOptions {
+	return &slog.HandlerOptions{
+		// Filtering is done by levelHandler so levels can change at runtime
+		Level:     slog.LevelDebug,
+		AddSource: addSource,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			// Render addresses as host:port instead of their struct fields in JSON
+			if addr, ok := a.Value.Any().(net.Addr); ok && a.Value.Kind() == slog.KindAny {
+				return slog.String(a.Key, addr.String())
+			}
+			return redactAttr(a)
+		},
+	}
+}
+
+func newHandler(format string, w io.Writer, opts *slog.HandlerOptions) slog.Handler {
+	if strings.EqualFold(format, "json") {
+		return slog.NewJSONHandler(w, opts)
+	}
+	return slog.NewTextHandler(w, opts)
+}
+
+// ParseLevel parses a level name such as "debug" or "WARN".
+func ParseLevel(s string) (slog.Level, error) {
+	var l slog.Level
+	err := l.UnmarshalText([]byte(s))
+	return l, err
+}
+
+// SetLevel changes the global log level at runtime.
+func SetLevel(l slog.Level) {
+	level.Set(l)
+}
+
+// GetLevel returns the global log level.
+func GetLevel() slog.Level {
+	return level.Level()
+}
+
+// levelHandler filters records against a level that can change at runtime.
+type levelHandler struct {
+	inner slog.Handler
+	min   func() slog.Level
+}
+
+func (h *levelHandler) Enabled(ctx context.Context, l slog.Level) bool {
+	return l >= h.min() && h.inner.Enabled(ctx, l)
+}
+
+func (h *levelHandler) Handle(ctx context.Context, r slog.Record) error {
+	return h.inner.Handle(ctx, r)
+}
+
+func (h *levelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &levelHandler{inner: h.inner.WithAttrs(attrs), min: h.min}
+}
+
+func (h *levelHandler) WithGroup(name string) slog.Handler {
+	return &levelHandler{inner: h.inner.WithGroup(name), min: h.min}
+}
+
 // Debug logs at Debug level.
 func Debug(msg string, args ...any) {
 	if defaultLogger == nil {
@@ -0,0 +1,111 @@
+package logger
+
+import (
+	"log/slog"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Redacted replaces values that must not be logged.
+const Redacted = "[REDACTED]"
+
+// defaultStartupParams are the StartupMessage keys logged in clear. Everything
+// else (options, application_name, ...) may carry secrets or customer data.
+var defaultStartupParams = []string{
+	"user", "database", "client_encoding", "DateStyle", "TimeZone",
+	"replication", "target_session_attrs", "deployment_id", "pooled", "username", "role",
+}
+
+var (
+	startupAllowlist   map[string]bool
+	startupAllowlistMu sync.RWMutex
+)
+
+var (
+	// sensitiveKey matches attribute keys whose value is always redacted
+	sensitiveKey = regexp.MustCompile(`(?i)(passw(or)?d|pwd|secret|token|api[_-]?key|credential|private[_-]?key)`)
+	// sensitiveAssignment matches "password=..." style fragments inside values, e.g. in options
+	sensitiveAssignment = regexp.MustCompile(`(?i)((?:passw(?:or)?d|pwd|secret|token|api[_-]?key)\s*[=:]\s*)('[^']*'|"[^"]*"|[^\s&;,]+)`)
+	// urlWithPassword matches URLs with a password in the user info
+	urlWithPassword = regexp.MustCompile(`[a-zA-Z][a-zA-Z0-9+.-]*://[^\s/@:]+:[^\s/@]+@[^\s]+`)
+)
+
+func init() {
+	SetStartupParamAllowlist(defaultStartupParams)
+}
+
+// SetStartupParamAllowlist sets the StartupMessage keys that may be logged in clear.
+func SetStartupParamAllowlist(keys []string) {
+	allow := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		if k = strings.TrimSpace(k); k != "" {
+			allow[k] = true
+		}
+	}
+	startupAllowlistMu.Lock()
+	startupAllowlist = allow
+	startupAllowlistMu.Unlock()
+}
+
+// ResetStartupParamAllowlist restores the default StartupMessage keys logged in clear.
+func ResetStartupParamAllowlist() {
+	SetStartupParamAllowlist(defaultStartupParams)
+}
+
+// StartupParams returns params as a log group, with keys outside the allowlist
+// and password-like values redacted.
+func StartupParams(key string, params map[string]string) slog.Attr {
+	startupAllowlistMu.RLock()
+	defer startupAllowlistMu.RUnlock()
+
+	attrs := make([]any, 0, len(params))
+	for k, v := range params {
+		if !startupAllowlist[k] || sensitiveKey.MatchString(k) {
+			v = Redacted
+		}
+		attrs = append(attrs, slog.String(k, v))
+	}
+	return slog.Group(key, attrs...)
+}
+
+// RedactString masks password-like fragments and URL passwords in s.
+func RedactString(s string) string {
+	s = sensitiveAssignment.ReplaceAllString(s, "${1}"+Redacted)
+	return urlWithPassword.ReplaceAllStringFunc(s, func(raw string) string {
+		u, err := url.Parse(raw)
+		if err != nil {
+			return Redacted
+		}
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), "xxxxx")
+		}
+		return u.String()
+	})
+}
+
+// redactAttr is applied to every attribute before it reaches a handler.
+func redactAttr(a slog.Attr) slog.Attr {
+	if a.Value.Kind() == slog.KindGroup {
+		return a
+	}
+	if sensitiveKey.MatchString(a.Key) {
+		return slog.String(a.Key, Redacted)
+	}
+	switch a.Value.Kind() {
+	case slog.KindString:
+		if v := a.Value.String(); v != "" {
+			if redacted := RedactString(v); redacted != v {
+				return slog.String(a.Key, redacted)
+			}
+		}
+	case slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok {
+			if msg := err.Error(); RedactString(msg) != msg {
+				return slog.String(a.Key, RedactString(msg))
+			}
+		}
+	}
+	return a
+}
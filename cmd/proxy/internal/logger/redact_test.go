@@ -0,0 +1,88 @@
+package logger
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+const secret = "hunter2"
+
+func TestHandlersRedactSecrets(t *testing.T) {
+	tests := []struct {
+		name string
+		with []any // attributes added through Logger.With
+		args []any
+		keep string // a value that must still be logged
+	}{
+		{name: "password key", args: []any{"password", secret}},
+		{name: "prefixed key", args: []any{"db_password", secret}},
+		{name: "token key", args: []any{slog.String("token", secret)}},
+		{name: "secret key", args: []any{"client_secret", secret}},
+		{name: "api key", args: []any{"api-key", secret}},
+		{name: "private key", args: []any{"private_key", secret}},
+		{name: "credential key", args: []any{"credentials", []byte(secret)}},
+		{name: "assignment in value", args: []any{"options", "-c password=" + secret + " -c work_mem=64MB"}, keep: "work_mem=64MB"},
+		{name: "quoted assignment", args: []any{"dsn", "host=db password='" + secret + "' user=alice"}, keep: "user=alice"},
+		{name: "url password", args: []any{"url", "postgres://alice:" + secret + "@db:5432/app"}, keep: "alice"},
+		{name: "error", args: []any{"error", errors.New("login failed: token=" + secret)}, keep: "login failed"},
+		{name: "group", args: []any{slog.Group("auth", slog.String("user", "alice"), slog.String("password", secret))}, keep: "alice"},
+		{name: "with attrs", with: []any{"secret", secret}, args: []any{"user", "alice"}, keep: "alice"},
+		{
+			name: "startup params",
+			args: []any{StartupParams("params", map[string]string{
+				"user":             "alice",
+				"options":          "-c search_path=" + secret,
+				"application_name": secret,
+				"password":         secret,
+			})},
+			keep: "alice",
+		},
+	}
+
+	for _, format := range []string{"text", "json"} {
+		for _, tt := range tests {
+			t.Run(format+"/"+tt.name, func(t *testing.T) {
+				var buf bytes.Buffer
+				logger := slog.New(newHandler(format, &buf, handlerOptions(false)))
+				if tt.with != nil {
+					logger = logger.With(tt.with...)
+				}
+				logger.Info("test", tt.args...)
+
+				out := buf.String()
+				if strings.Contains(out, secret) {
+					t.Errorf("secret logged: %s", out)
+				}
+				if !strings.Contains(out, Redacted) && !strings.Contains(out, "xxxxx") {
+					t.Errorf("no redaction marker: %s", out)
+				}
+				if tt.keep != "" && !strings.Contains(out, tt.keep) {
+					t.Errorf("%q was redacted too: %s", tt.keep, out)
+				}
+			})
+		}
+	}
+}
+
+func TestStartupParamAllowlist(t *testing.T) {
+	defer ResetStartupParamAllowlist()
+	SetStartupParamAllowlist([]string{"user", "application_name", "password"})
+
+	var buf bytes.Buffer
+	slog.New(newHandler("json", &buf, handlerOptions(false))).Info("test", StartupParams("params", map[string]string{
+		"user":             "alice",
+		"application_name": "psql",
+		"password":         secret, // allowlisted, but a sensitive key is never logged
+		"database":         "app",  // not allowlisted
+	}))
+
+	out := buf.String()
+	for _, want := range []string{`"user":"alice"`, `"application_name":"psql"`, `"password":"[REDACTED]"`, `"database":"[REDACTED]"`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("want %s in %s", want, out)
+		}
+	}
+}
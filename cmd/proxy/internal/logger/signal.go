@@ -0,0 +1,31 @@
+package logger
+
+import (
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// ToggleDebugOnSignal switches the global level to debug on SIGUSR1 and back
+// to the previous level on the next SIGUSR1.
+func ToggleDebugOnSignal() {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGUSR1)
+
+	go func() {
+		previous := GetLevel()
+		if previous <= slog.LevelDebug {
+			previous = slog.LevelInfo
+		}
+		for range sigCh {
+			if GetLevel() > slog.LevelDebug {
+				previous = GetLevel()
+				SetLevel(slog.LevelDebug)
+			} else {
+				SetLevel(previous)
+			}
+			Info("Log level changed by SIGUSR1", "level", GetLevel().String())
+		}
+	}()
+}
@@ -0,0 +1,156 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/core"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "xdatabase_proxy"
+
+// Byte counter directions
+const (
+	DirectionClientToBackend = "client_to_backend"
+	DirectionBackendToClient = "backend_to_client"
+)
+
+var registry = prometheus.NewRegistry()
+
+var (
+	connectionsActive = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "connections_active",
+		Help:      "Number of client connections currently proxied to a backend.",
+	}, []string{"deployment_id", "pooled", "database_type"})
+
+	connectionsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "connections_total",
+		Help:      "Total number of client connections proxied to a backend.",
+	}, []string{"deployment_id", "pooled", "database_type"})
+
+	bytesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "bytes_total",
+		Help:      "Bytes proxied between clients and backends.",
+	}, []string{"deployment_id", "direction"})
+
+	handshakeDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "handshake_duration_seconds",
+		Help:      "Time spent on the client protocol handshake, including TLS.",
+		Buckets:   prometheus.DefBuckets,
+	})
+
+	resolveDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "resolve_duration_seconds",
+		Help:      "Time spent resolving backend candidates.",
+		Buckets:   []float64{.0001, .0005, .001, .005, .01, .05, .1, .5, 1, 5},
+	})
+
+	dialDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "dial_duration_seconds",
+		Help:      "Time spent connecting to a backend, including retries.",
+		Buckets:   prometheus.DefBuckets,
+	})
+
+	resolutionFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "resolution_failures_total",
+		Help:      "Backend resolution failures by reason.",
+	}, []string{"reason"})
+
+	tlsHandshakeFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tls_handshake_failures_total",
+		Help:      "Failed client TLS handshakes.",
+	})
+
+	certificateExpiry = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "certificate_expiry_timestamp_seconds",
+		Help:      "Expiry time of the served TLS certificate as a Unix timestamp.",
+	})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		connectionsActive,
+		connectionsTotal,
+		bytesTotal,
+		handshakeDuration,
+		resolveDuration,
+		dialDuration,
+		resolutionFailures,
+		tlsHandshakeFailures,
+		certificateExpiry,
+	)
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{Registry: registry})
+}
+
+// ConnectionOpened records a new proxied connection.
+func ConnectionOpened(metadata core.RoutingMetadata, databaseType core.DatabaseType) {
+	deploymentID, pooled := metadata["deployment_id"], metadata["pooled"]
+	connectionsActive.WithLabelValues(deploymentID, pooled, string(databaseType)).Inc()
+	connectionsTotal.WithLabelValues(deploymentID, pooled, string(databaseType)).Inc()
+}
+
+// ConnectionClosed records the end of a proxied connection.
+func ConnectionClosed(metadata core.RoutingMetadata, databaseType core.DatabaseType) {
+	connectionsActive.WithLabelValues(metadata["deployment_id"], metadata["pooled"], string(databaseType)).Dec()
+}
+
+// BytesCounter returns the counter for bytes proxied in direction.
+func BytesCounter(metadata core.RoutingMetadata, direction string) prometheus.Counter {
+	return bytesTotal.WithLabelValues(metadata["deployment_id"], direction)
+}
+
+func ObserveHandshake(d time.Duration) { handshakeDuration.Observe(d.Seconds()) }
+func ObserveResolve(d time.Duration)   { resolveDuration.Observe(d.Seconds()) }
+func ObserveDial(d time.Duration)      { dialDuration.Observe(d.Seconds()) }
+
+// ResolutionFailed records a failed resolution, classified by err.
+func ResolutionFailed(err error) {
+	resolutionFailures.WithLabelValues(failureReason(err)).Inc()
+}
+
+func TLSHandshakeFailed() { tlsHandshakeFailures.Inc() }
+
+// SetCertificateExpiry publishes the NotAfter of the served certificate.
+func SetCertificateExpiry(notAfter time.Time) {
+	certificateExpiry.Set(float64(notAfter.Unix()))
+}
+
+func failureReason(err error) string {
+	var waking *core.WakingError
+	switch {
+	case errors.As(err, &waking):
+		return "waking"
+	case errors.Is(err, core.ErrAccessDenied):
+		return "access_denied"
+	case errors.Is(err, core.ErrMissingDeploymentID):
+		return "missing_deployment_id"
+	case errors.Is(err, core.ErrNoHealthyBackend):
+		return "unhealthy"
+	case errors.Is(err, core.ErrBackendNotFound):
+		return "not_found"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	default:
+		return "other"
+	}
+}
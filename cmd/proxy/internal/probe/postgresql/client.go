@@ -0,0 +1,478 @@
+package postgresql_probe
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	protocolVersion3 = 196608
+	sslRequestCode   = 80877103
+
+	authOK                = 0
+	authCleartextPassword = 3
+	authMD5Password       = 5
+	authSASL              = 10
+	authSASLContinue      = 11
+	authSASLFinal         = 12
+)
+
+// SSLMode controls whether the probe encrypts its connection, with the
+// libpq meaning of the values. The server certificate is not verified.
+type SSLMode string
+
+const (
+	SSLDisable SSLMode = "disable"
+	SSLPrefer  SSLMode = "prefer"
+	SSLRequire SSLMode = "require"
+)
+
+// SSLModes lists the supported SSL modes.
+var SSLModes = []SSLMode{SSLDisable, SSLPrefer, SSLRequire}
+
+// Options holds the credentials used by the probe to log into a backend.
+type Options struct {
+	User     string
+	Password string
+	Database string
+	SSLMode  SSLMode // defaults to SSLPrefer
+	Timeout  time.Duration
+}
+
+// Client is a minimal PostgreSQL frontend used for backend probing.
+// It only supports the simple query protocol and the authentication methods
+// commonly found in front of managed clusters (trust, password, md5, SCRAM-SHA-256).
+type Client struct {
+	conn net.Conn
+	rd   *bufio.Reader
+	tls  bool
+}
+
+// Connect dials the backend and completes the startup/authentication phase.
+func Connect(ctx context.Context, addr string, opts Options) (*Client, error) {
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = 3 * time.Second
+	}
+
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("dial %s: %w", addr, err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	_ = conn.SetDeadline(deadline)
+
+	host, _, _ := net.SplitHostPort(addr)
+	c, err := newClient(conn, host, opts)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// newClient negotiates TLS on an established connection and logs in.
+func newClient(conn net.Conn, host string, opts Options) (*Client, error) {
+	c := &Client{conn: conn}
+	if opts.SSLMode != SSLDisable {
+		if err := c.negotiateTLS(host, opts.SSLMode); err != nil {
+			return nil, err
+		}
+	}
+	c.rd = bufio.NewReader(c.conn)
+	if err := c.startup(opts); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// negotiateTLS sends an SSLRequest and upgrades the connection when the
+// server accepts it. A refusal is only an error under SSLRequire.
+func (c *Client) negotiateTLS(host string, mode SSLMode) error {
+	req := binary.BigEndian.AppendUint32(nil, 8)
+	req = binary.BigEndian.AppendUint32(req, sslRequestCode)
+	if _, err := c.conn.Write(req); err != nil {
+		return fmt.Errorf("write SSL request: %w", err)
+	}
+
+	answer := make([]byte, 1)
+	if _, err := io.ReadFull(c.conn, answer); err != nil {
+		return fmt.Errorf("read SSL response: %w", err)
+	}
+	switch answer[0] {
+	case 'S':
+		// Like libpq's sslmode=require, the probe only wants an encrypted
+		// channel; it has no CA to check the backend certificate against.
+		tlsConn := tls.Client(c.conn, &tls.Config{
+			ServerName:         host,
+			InsecureSkipVerify: true,
+			MinVersion:         tls.VersionTLS12,
+		})
+		if err := tlsConn.Handshake(); err != nil {
+			return fmt.Errorf("TLS handshake: %w", err)
+		}
+		c.conn = tlsConn
+		c.tls = true
+		return nil
+	case 'N':
+		if mode == SSLRequire {
+			return fmt.Errorf("server does not support SSL, but sslmode=require")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unexpected SSL response: %q", answer[0])
+	}
+}
+
+// Close sends Terminate and closes the connection.
+func (c *Client) Close() error {
+	_ = c.writeMessage('X', nil)
+	return c.conn.Close()
+}
+
+// QueryRow runs a simple query and returns the text values of the first row.
+func (c *Client) QueryRow(sql string) ([]string, error) {
+	if err := c.writeMessage('Q', append([]byte(sql), 0)); err != nil {
+		return nil, err
+	}
+
+	var row []string
+	var queryErr error
+	for {
+		typ, body, err := c.readMessage()
+		if err != nil {
+			return nil, err
+		}
+		switch typ {
+		case 'D':
+			if row == nil {
+				row, err = parseDataRow(body)
+				if err != nil {
+					return nil, err
+				}
+			}
+		case 'E':
+			queryErr = parseError(body)
+		case 'Z':
+			if queryErr != nil {
+				return nil, queryErr
+			}
+			if row == nil {
+				return nil, fmt.Errorf("query returned no rows")
+			}
+			return row, nil
+		}
+	}
+}
+
+func (c *Client) startup(opts Options) error {
+	database := opts.Database
+	if database == "" {
+		database = "postgres"
+	}
+
+	var payload []byte
+	payload = binary.BigEndian.AppendUint32(payload, protocolVersion3)
+	for _, kv := range [][2]string{{"user", opts.User}, {"database", database}, {"application_name", "xdatabase-proxy-probe"}} {
+		payload = append(payload, kv[0]...)
+		payload = append(payload, 0)
+		payload = append(payload, kv[1]...)
+		payload = append(payload, 0)
+	}
+	payload = append(payload, 0)
+
+	msg := binary.BigEndian.AppendUint32(nil, uint32(4+len(payload)))
+	if _, err := c.conn.Write(append(msg, payload...)); err != nil {
+		return fmt.Errorf("write startup message: %w", err)
+	}
+
+	var scram *scramSession
+	for {
+		typ, body, err := c.readMessage()
+		if err != nil {
+			return err
+		}
+		switch typ {
+		case 'E':
+			return parseError(body)
+		case 'R':
+			if len(body) < 4 {
+				return fmt.Errorf("malformed authentication message")
+			}
+			code := binary.BigEndian.Uint32(body[0:4])
+			switch code {
+			case authOK:
+			case authCleartextPassword:
+				if !c.tls {
+					return fmt.Errorf("server requested a cleartext password on an unencrypted connection")
+				}
+				if err := c.writeMessage('p', append([]byte(opts.Password), 0)); err != nil {
+					return err
+				}
+			case authMD5Password:
+				if len(body) < 8 {
+					return fmt.Errorf("malformed md5 authentication request")
+				}
+				if err := c.writeMessage('p', append([]byte(md5Password(opts.User, opts.Password, body[4:8])), 0)); err != nil {
+					return err
+				}
+			case authSASL:
+				if !bytes.Contains(body[4:], []byte("SCRAM-SHA-256\x00")) {
+					return fmt.Errorf("server requested unsupported SASL mechanism")
+				}
+				scram, err = newScramSession(opts.Password)
+				if err != nil {
+					return err
+				}
+				first := scram.clientFirst()
+				var out []byte
+				out = append(out, "SCRAM-SHA-256"...)
+				out = append(out, 0)
+				out = binary.BigEndian.AppendUint32(out, uint32(len(first)))
+				out = append(out, first...)
+				if err := c.writeMessage('p', out); err != nil {
+					return err
+				}
+			case authSASLContinue:
+				if scram == nil {
+					return fmt.Errorf("unexpected SASL continue")
+				}
+				final, err := scram.clientFinal(body[4:])
+				if err != nil {
+					return err
+				}
+				if err := c.writeMessage('p', final); err != nil {
+					return err
+				}
+			case authSASLFinal:
+				if scram == nil {
+					return fmt.Errorf("unexpected SASL final")
+				}
+				if err := scram.verifyServerFinal(body[4:]); err != nil {
+					return err
+				}
+			default:
+				return fmt.Errorf("unsupported authentication method: %d", code)
+			}
+		case 'Z':
+			return nil
+		}
+	}
+}
+
+func (c *Client) writeMessage(typ byte, body []byte) error {
+	msg := make([]byte, 5, 5+len(body))
+	msg[0] = typ
+	binary.BigEndian.PutUint32(msg[1:5], uint32(4+len(body)))
+	msg = append(msg, body...)
+	_, err := c.conn.Write(msg)
+	return err
+}
+
+func (c *Client) readMessage() (byte, []byte, error) {
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(c.rd, header); err != nil {
+		return 0, nil, fmt.Errorf("read message header: %w", err)
+	}
+	length := binary.BigEndian.Uint32(header[1:5])
+	if length < 4 || length > 1<<20 {
+		return 0, nil, fmt.Errorf("invalid message length: %d", length)
+	}
+	body := make([]byte, length-4)
+	if _, err := io.ReadFull(c.rd, body); err != nil {
+		return 0, nil, fmt.Errorf("read message body: %w", err)
+	}
+	return header[0], body, nil
+}
+
+func parseDataRow(body []byte) ([]string, error) {
+	if len(body) < 2 {
+		return nil, fmt.Errorf("malformed data row")
+	}
+	n := int(binary.BigEndian.Uint16(body[0:2]))
+	body = body[2:]
+	values := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		if len(body) < 4 {
+			return nil, fmt.Errorf("malformed data row")
+		}
+		l := int32(binary.BigEndian.Uint32(body[0:4]))
+		body = body[4:]
+		if l < 0 {
+			values = append(values, "")
+			continue
+		}
+		if int(l) > len(body) {
+			return nil, fmt.Errorf("malformed data row")
+		}
+		values = append(values, string(body[:l]))
+		body = body[l:]
+	}
+	return values, nil
+}
+
+// BackendError is an ErrorResponse returned by the probed server.
+type BackendError struct {
+	Severity string
+	Code     string
+	Message  string
+}
+
+func (e *BackendError) Error() string {
+	return fmt.Sprintf("%s: %s (SQLSTATE %s)", e.Severity, e.Message, e.Code)
+}
+
+func parseError(body []byte) error {
+	e := &BackendError{}
+	for _, field := range bytes.Split(body, []byte{0}) {
+		if len(field) < 1 {
+			continue
+		}
+		switch field[0] {
+		case 'S':
+			e.Severity = string(field[1:])
+		case 'C':
+			e.Code = string(field[1:])
+		case 'M':
+			e.Message = string(field[1:])
+		}
+	}
+	return e
+}
+
+func md5Password(user, password string, salt []byte) string {
+	inner := md5.Sum([]byte(password + user))
+	innerHex := hex.EncodeToString(inner[:])
+	outer := md5.Sum(append([]byte(innerHex), salt...))
+	return "md5" + hex.EncodeToString(outer[:])
+}
+
+// scramSession implements the client side of SCRAM-SHA-256 (RFC 5802/7677)
+// without channel binding.
+type scramSession struct {
+	password        string
+	clientNonce     string
+	clientFirstBare string
+	authMessage     string
+	saltedPassword  []byte
+}
+
+func newScramSession(password string) (*scramSession, error) {
+	nonce := make([]byte, 18)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return &scramSession{
+		password:    password,
+		clientNonce: base64.RawStdEncoding.EncodeToString(nonce),
+	}, nil
+}
+
+func (s *scramSession) clientFirst() []byte {
+	// PostgreSQL takes the user name from the startup message, so it is left empty here.
+	s.clientFirstBare = "n=,r=" + s.clientNonce
+	return []byte("n,," + s.clientFirstBare)
+}
+
+func (s *scramSession) clientFinal(serverFirst []byte) ([]byte, error) {
+	var nonce, salt string
+	var iterations int
+	for _, attr := range strings.Split(string(serverFirst), ",") {
+		if len(attr) < 2 || attr[1] != '=' {
+			continue
+		}
+		switch attr[0] {
+		case 'r':
+			nonce = attr[2:]
+		case 's':
+			salt = attr[2:]
+		case 'i':
+			iterations, _ = strconv.Atoi(attr[2:])
+		}
+	}
+	if !strings.HasPrefix(nonce, s.clientNonce) || salt == "" || iterations <= 0 {
+		return nil, fmt.Errorf("invalid SCRAM server-first message")
+	}
+	saltBytes, err := base64.StdEncoding.DecodeString(salt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SCRAM salt: %w", err)
+	}
+
+	s.saltedPassword = pbkdf2SHA256([]byte(s.password), saltBytes, iterations, sha256.Size)
+	clientKey := hmacSHA256(s.saltedPassword, []byte("Client Key"))
+	storedKey := sha256.Sum256(clientKey)
+
+	withoutProof := "c=biws,r=" + nonce
+	s.authMessage = s.clientFirstBare + "," + string(serverFirst) + "," + withoutProof
+	signature := hmacSHA256(storedKey[:], []byte(s.authMessage))
+
+	proof := make([]byte, len(clientKey))
+	for i := range clientKey {
+		proof[i] = clientKey[i] ^ signature[i]
+	}
+	return []byte(withoutProof + ",p=" + base64.StdEncoding.EncodeToString(proof)), nil
+}
+
+func (s *scramSession) verifyServerFinal(serverFinal []byte) error {
+	msg := string(serverFinal)
+	if !strings.HasPrefix(msg, "v=") {
+		return fmt.Errorf("SCRAM authentication failed: %s", msg)
+	}
+	got, err := base64.StdEncoding.DecodeString(strings.SplitN(msg[2:], ",", 2)[0])
+	if err != nil {
+		return fmt.Errorf("invalid SCRAM server signature: %w", err)
+	}
+	serverKey := hmacSHA256(s.saltedPassword, []byte("Server Key"))
+	if !hmac.Equal(got, hmacSHA256(serverKey, []byte(s.authMessage))) {
+		return fmt.Errorf("SCRAM server signature mismatch")
+	}
+	return nil
+}
+
+func hmacSHA256(key, data []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+func pbkdf2SHA256(password, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	var out []byte
+	for block := uint32(1); len(out) < keyLen; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write(binary.BigEndian.AppendUint32(nil, block))
+		u := prf.Sum(nil)
+		t := append([]byte(nil), u...)
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		out = append(out, t...)
+	}
+	return out[:keyLen]
+}
@@ -0,0 +1,336 @@
+package postgresql_probe
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/utils"
+)
+
+// RFC 7677 section 3 test vector for user "user" and password "pencil".
+func TestScramRFC7677(t *testing.T) {
+	s := &scramSession{password: "pencil", clientNonce: "rOprNGfwEbeRWgbNEkqO"}
+	if got := string(s.clientFirst()); got != "n,,n=,r=rOprNGfwEbeRWgbNEkqO" {
+		t.Fatalf("client-first = %q", got)
+	}
+	// The vector carries the user name, which the probe leaves to the startup message.
+	s.clientFirstBare = "n=user,r=rOprNGfwEbeRWgbNEkqO"
+
+	final, err := s.clientFinal([]byte("r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ="
+	if string(final) != want {
+		t.Errorf("client-final = %q, want %q", final, want)
+	}
+
+	if err := s.verifyServerFinal([]byte("v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4=")); err != nil {
+		t.Errorf("server-final rejected: %v", err)
+	}
+	if err := s.verifyServerFinal([]byte("v=AAAATRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4=")); err == nil {
+		t.Error("forged server-final accepted")
+	}
+	if err := s.verifyServerFinal([]byte("e=invalid-proof")); err == nil {
+		t.Error("server error accepted")
+	}
+}
+
+func TestScramRejectsForeignNonce(t *testing.T) {
+	s := &scramSession{password: "pencil", clientNonce: "rOprNGfwEbeRWgbNEkqO"}
+	s.clientFirst()
+	if _, err := s.clientFinal([]byte("r=somebodyElse,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096")); err == nil {
+		t.Error("server nonce without the client prefix accepted")
+	}
+}
+
+// fakeServer plays the backend side of a probe connection.
+type fakeServer struct {
+	t    *testing.T
+	conn net.Conn
+	rd   *bufio.Reader
+}
+
+func (s *fakeServer) read(n int) []byte {
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(s.rd, buf); err != nil {
+		s.t.Errorf("server read: %v", err)
+	}
+	return buf
+}
+
+// sslRequest answers the client's SSLRequest and, on 'S', starts TLS.
+func (s *fakeServer) sslRequest(answer byte) {
+	req := s.read(8)
+	if binary.BigEndian.Uint32(req[4:8]) != sslRequestCode {
+		s.t.Errorf("expected SSLRequest, got %x", req)
+	}
+	s.conn.Write([]byte{answer})
+	if answer != 'S' {
+		return
+	}
+
+	certPEM, keyPEM, err := utils.GenerateSelfSignedCert(utils.CertOptions{
+		Hosts:        []string{"db.internal"},
+		KeyAlgorithm: utils.KeyECDSAP256,
+		Validity:     time.Hour,
+	})
+	if err != nil {
+		s.t.Errorf("generate certificate: %v", err)
+		return
+	}
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		s.t.Errorf("load certificate: %v", err)
+		return
+	}
+	tlsConn := tls.Server(s.conn, &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err := tlsConn.Handshake(); err != nil {
+		s.t.Errorf("server TLS handshake: %v", err)
+	}
+	s.conn = tlsConn
+	s.rd = bufio.NewReader(tlsConn)
+}
+
+// startup reads the StartupMessage and returns its parameters.
+func (s *fakeServer) startup() map[string]string {
+	length := binary.BigEndian.Uint32(s.read(4))
+	body := s.read(int(length) - 4)
+	if binary.BigEndian.Uint32(body[0:4]) != protocolVersion3 {
+		s.t.Errorf("unexpected protocol version %x", body[0:4])
+	}
+	params := make(map[string]string)
+	fields := strings.Split(string(body[4:]), "\x00")
+	for i := 0; i+1 < len(fields); i += 2 {
+		params[fields[i]] = fields[i+1]
+	}
+	return params
+}
+
+func (s *fakeServer) expect(typ byte) []byte {
+	header := s.read(5)
+	if header[0] != typ {
+		s.t.Errorf("expected message %q, got %q", typ, header[0])
+	}
+	return s.read(int(binary.BigEndian.Uint32(header[1:5])) - 4)
+}
+
+func (s *fakeServer) send(typ byte, body []byte) {
+	msg := []byte{typ}
+	msg = binary.BigEndian.AppendUint32(msg, uint32(4+len(body)))
+	s.conn.Write(append(msg, body...))
+}
+
+func (s *fakeServer) auth(code uint32, extra ...byte) {
+	s.send('R', append(binary.BigEndian.AppendUint32(nil, code), extra...))
+}
+
+func (s *fakeServer) ready() {
+	s.auth(authOK)
+	s.send('Z', []byte{'I'})
+}
+
+// dataRow answers a simple query with a single row; a nil value is NULL.
+func (s *fakeServer) dataRow(values ...*string) {
+	s.expect('Q')
+	row := binary.BigEndian.AppendUint16(nil, uint16(len(values)))
+	for _, v := range values {
+		if v == nil {
+			row = binary.BigEndian.AppendUint32(row, 0xFFFFFFFF)
+			continue
+		}
+		row = binary.BigEndian.AppendUint32(row, uint32(len(*v)))
+		row = append(row, *v...)
+	}
+	s.send('D', row)
+	s.send('C', []byte("SELECT 1\x00"))
+	s.send('Z', []byte{'I'})
+}
+
+func text(s string) *string { return &s }
+
+func TestConnect(t *testing.T) {
+	tests := []struct {
+		name    string
+		sslMode SSLMode
+		server  func(s *fakeServer)
+		wantErr string
+	}{
+		{
+			name:    "trust without TLS",
+			sslMode: SSLDisable,
+			server: func(s *fakeServer) {
+				params := s.startup()
+				if params["user"] != "probe" || params["database"] != "postgres" {
+					s.t.Errorf("startup parameters = %v", params)
+				}
+				s.ready()
+			},
+		},
+		{
+			name:    "md5",
+			sslMode: SSLDisable,
+			server: func(s *fakeServer) {
+				s.startup()
+				s.auth(authMD5Password, 1, 2, 3, 4)
+				if got := string(s.expect('p')); got != "md5549d201a36e0ebb5f0dfdc4a36b362b2\x00" {
+					s.t.Errorf("md5 response = %q", got)
+				}
+				s.ready()
+			},
+		},
+		{
+			name:    "cleartext refused without TLS",
+			sslMode: SSLPrefer,
+			server: func(s *fakeServer) {
+				s.sslRequest('N')
+				s.startup()
+				s.auth(authCleartextPassword)
+			},
+			wantErr: "cleartext password on an unencrypted connection",
+		},
+		{
+			name:    "cleartext over TLS",
+			sslMode: SSLRequire,
+			server: func(s *fakeServer) {
+				s.sslRequest('S')
+				s.startup()
+				s.auth(authCleartextPassword)
+				if got := string(s.expect('p')); got != "secret\x00" {
+					s.t.Errorf("password = %q", got)
+				}
+				s.ready()
+			},
+		},
+		{
+			name:    "prefer falls back to plain text",
+			sslMode: SSLPrefer,
+			server: func(s *fakeServer) {
+				s.sslRequest('N')
+				s.startup()
+				s.ready()
+			},
+		},
+		{
+			name:    "require refused by the server",
+			sslMode: SSLRequire,
+			server: func(s *fakeServer) {
+				s.sslRequest('N')
+			},
+			wantErr: "server does not support SSL",
+		},
+		{
+			name:    "login error",
+			sslMode: SSLDisable,
+			server: func(s *fakeServer) {
+				s.startup()
+				s.send('E', []byte("SFATAL\x00C28P01\x00Mpassword authentication failed\x00\x00"))
+			},
+			wantErr: "password authentication failed (SQLSTATE 28P01)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer client.Close()
+			defer server.Close()
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				tt.server(&fakeServer{t: t, conn: server, rd: bufio.NewReader(server)})
+			}()
+
+			c, err := newClient(client, "db.internal", Options{User: "probe", Password: "secret", SSLMode: tt.sslMode})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("error = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			} else if tt.sslMode == SSLRequire && !c.tls {
+				t.Error("connection is not encrypted")
+			}
+			client.Close()
+			<-done
+		})
+	}
+}
+
+func TestIsInRecovery(t *testing.T) {
+	tests := []struct {
+		name    string
+		row     []*string
+		want    bool
+		wantErr bool
+	}{
+		{name: "standby", row: []*string{text("t")}, want: true},
+		{name: "primary", row: []*string{text("f")}},
+		{name: "null", row: []*string{nil}},
+		{name: "two columns", row: []*string{text("t"), text("f")}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer client.Close()
+			defer server.Close()
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				s := &fakeServer{t: t, conn: server, rd: bufio.NewReader(server)}
+				s.startup()
+				s.ready()
+				s.dataRow(tt.row...)
+			}()
+
+			c, err := newClient(client, "db.internal", Options{User: "probe", SSLMode: SSLDisable})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := c.isInRecovery()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("isInRecovery() = %v, want %v", got, tt.want)
+			}
+			<-done
+		})
+	}
+}
+
+func TestQueryRowError(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s := &fakeServer{t: t, conn: server, rd: bufio.NewReader(server)}
+		s.startup()
+		s.ready()
+		s.expect('Q')
+		s.send('E', []byte("SERROR\x00C42883\x00Mfunction pg_is_in_recovery() does not exist\x00\x00"))
+		s.send('Z', []byte{'I'})
+	}()
+
+	c, err := newClient(client, "db.internal", Options{User: "probe", SSLMode: SSLDisable})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.isInRecovery()
+	var backendErr *BackendError
+	if !errors.As(err, &backendErr) || backendErr.Code != "42883" {
+		t.Errorf("error = %v, want SQLSTATE 42883", err)
+	}
+	<-done
+}
@@ -0,0 +1,28 @@
+package postgresql_probe
+
+import (
+	"context"
+	"fmt"
+)
+
+// IsInRecovery connects to the backend and reports whether it is a standby
+// (SELECT pg_is_in_recovery()).
+func IsInRecovery(ctx context.Context, addr string, opts Options) (bool, error) {
+	client, err := Connect(ctx, addr, opts)
+	if err != nil {
+		return false, err
+	}
+	defer client.Close()
+	return client.isInRecovery()
+}
+
+func (c *Client) isInRecovery() (bool, error) {
+	row, err := c.QueryRow("SELECT pg_is_in_recovery()")
+	if err != nil {
+		return false, err
+	}
+	if len(row) != 1 {
+		return false, fmt.Errorf("unexpected result from pg_is_in_recovery(): %v", row)
+	}
+	return row[0] == "t", nil
+}
@@ -0,0 +1,227 @@
+package postgresql_proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/core"
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/dialer"
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/metrics"
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// codeAccessDenied is invalid_authorization_specification, sent when a route's
+// TLS or client address rules reject the connection.
+const codeAccessDenied = "28000"
+
+// QueueOptions configures queue mode: instead of failing immediately with 08001,
+// the client's startup is held while the resolver (and health checker) wait for
+// a usable backend, e.g. during a Patroni switchover or a StatefulSet restart.
+type QueueOptions struct {
+	Timeout        time.Duration // maximum time a client is held
+	RetryInterval  time.Duration // time between resolve/dial attempts
+	NoticeInterval time.Duration // time between NoticeResponse messages, 0 disables them
+}
+
+// errClientData ends a queued connection whose client sent data before the
+// reply to its StartupMessage.
+var errClientData = errors.New("client sent data while its connection was queued")
+
+// connectBackend resolves and dials the backend for metadata. The client is
+// held and the attempt retried while a scaled-to-zero backend is starting, and
+// in queue mode until Queue.Timeout elapses. On failure it returns the
+// ErrorResponse to send to the client, or err when the client went away or
+// ctx was cancelled while it was held.
+func (p *PostgresProxy) connectBackend(ctx context.Context, clientConn net.Conn, metadata core.RoutingMetadata) (net.Conn, string, *ErrorResponse, error) {
+	backendConn, backendAddr, errResp, cause := p.tryConnectBackend(ctx, clientConn, metadata)
+	if errResp == nil {
+		return backendConn, backendAddr, nil, nil
+	}
+	if errors.Is(cause, core.ErrAccessDenied) {
+		// Waiting would not change the outcome
+		return nil, "", errResp, nil
+	}
+
+	var holdTimeout time.Duration
+	retryInterval, noticeInterval := time.Second, 5*time.Second
+	if p.Queue != nil {
+		holdTimeout = p.Queue.Timeout
+		if p.Queue.RetryInterval > 0 {
+			retryInterval = p.Queue.RetryInterval
+		}
+		noticeInterval = p.Queue.NoticeInterval
+	}
+	noticeText := "backend unavailable, waiting"
+
+	var waking *core.WakingError
+	if errors.As(cause, &waking) {
+		holdTimeout = max(holdTimeout, waking.Timeout)
+		if noticeInterval <= 0 {
+			noticeInterval = 5 * time.Second
+		}
+		noticeText = fmt.Sprintf("database %s is starting, waiting for it to become ready", metadata["deployment_id"])
+	}
+	if holdTimeout <= 0 {
+		return nil, "", errResp, nil
+	}
+
+	trace.SpanFromContext(ctx).AddEvent("queued", trace.WithAttributes(attribute.String("reason", errResp.Message)))
+	log.Info("Backend unavailable, queueing connection",
+		"deployment_id", metadata["deployment_id"],
+		"timeout", holdTimeout,
+		"remote_addr", clientConn.RemoteAddr())
+
+	start := time.Now()
+	deadline := start.Add(holdTimeout)
+	lastNotice := start
+	if waking != nil {
+		// Tell the client right away why the connection is slow
+		lastNotice = time.Time{}
+	}
+
+	watch := watchClient(clientConn)
+	for time.Now().Before(deadline) {
+		if noticeInterval > 0 && time.Since(lastNotice) >= noticeInterval {
+			lastNotice = time.Now()
+			// A failed write means the client gave up waiting
+			if err := p.sendNoticeResponse(clientConn, &ErrorResponse{
+				Severity: "NOTICE",
+				Code:     "01000", // warning
+				Message:  fmt.Sprintf("%s (%s elapsed)", noticeText, time.Since(start).Round(time.Second)),
+			}); err != nil {
+				watch.stop()
+				return nil, "", nil, err
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			watch.stop()
+			return nil, "", nil, ctx.Err()
+		case <-watch.done:
+			return nil, "", nil, watch.err
+		case <-time.After(min(retryInterval, time.Until(deadline))):
+		}
+
+		backendConn, backendAddr, errResp, cause = p.tryConnectBackend(ctx, clientConn, metadata)
+		if errResp == nil {
+			if err := watch.stop(); err != nil {
+				backendConn.Close()
+				return nil, "", nil, err
+			}
+			log.Info("Queued connection resumed",
+				"deployment_id", metadata["deployment_id"],
+				"waited", time.Since(start),
+				"remote_addr", clientConn.RemoteAddr())
+			return backendConn, backendAddr, nil, nil
+		}
+		if errors.Is(cause, core.ErrAccessDenied) {
+			watch.stop()
+			return nil, "", errResp, nil
+		}
+	}
+	if err := watch.stop(); err != nil {
+		return nil, "", nil, err
+	}
+
+	errResp.Message = fmt.Sprintf("%s (queued for %s)", errResp.Message, holdTimeout)
+	return nil, "", errResp, nil
+}
+
+// clientWatch detects a held client that hangs up. The client must wait for
+// the reply to its StartupMessage, so any outcome of the read ends the wait.
+type clientWatch struct {
+	conn net.Conn
+	done chan struct{}
+	err  error // set before done is closed
+}
+
+func watchClient(conn net.Conn) *clientWatch {
+	w := &clientWatch{conn: conn, done: make(chan struct{})}
+	go func() {
+		defer close(w.done)
+		var b [1]byte
+		_, err := conn.Read(b[:])
+		if err == nil {
+			err = errClientData
+		}
+		w.err = err
+	}()
+	return w
+}
+
+// stop interrupts the read and returns the error that ended the watch, or nil
+// when the client is still waiting.
+func (w *clientWatch) stop() error {
+	_ = w.conn.SetReadDeadline(time.Now())
+	<-w.done
+	_ = w.conn.SetReadDeadline(time.Time{})
+	if errors.Is(w.err, os.ErrDeadlineExceeded) {
+		return nil
+	}
+	return w.err
+}
+
+// tryConnectBackend makes a single resolve & dial attempt. cause is the underlying error.
+func (p *PostgresProxy) tryConnectBackend(ctx context.Context, clientConn net.Conn, metadata core.RoutingMetadata) (conn net.Conn, addr string, errResp *ErrorResponse, cause error) {
+	// Resolve Backend
+	resolveCtx, resolveSpan := tracing.Tracer().Start(ctx, "resolve")
+	resolveCtx, cancel := context.WithTimeout(resolveCtx, 5*time.Second)
+	defer cancel()
+
+	resolveStart := time.Now()
+	candidates, err := p.Resolver.Resolve(resolveCtx, metadata, core.DatabaseTypePostgresql)
+	metrics.ObserveResolve(time.Since(resolveStart))
+	resolveSpan.SetAttributes(attribute.StringSlice("backend.candidates", candidates))
+	endSpan(resolveSpan, err)
+	if err != nil {
+		metrics.ResolutionFailed(err)
+		if errors.Is(err, core.ErrAccessDenied) {
+			log.Warn("Connection denied by route policy", "error", err, "remote_addr", clientConn.RemoteAddr())
+			return nil, "", &ErrorResponse{
+				Severity: "FATAL",
+				Code:     codeAccessDenied,
+				Message:  err.Error(),
+			}, err
+		}
+		log.Error("Resolution failed", "error", err, "remote_addr", clientConn.RemoteAddr())
+		return nil, "", &ErrorResponse{
+			Severity: "FATAL",
+			Code:     "08001", // sqlclient_unable_to_establish_sqlconnection
+			Message:  fmt.Sprintf("resolution failed: %v", err),
+		}, err
+	}
+
+	// Dial Backend
+	backendDialer := p.Dialer
+	if backendDialer == nil {
+		backendDialer = dialer.Default()
+	}
+	dialCtx, dialSpan := tracing.Tracer().Start(ctx, "dial")
+	dialStart := time.Now()
+	backendConn, backendAddr, err := backendDialer.Dial(dialCtx, candidates)
+	metrics.ObserveDial(time.Since(dialStart))
+	dialSpan.SetAttributes(attribute.String("server.address", backendAddr))
+	endSpan(dialSpan, err)
+	if err != nil {
+		log.Error("Dial failed", "candidates", candidates, "error", err, "remote_addr", clientConn.RemoteAddr())
+		return nil, "", &ErrorResponse{
+			Severity: "FATAL",
+			Code:     "08001",
+			Message:  fmt.Sprintf("failed to connect to backend: %v", err),
+		}, err
+	}
+	return backendConn, backendAddr, nil, nil
+}
+
+// sendNoticeResponse sends a NoticeResponse ('N'), which clients accept during startup.
+func (p *PostgresProxy) sendNoticeResponse(conn net.Conn, notice *ErrorResponse) error {
+	_, err := conn.Write(encodeResponse('N', notice))
+	return err
+}
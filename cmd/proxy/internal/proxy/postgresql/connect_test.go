@@ -0,0 +1,85 @@
+package postgresql_proxy
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/core"
+)
+
+// failingResolver fails every lookup with the error returned by next.
+type failingResolver struct {
+	calls atomic.Int32
+	next  func(call int32) error
+}
+
+func (r *failingResolver) Resolve(context.Context, core.RoutingMetadata, core.DatabaseType) ([]string, error) {
+	return nil, r.next(r.calls.Add(1))
+}
+
+func TestQueueEndsWhenClientCloses(t *testing.T) {
+	resolver := &failingResolver{next: func(int32) error { return core.ErrNoHealthyBackend }}
+	proxy := &PostgresProxy{
+		Resolver: resolver,
+		Queue:    &QueueOptions{Timeout: time.Minute, RetryInterval: 10 * time.Millisecond},
+	}
+
+	client, server := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		proxy.HandleConnection(server)
+	}()
+	if _, err := client.Write(rebuildStartupMessage(196608, map[string]string{"user": "alice.db1"})); err != nil {
+		t.Fatal(err)
+	}
+	for resolver.calls.Load() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	client.Close()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("queued connection outlived its client")
+	}
+	calls := resolver.calls.Load()
+	time.Sleep(50 * time.Millisecond)
+	if resolver.calls.Load() != calls {
+		t.Error("proxy kept resolving for a closed client")
+	}
+}
+
+func TestQueueStopsOnAccessDenied(t *testing.T) {
+	resolver := &failingResolver{next: func(call int32) error {
+		if call < 3 {
+			return core.ErrNoHealthyBackend
+		}
+		return fmt.Errorf("%w: TLS required", core.ErrAccessDenied)
+	}}
+	proxy := &PostgresProxy{
+		Resolver: resolver,
+		Queue:    &QueueOptions{Timeout: time.Minute, RetryInterval: 10 * time.Millisecond},
+	}
+
+	client, server := net.Pipe()
+	defer client.Close()
+	go proxy.HandleConnection(server)
+	if _, err := client.Write(rebuildStartupMessage(196608, map[string]string{"user": "alice.db1"})); err != nil {
+		t.Fatal(err)
+	}
+
+	client.SetDeadline(time.Now().Add(5 * time.Second))
+	msgType, body, err := readMessage(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msgType != 'E' || !bytes.Contains(body, []byte("C"+codeAccessDenied+"\x00")) {
+		t.Fatalf("reply = %q %q, want a %s ErrorResponse", msgType, body, codeAccessDenied)
+	}
+}
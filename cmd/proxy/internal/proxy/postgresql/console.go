@@ -0,0 +1,459 @@
+package postgresql_proxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/accesslog"
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/core"
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/health"
+)
+
+// ConsoleDatabase is the deployment ID (admin.xdbproxy) or database name that opens the admin console.
+const ConsoleDatabase = "xdbproxy"
+
+const (
+	// maxConsoleMessage bounds the size of a message accepted from a console client
+	maxConsoleMessage = 1 << 20
+	// textOID is the type of every console column
+	textOID = 25
+)
+
+// ConsoleOptions configures the PgBouncer-style admin console. Commands are
+// sent as simple queries, e.g. from psql:
+//
+//	psql "host=proxy user=admin.xdbproxy" -c "SHOW CLIENTS"
+type ConsoleOptions struct {
+	User     string
+	Password string
+
+	// PauseTimeout bounds how long PAUSE holds a new connection, defaultPauseTimeout if zero
+	PauseTimeout time.Duration
+
+	Registry *core.ConnectionRegistry    // SHOW CLIENTS, SHOW BACKENDS, KILL
+	Health   *health.Checker             // optional, adds circuit state to SHOW BACKENDS
+	Routes   core.RouteLister            // optional, SHOW ROUTES
+	Reload   func(context.Context) error // optional, RELOAD
+
+	// Certificates, when set, lists every certificate served (default and SNI) for SHOW CERTS
+	Certificates func() []*tls.Certificate
+}
+
+func (c *ConsoleOptions) matches(metadata core.RoutingMetadata) bool {
+	return c != nil && (metadata["deployment_id"] == ConsoleDatabase || metadata["database"] == ConsoleDatabase)
+}
+
+// consoleResult is the outcome of a console command.
+type consoleResult struct {
+	columns []string
+	rows    [][]string
+	tag     string
+}
+
+// serveConsole authenticates the client and runs console commands until it
+// disconnects. It returns the access-log termination reason.
+func (p *PostgresProxy) serveConsole(conn net.Conn, metadata core.RoutingMetadata) string {
+	user := metadata["username"]
+	if user == "" {
+		user = metadata["user"]
+	}
+
+	// The password is requested in clear text, so it is only accepted over TLS
+	if metadata["tls"] != "true" {
+		log.Warn("Admin console refused without TLS", "user", user, "remote_addr", conn.RemoteAddr())
+		_ = p.sendErrorResponse(conn, &ErrorResponse{
+			Severity: "FATAL",
+			Code:     "28000", // invalid_authorization_specification
+			Message:  "the admin console requires an SSL connection",
+		})
+		return accesslog.ReasonAccessDenied
+	}
+
+	// AuthenticationCleartextPassword
+	if err := writeMessage(conn, 'R', binary.BigEndian.AppendUint32(nil, 3)); err != nil {
+		return accesslog.ReasonClientClosed
+	}
+	msgType, payload, err := readMessage(conn)
+	if err != nil || msgType != 'p' {
+		return accesslog.ReasonClientClosed
+	}
+	password, _, _ := bytes.Cut(payload, []byte{0})
+
+	userOK := subtle.ConstantTimeCompare([]byte(user), []byte(p.Console.User)) == 1
+	passwordOK := subtle.ConstantTimeCompare(password, []byte(p.Console.Password)) == 1
+	if !userOK || !passwordOK || p.Console.Password == "" {
+		log.Warn("Admin console authentication failed", "user", user, "remote_addr", conn.RemoteAddr())
+		_ = p.sendErrorResponse(conn, &ErrorResponse{
+			Severity: "FATAL",
+			Code:     "28P01", // invalid_password
+			Message:  fmt.Sprintf("password authentication failed for user %q", user),
+		})
+		return accesslog.ReasonAuthFailed
+	}
+	log.Info("Admin console session started", "user", user, "remote_addr", conn.RemoteAddr())
+
+	var out bytes.Buffer
+	appendMessage(&out, 'R', binary.BigEndian.AppendUint32(nil, 0)) // AuthenticationOk
+	for _, kv := range [][2]string{
+		{"server_version", "16.0 (xdatabase-proxy console)"},
+		{"server_encoding", "UTF8"},
+		{"client_encoding", "UTF8"},
+		{"DateStyle", "ISO, MDY"},
+		{"integer_datetimes", "on"},
+		{"standard_conforming_strings", "on"},
+	} {
+		appendMessage(&out, 'S', cstrings(kv[0], kv[1]))
+	}
+	appendMessage(&out, 'Z', []byte{'I'})
+	if _, err := conn.Write(out.Bytes()); err != nil {
+		return accesslog.ReasonClientClosed
+	}
+
+	// Extended protocol messages are rejected once and skipped until Sync
+	skipUntilSync := false
+	for {
+		msgType, payload, err := readMessage(conn)
+		if err != nil {
+			return accesslog.ReasonClientClosed
+		}
+		out.Reset()
+
+		switch msgType {
+		case 'Q':
+			query, _, _ := bytes.Cut(payload, []byte{0})
+			p.runConsoleQuery(&out, string(query), user)
+			appendMessage(&out, 'Z', []byte{'I'})
+		case 'X':
+			return accesslog.ReasonClientClosed
+		case 'S':
+			skipUntilSync = false
+			appendMessage(&out, 'Z', []byte{'I'})
+		default:
+			if skipUntilSync {
+				continue
+			}
+			skipUntilSync = true
+			appendMessage(&out, 'E', errorFields(&ErrorResponse{
+				Severity: "ERROR",
+				Code:     "0A000", // feature_not_supported
+				Message:  "the admin console only supports simple queries",
+			}))
+		}
+
+		if _, err := conn.Write(out.Bytes()); err != nil {
+			return accesslog.ReasonClientClosed
+		}
+	}
+}
+
+// runConsoleQuery executes every statement of query and appends the responses to out.
+func (p *PostgresProxy) runConsoleQuery(out *bytes.Buffer, query, user string) {
+	executed := false
+	for _, stmt := range strings.Split(query, ";") {
+		stmt = strings.TrimSpace(stmt)
+		if stmt == "" {
+			continue
+		}
+		executed = true
+
+		log.Info("Admin console command", "user", user, "command", stmt)
+		result, err := p.execConsoleCommand(stmt)
+		if err != nil {
+			appendMessage(out, 'E', errorFields(&ErrorResponse{
+				Severity: "ERROR",
+				Code:     "42601", // syntax_error
+				Message:  err.Error(),
+			}))
+			return
+		}
+
+		if result.columns != nil {
+			appendMessage(out, 'T', rowDescription(result.columns))
+			for _, row := range result.rows {
+				appendMessage(out, 'D', dataRow(row))
+			}
+		}
+		appendMessage(out, 'C', cstrings(result.tag))
+	}
+	if !executed {
+		appendMessage(out, 'I', nil) // EmptyQueryResponse
+	}
+}
+
+func (p *PostgresProxy) execConsoleCommand(stmt string) (*consoleResult, error) {
+	fields := strings.Fields(stmt)
+	command := strings.ToUpper(fields[0])
+	var arg string
+	if len(fields) > 1 {
+		arg = fields[1]
+	}
+
+	switch command {
+	case "SHOW":
+		if arg == "" {
+			return nil, fmt.Errorf("SHOW requires an argument (CLIENTS, BACKENDS, ROUTES, CERTS, HELP)")
+		}
+		switch strings.ToUpper(arg) {
+		case "CLIENTS":
+			return p.showClients(), nil
+		case "BACKENDS":
+			return p.showBackends(), nil
+		case "ROUTES":
+			return p.showRoutes()
+		case "CERTS":
+			return p.showCerts(), nil
+		case "HELP":
+			return showHelp(), nil
+		default:
+			return nil, fmt.Errorf("unknown SHOW argument %q (CLIENTS, BACKENDS, ROUTES, CERTS, HELP)", arg)
+		}
+	case "PAUSE":
+		p.Pause(arg)
+		log.Info("Paused new connections", "deployment_id", arg)
+		return &consoleResult{tag: "PAUSE"}, nil
+	case "RESUME":
+		p.Resume(arg)
+		log.Info("Resumed new connections", "deployment_id", arg)
+		return &consoleResult{tag: "RESUME"}, nil
+	case "RELOAD":
+		if p.Console.Reload == nil {
+			return nil, fmt.Errorf("RELOAD is not available")
+		}
+		if err := p.Console.Reload(context.Background()); err != nil {
+			return nil, fmt.Errorf("reload failed: %v", err)
+		}
+		return &consoleResult{tag: "RELOAD"}, nil
+	case "KILL":
+		if arg == "" {
+			return nil, fmt.Errorf("KILL requires a connection id (see SHOW CLIENTS)")
+		}
+		if p.Console.Registry == nil {
+			return nil, fmt.Errorf("connection registry is disabled")
+		}
+		if err := p.Console.Registry.Kill(arg); err != nil {
+			if errors.Is(err, core.ErrConnectionNotFound) {
+				return nil, fmt.Errorf("connection %q not found", arg)
+			}
+			return nil, err
+		}
+		return &consoleResult{tag: "KILL"}, nil
+	default:
+		return nil, fmt.Errorf("unknown command %q, try SHOW HELP", fields[0])
+	}
+}
+
+func (p *PostgresProxy) showClients() *consoleResult {
+	result := &consoleResult{
+		columns: []string{"id", "client_addr", "deployment_id", "user", "database", "pooled", "backend", "started_at", "duration", "bytes_in", "bytes_out"},
+		tag:     "SHOW",
+	}
+	if p.Console.Registry == nil {
+		return result
+	}
+	for _, c := range p.Console.Registry.List(core.ConnectionFilter{}) {
+		result.rows = append(result.rows, []string{
+			c.ID, c.ClientAddr, c.DeploymentID, c.User, c.Database, strconv.FormatBool(c.Pooled), c.Backend,
+			c.StartedAt.UTC().Format(time.RFC3339),
+			time.Duration(c.DurationSeconds * float64(time.Second)).Round(time.Second).String(),
+			strconv.FormatInt(c.BytesToBackend, 10), strconv.FormatInt(c.BytesToClient, 10),
+		})
+	}
+	return result
+}
+
+func (p *PostgresProxy) showBackends() *consoleResult {
+	result := &consoleResult{
+		columns: []string{"address", "connections", "up", "circuit", "consecutive_failures", "last_error"},
+		tag:     "SHOW",
+	}
+
+	connections := make(map[string]int)
+	if p.Console.Registry != nil {
+		for _, c := range p.Console.Registry.List(core.ConnectionFilter{}) {
+			if c.Backend != "" && c.Backend != "console" {
+				connections[c.Backend]++
+			}
+		}
+	}
+
+	statuses := make(map[string]health.BackendStatus)
+	if p.Console.Health != nil {
+		for _, st := range p.Console.Health.Snapshot() {
+			statuses[st.Address] = st
+		}
+	}
+
+	addrs := make([]string, 0, len(connections)+len(statuses))
+	for addr := range connections {
+		addrs = append(addrs, addr)
+	}
+	for addr := range statuses {
+		if _, ok := connections[addr]; !ok {
+			addrs = append(addrs, addr)
+		}
+	}
+	sort.Strings(addrs)
+
+	for _, addr := range addrs {
+		row := []string{addr, strconv.Itoa(connections[addr]), "", "", "", ""}
+		if st, ok := statuses[addr]; ok {
+			row[2] = strconv.FormatBool(st.Up)
+			row[3] = string(st.Circuit)
+			row[4] = strconv.Itoa(st.ConsecutiveFailures)
+			row[5] = st.LastError
+		}
+		result.rows = append(result.rows, row)
+	}
+	return result
+}
+
+func (p *PostgresProxy) showRoutes() (*consoleResult, error) {
+	if p.Console.Routes == nil {
+		return nil, fmt.Errorf("the backend resolver cannot list its routes")
+	}
+	result := &consoleResult{
+		columns: []string{"deployment_id", "pooled", "role", "addresses", "source", "paused"},
+		tag:     "SHOW",
+	}
+	for _, r := range p.Console.Routes.Routes() {
+		result.rows = append(result.rows, []string{
+			r.DeploymentID, strconv.FormatBool(r.Pooled), r.Role, strings.Join(r.Addresses, ", "), r.Source,
+			strconv.FormatBool(p.IsPaused(r.DeploymentID)),
+		})
+	}
+	return result, nil
+}
+
+func (p *PostgresProxy) showCerts() *consoleResult {
+	result := &consoleResult{
+		columns: []string{"subject", "issuer", "dns_names", "not_before", "not_after", "days_left"},
+		tag:     "SHOW",
+	}
+	if p.TLSConfig == nil {
+		return result
+	}
+	// Copied so the appends below never write into the shared tls.Config
+	certs := slices.Clone(p.TLSConfig.Certificates)
+	if p.Console.Certificates != nil {
+		for _, cert := range p.Console.Certificates() {
+			certs = append(certs, *cert)
+		}
+	} else if p.TLSConfig.GetCertificate != nil {
+		if cert, err := p.TLSConfig.GetCertificate(&tls.ClientHelloInfo{}); err == nil && cert != nil {
+			certs = append([]tls.Certificate{*cert}, certs...)
+		}
+	}
+	for _, cert := range certs {
+		if len(cert.Certificate) == 0 {
+			continue
+		}
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			continue
+		}
+		result.rows = append(result.rows, []string{
+			leaf.Subject.String(), leaf.Issuer.String(), strings.Join(leaf.DNSNames, ", "),
+			leaf.NotBefore.UTC().Format(time.RFC3339), leaf.NotAfter.UTC().Format(time.RFC3339),
+			strconv.Itoa(int(time.Until(leaf.NotAfter).Hours() / 24)),
+		})
+	}
+	return result
+}
+
+func showHelp() *consoleResult {
+	return &consoleResult{
+		columns: []string{"command", "description"},
+		rows: [][]string{
+			{"SHOW CLIENTS", "live client connections"},
+			{"SHOW BACKENDS", "backends in use and their health"},
+			{"SHOW ROUTES", "deployment routes"},
+			{"SHOW CERTS", "served TLS certificates"},
+			{"PAUSE [deployment]", "hold new connections to a deployment, or to all"},
+			{"RESUME [deployment]", "release held connections"},
+			{"RELOAD", "reload the configuration"},
+			{"KILL <id>", "terminate a client connection"},
+		},
+		tag: "SHOW",
+	}
+}
+
+// readMessage reads a typed protocol message.
+func readMessage(r io.Reader) (byte, []byte, error) {
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, nil, err
+	}
+	length := int(binary.BigEndian.Uint32(header[1:5]))
+	if length < 4 || length > maxConsoleMessage {
+		return 0, nil, fmt.Errorf("invalid message length: %d", length)
+	}
+	payload := make([]byte, length-4)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	return header[0], payload, nil
+}
+
+func writeMessage(w io.Writer, msgType byte, payload []byte) error {
+	var buf bytes.Buffer
+	appendMessage(&buf, msgType, payload)
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func appendMessage(buf *bytes.Buffer, msgType byte, payload []byte) {
+	buf.WriteByte(msgType)
+	buf.Write(binary.BigEndian.AppendUint32(nil, uint32(4+len(payload))))
+	buf.Write(payload)
+}
+
+// errorFields returns the body of an ErrorResponse.
+func errorFields(resp *ErrorResponse) []byte {
+	return encodeResponse('E', resp)[5:]
+}
+
+func cstrings(values ...string) []byte {
+	var b []byte
+	for _, v := range values {
+		b = append(b, v...)
+		b = append(b, 0)
+	}
+	return b
+}
+
+func rowDescription(columns []string) []byte {
+	b := binary.BigEndian.AppendUint16(nil, uint16(len(columns)))
+	for _, name := range columns {
+		b = append(b, name...)
+		b = append(b, 0)
+		b = binary.BigEndian.AppendUint32(b, 0)          // table OID
+		b = binary.BigEndian.AppendUint16(b, 0)          // column number
+		b = binary.BigEndian.AppendUint32(b, textOID)    // type OID
+		b = binary.BigEndian.AppendUint16(b, 0xFFFF)     // type size (-1, variable)
+		b = binary.BigEndian.AppendUint32(b, 0xFFFFFFFF) // type modifier (-1)
+		b = binary.BigEndian.AppendUint16(b, 0)          // text format
+	}
+	return b
+}
+
+func dataRow(values []string) []byte {
+	b := binary.BigEndian.AppendUint16(nil, uint16(len(values)))
+	for _, v := range values {
+		b = binary.BigEndian.AppendUint32(b, uint32(len(v)))
+		b = append(b, v...)
+	}
+	return b
+}
@@ -0,0 +1,65 @@
+package postgresql_proxy
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+)
+
+func TestHandshakeRole(t *testing.T) {
+	tests := []struct {
+		name       string
+		params     map[string]string
+		wantRole   string
+		wantParams map[string]string
+	}{
+		{
+			name:     "suffix",
+			params:   map[string]string{"user": "alice.db1.ro"},
+			wantRole: "replica",
+		},
+		{
+			name:     "target_session_attrs",
+			params:   map[string]string{"user": "alice.db1", "target_session_attrs": "prefer-standby"},
+			wantRole: "prefer-replica",
+		},
+		{
+			name:       "client role is forwarded, not routed on",
+			params:     map[string]string{"user": "alice.db1", "role": "prefer-replica"},
+			wantRole:   "primary",
+			wantParams: map[string]string{"role": "prefer-replica"},
+		},
+		{
+			name:       "client role with suffix",
+			params:     map[string]string{"user": "alice.db1.ro", "role": "reporting"},
+			wantRole:   "replica",
+			wantParams: map[string]string{"role": "reporting"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer client.Close()
+			defer server.Close()
+			go client.Write(rebuildStartupMessage(196608, tt.params))
+
+			p := &PostgresProxy{}
+			metadata, _, raw, err := p.handshake(context.Background(), server)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if metadata["role"] != tt.wantRole {
+				t.Errorf("routing role = %q, want %q", metadata["role"], tt.wantRole)
+			}
+			if got := bytes.Contains(raw, []byte("role\x00")); got != (tt.wantParams != nil) {
+				t.Errorf("forwarded StartupMessage contains role = %v, want %v", got, tt.wantParams != nil)
+			}
+			for k, v := range tt.wantParams {
+				if !bytes.Contains(raw, []byte(k+"\x00"+v+"\x00")) {
+					t.Errorf("forwarded StartupMessage lacks %s=%s", k, v)
+				}
+			}
+		})
+	}
+}
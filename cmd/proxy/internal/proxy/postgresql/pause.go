@@ -0,0 +1,159 @@
+package postgresql_proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// allDeployments is the pause key used when every deployment is paused.
+const allDeployments = "*"
+
+// defaultPauseTimeout bounds the wait of held clients when no console options set one.
+const defaultPauseTimeout = 2 * time.Minute
+
+// errPauseTimeout ends a connection held longer than the pause timeout.
+var errPauseTimeout = errors.New("deployment stayed paused")
+
+// pauseState holds the deployments whose new connections are held.
+// resumed is closed and replaced whenever a pause is lifted.
+type pauseState struct {
+	paused  map[string]bool
+	except  map[string]bool // resumed while every deployment is paused
+	resumed chan struct{}
+	mu      sync.Mutex
+}
+
+func (s *pauseState) init() {
+	if s.paused == nil {
+		s.paused = make(map[string]bool)
+		s.except = make(map[string]bool)
+		s.resumed = make(chan struct{})
+	}
+}
+
+// isPaused reports whether deploymentID is paused. Caller holds s.mu.
+func (s *pauseState) isPaused(deploymentID string) bool {
+	return s.paused[deploymentID] || s.paused[allDeployments] && !s.except[deploymentID]
+}
+
+// pauses returns the proxy's pause state, shared with the proxies it replaced.
+func (p *PostgresProxy) pauses() *pauseState {
+	p.pauseOnce.Do(func() {
+		if p.pause == nil {
+			p.pause = &pauseState{}
+		}
+	})
+	return p.pause
+}
+
+// AdoptState carries runtime state over from a proxy this one replaces on
+// reload: paused deployments stay paused and held clients are released by
+// Resume on either proxy. It must be called before p serves connections.
+func (p *PostgresProxy) AdoptState(prev *PostgresProxy) {
+	p.pause = prev.pauses()
+}
+
+// Pause holds new connections to deploymentID, or to every deployment when it is empty,
+// until Resume. Established sessions are not affected.
+func (p *PostgresProxy) Pause(deploymentID string) {
+	pause := p.pauses()
+	pause.mu.Lock()
+	defer pause.mu.Unlock()
+	pause.init()
+	if deploymentID == "" {
+		clear(pause.except)
+		deploymentID = allDeployments
+	}
+	delete(pause.except, deploymentID)
+	pause.paused[deploymentID] = true
+}
+
+// Resume releases the connections held by Pause. An empty deploymentID resumes
+// everything; a deployment resumed while every deployment is paused is exempt
+// until the next Pause of all deployments.
+func (p *PostgresProxy) Resume(deploymentID string) {
+	pause := p.pauses()
+	pause.mu.Lock()
+	defer pause.mu.Unlock()
+	pause.init()
+	if deploymentID == "" {
+		clear(pause.paused)
+		clear(pause.except)
+	} else {
+		delete(pause.paused, deploymentID)
+		if pause.paused[allDeployments] {
+			pause.except[deploymentID] = true
+		}
+	}
+	close(pause.resumed)
+	pause.resumed = make(chan struct{})
+}
+
+// IsPaused reports whether new connections to deploymentID are held.
+func (p *PostgresProxy) IsPaused(deploymentID string) bool {
+	paused, _ := p.pauseWait(deploymentID)
+	return paused
+}
+
+func (p *PostgresProxy) pauseWait(deploymentID string) (bool, <-chan struct{}) {
+	pause := p.pauses()
+	pause.mu.Lock()
+	defer pause.mu.Unlock()
+	pause.init()
+	return pause.isPaused(deploymentID), pause.resumed
+}
+
+// waitWhilePaused holds the client while its deployment is paused, sending a
+// NoticeResponse every 5 seconds. It fails when the client hangs up or ctx is
+// cancelled, and with errPauseTimeout after sending an ErrorResponse once the
+// pause timeout elapses.
+func (p *PostgresProxy) waitWhilePaused(ctx context.Context, clientConn net.Conn, deploymentID string) error {
+	if paused, _ := p.pauseWait(deploymentID); !paused {
+		return nil
+	}
+
+	timeout := defaultPauseTimeout
+	if p.Console != nil && p.Console.PauseTimeout > 0 {
+		timeout = p.Console.PauseTimeout
+	}
+	start := time.Now()
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	watch := watchClient(clientConn)
+	for {
+		paused, resumed := p.pauseWait(deploymentID)
+		if !paused {
+			return watch.stop()
+		}
+		select {
+		case <-resumed:
+		case <-ctx.Done():
+			watch.stop()
+			return ctx.Err()
+		case <-watch.done:
+			return watch.err
+		case <-deadline.C:
+			watch.stop()
+			_ = p.sendErrorResponse(clientConn, &ErrorResponse{
+				Severity: "FATAL",
+				Code:     "57P03", // cannot_connect_now
+				Message:  fmt.Sprintf("database %s is paused (waited %s)", deploymentID, timeout),
+			})
+			return errPauseTimeout
+		case <-time.After(5 * time.Second):
+			if err := p.sendNoticeResponse(clientConn, &ErrorResponse{
+				Severity: "NOTICE",
+				Code:     "01000",
+				Message:  fmt.Sprintf("database %s is paused, waiting (%s elapsed)", deploymentID, time.Since(start).Round(time.Second)),
+			}); err != nil {
+				watch.stop()
+				return err
+			}
+		}
+	}
+}
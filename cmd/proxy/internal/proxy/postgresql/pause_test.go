@@ -0,0 +1,128 @@
+package postgresql_proxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestPauseResume(t *testing.T) {
+	tests := []struct {
+		name   string
+		steps  func(p *PostgresProxy)
+		paused map[string]bool
+	}{
+		{
+			name:   "one deployment",
+			steps:  func(p *PostgresProxy) { p.Pause("db1") },
+			paused: map[string]bool{"db1": true, "db2": false},
+		},
+		{
+			name:   "all deployments",
+			steps:  func(p *PostgresProxy) { p.Pause("") },
+			paused: map[string]bool{"db1": true, "db2": true},
+		},
+		{
+			name:   "resume one of all",
+			steps:  func(p *PostgresProxy) { p.Pause(""); p.Resume("db1") },
+			paused: map[string]bool{"db1": false, "db2": true},
+		},
+		{
+			name:   "pause all again",
+			steps:  func(p *PostgresProxy) { p.Pause(""); p.Resume("db1"); p.Pause("") },
+			paused: map[string]bool{"db1": true, "db2": true},
+		},
+		{
+			name:   "pause resumed one again",
+			steps:  func(p *PostgresProxy) { p.Pause(""); p.Resume("db1"); p.Pause("db1") },
+			paused: map[string]bool{"db1": true, "db2": true},
+		},
+		{
+			name:   "resume all",
+			steps:  func(p *PostgresProxy) { p.Pause(""); p.Pause("db1"); p.Resume("") },
+			paused: map[string]bool{"db1": false, "db2": false},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &PostgresProxy{}
+			tt.steps(p)
+			for id, want := range tt.paused {
+				if got := p.IsPaused(id); got != want {
+					t.Errorf("IsPaused(%s) = %v, want %v", id, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestWaitWhilePausedTimeout(t *testing.T) {
+	p := &PostgresProxy{Console: &ConsoleOptions{PauseTimeout: 50 * time.Millisecond}}
+	p.Pause("db1")
+
+	client, server := net.Pipe()
+	defer client.Close()
+	errc := make(chan error, 1)
+	go func() { errc <- p.waitWhilePaused(context.Background(), server, "db1") }()
+
+	msgType, payload, err := readMessage(client)
+	if err != nil || msgType != 'E' {
+		t.Fatalf("got %q, %v; want an ErrorResponse", msgType, err)
+	}
+	if !errors.Is(<-errc, errPauseTimeout) {
+		t.Errorf("waitWhilePaused did not time out")
+	}
+	if !bytes.Contains(payload, []byte("C57P03\x00")) {
+		t.Errorf("ErrorResponse %q lacks code 57P03", payload)
+	}
+}
+
+func TestWaitWhilePausedEnds(t *testing.T) {
+	tests := []struct {
+		name    string
+		end     func(p *PostgresProxy, client net.Conn, cancel context.CancelFunc)
+		wantErr bool
+	}{
+		{
+			name: "resumed",
+			end:  func(p *PostgresProxy, _ net.Conn, _ context.CancelFunc) { p.Resume("db1") },
+		},
+		{
+			name:    "client hangs up",
+			end:     func(_ *PostgresProxy, client net.Conn, _ context.CancelFunc) { client.Close() },
+			wantErr: true,
+		},
+		{
+			name:    "connection killed",
+			end:     func(_ *PostgresProxy, _ net.Conn, cancel context.CancelFunc) { cancel() },
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &PostgresProxy{}
+			p.Pause("db1")
+
+			client, server := net.Pipe()
+			defer client.Close()
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			errc := make(chan error, 1)
+			go func() { errc <- p.waitWhilePaused(ctx, server, "db1") }()
+
+			time.Sleep(10 * time.Millisecond)
+			tt.end(p, client, cancel)
+			select {
+			case err := <-errc:
+				if (err != nil) != tt.wantErr {
+					t.Errorf("waitWhilePaused() = %v, wantErr %v", err, tt.wantErr)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("waitWhilePaused did not return")
+			}
+		})
+	}
+}
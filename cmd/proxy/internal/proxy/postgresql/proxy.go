@@ -5,21 +5,40 @@ import (
 	"context"
 	"crypto/tls"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"net"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/accesslog"
 	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/core"
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/dialer"
 	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/logger"
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/metrics"
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/crypto/acme"
 )
 
 const (
 	sslRequestCode = 80877103
+
+	// tlsHandshakeRecord is the first byte of a TLS ClientHello
+	tlsHandshakeRecord = 0x16
 )
 
+// errACMEChallenge ends a connection that only validated an ACME challenge.
+var errACMEChallenge = errors.New("answered ACME TLS-ALPN-01 challenge")
+
+var log = logger.Component(logger.ComponentPostgres)
+
 // ErrorResponse represents a PostgreSQL error response
 type ErrorResponse struct {
 	Severity string
@@ -30,107 +49,278 @@ type ErrorResponse struct {
 type PostgresProxy struct {
 	TLSConfig *tls.Config
 	Resolver  core.BackendResolver
+	Dialer    *dialer.Dialer    // optional, defaults to dialer.Default()
+	Queue     *QueueOptions     // optional, holds clients while no backend is available
+	AccessLog *accesslog.Logger // optional, receives one record per closed connection
+
+	// Observers are notified when a backend connection opens and closes
+	Observers []core.ConnectionObserver
+
+	// Console, when set, serves the admin console to matching connections
+	Console *ConsoleOptions
+
+	pause     *pauseState
+	pauseOnce sync.Once
 }
 
-func (p *PostgresProxy) sendErrorResponse(conn net.Conn, errResp *ErrorResponse) error {
+// encodeResponse builds an ErrorResponse ('E') or NoticeResponse ('N') message.
+func encodeResponse(msgType byte, resp *ErrorResponse) []byte {
 	var msgData []byte
 	msgData = append(msgData, 'S')
-	msgData = append(msgData, []byte(errResp.Severity)...)
+	msgData = append(msgData, []byte(resp.Severity)...)
 	msgData = append(msgData, 0)
 	msgData = append(msgData, 'C')
-	msgData = append(msgData, []byte(errResp.Code)...)
+	msgData = append(msgData, []byte(resp.Code)...)
 	msgData = append(msgData, 0)
 	msgData = append(msgData, 'M')
-	msgData = append(msgData, []byte(errResp.Message)...)
+	msgData = append(msgData, []byte(resp.Message)...)
 	msgData = append(msgData, 0)
 	msgData = append(msgData, 0) // Final null terminator
 
 	msg := make([]byte, 1+4+len(msgData))
-	msg[0] = 'E'
+	msg[0] = msgType
 	binary.BigEndian.PutUint32(msg[1:5], uint32(4+len(msgData)))
 	copy(msg[5:], msgData)
+	return msg
+}
 
-	_, writeErr := conn.Write(msg)
+func (p *PostgresProxy) sendErrorResponse(conn net.Conn, errResp *ErrorResponse) error {
+	_, writeErr := conn.Write(encodeResponse('E', errResp))
 	if writeErr != nil {
-		logger.Error("Error sending error response", "remote_addr", conn.RemoteAddr(), "error", writeErr)
+		log.Error("Error sending error response", "remote_addr", conn.RemoteAddr(), "error", writeErr)
 	} else {
-		logger.Info("Sent error response", "remote_addr", conn.RemoteAddr(), "severity", errResp.Severity, "code", errResp.Code, "message", errResp.Message)
+		log.Info("Sent error response", "remote_addr", conn.RemoteAddr(), "severity", errResp.Severity, "code", errResp.Code, "message", errResp.Message)
 	}
 	return writeErr
 }
 
+// adminShutdown is sent to clients whose session is killed through the registry.
+var adminShutdown = &ErrorResponse{
+	Severity: "FATAL",
+	Code:     "57P01", // admin_shutdown
+	Message:  "terminating connection due to administrator command",
+}
+
 // HandleConnection implements core.ConnectionHandler.
 // It takes full ownership of the connection lifecycle.
 func (p *PostgresProxy) HandleConnection(clientConn net.Conn) {
+	p.HandleTrackedConnection(clientConn, core.NewConnection(clientConn))
+}
+
+// HandleTrackedConnection implements core.TrackedConnectionHandler.
+func (p *PostgresProxy) HandleTrackedConnection(clientConn net.Conn, tracked *core.Connection) {
 	defer clientConn.Close()
 
+	remoteAddr := clientConn.RemoteAddr()
+	record := &accesslog.Record{
+		ConnectionID: tracked.ID,
+		ClientAddr:   remoteAddr.String(),
+	}
+	defer func() {
+		if tracked.Killed() {
+			record.Termination = accesslog.ReasonKilled
+		}
+		record.Time = time.Now()
+		record.DurationMs = time.Since(tracked.StartedAt).Milliseconds()
+		record.BytesIn, record.BytesOut = tracked.BytesToBackend.Load(), tracked.BytesToClient.Load()
+		p.AccessLog.Log(record)
+	}()
+
+	// Cancelled when the connection is killed, which ends a queued wait
+	connCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ctx, span := tracing.Tracer().Start(connCtx, "postgresql.connection",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("connection.id", record.ConnectionID),
+			attribute.String("client.address", remoteAddr.String())))
+	defer span.End()
+
 	// 1. Handshake & Protocol Parsing
-	metadata, clientConn, rawStartupMsg, err := p.handshake(clientConn)
+	handshakeStart := time.Now()
+	handshakeCtx, handshakeSpan := tracing.Tracer().Start(ctx, "handshake")
+	metadata, clientConn, rawStartupMsg, err := p.handshake(handshakeCtx, clientConn)
+	endSpan(handshakeSpan, err)
+	if errors.Is(err, errACMEChallenge) {
+		log.Debug("Answered ACME challenge", "remote_addr", remoteAddr)
+		record.Termination = accesslog.ReasonACMEChallenge
+		return
+	}
 	if err != nil {
-		logger.Error("Handshake failed", "error", err, "remote_addr", clientConn.RemoteAddr())
+		log.Error("Handshake failed", "error", err, "remote_addr", remoteAddr)
+		endSpan(span, err)
+		record.Termination, record.Error = accesslog.ReasonHandshakeFailed, err.Error()
 		// Try to send error response if possible, but handshake error might mean we can't speak protocol
 		return
 	}
+	metrics.ObserveHandshake(time.Since(handshakeStart))
+
+	// Set by the proxy, overriding any client-sent startup parameter of the same name
+	metadata["client_addr"] = remoteAddr.String()
+	_, isTLS := clientConn.(*tls.Conn)
+	metadata["tls"] = strconv.FormatBool(isTLS)
+
+	span.SetAttributes(
+		attribute.String("db.deployment_id", metadata["deployment_id"]),
+		attribute.String("db.user", metadata["username"]),
+		attribute.String("db.name", metadata["database"]),
+		attribute.Bool("db.pooled", metadata["pooled"] == "true"),
+		attribute.String("db.role", metadata["role"]),
+	)
+	record.User = metadata["username"]
+	if record.User == "" {
+		record.User = metadata["user"]
+	}
+	record.Database = metadata["database"]
+	record.DeploymentID = metadata["deployment_id"]
+	record.Pooled = metadata["pooled"] == "true"
+	if tlsConn, ok := clientConn.(*tls.Conn); ok {
+		state := tlsConn.ConnectionState()
+		record.SNI = state.ServerName
+		record.TLSVersion = tlsVersionName(state.Version)
+		record.TLSCipher = tls.CipherSuiteName(state.CipherSuite)
+		span.SetAttributes(attribute.String("tls.protocol.version", record.TLSVersion))
+	}
+	tracked.SetSession(core.Session{
+		DatabaseType: core.DatabaseTypePostgresql,
+		DeploymentID: record.DeploymentID,
+		User:         record.User,
+		Database:     record.Database,
+		Pooled:       record.Pooled,
+	})
+
+	// The client now speaks the protocol and understands an ErrorResponse
+	tracked.SetKill(func() {
+		cancel()
+		_ = p.sendErrorResponse(clientConn, adminShutdown)
+		clientConn.Close()
+	})
+
+	if p.Console.matches(metadata) {
+		record.Backend = "console"
+		tracked.SetBackend("console")
+		record.Termination = p.serveConsole(clientConn, metadata)
+		return
+	}
 
-	// 2. Resolve Backend
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	backendAddr, err := p.Resolver.Resolve(ctx, metadata, core.DatabaseTypePostgresql)
-	if err != nil {
-		logger.Error("Resolution failed", "error", err, "remote_addr", clientConn.RemoteAddr())
-		_ = p.sendErrorResponse(clientConn, &ErrorResponse{
-			Severity: "FATAL",
-			Code:     "08001", // sqlclient_unable_to_establish_sqlconnection
-			Message:  fmt.Sprintf("resolution failed: %v", err),
-		})
+	// New connections to a paused deployment wait for RESUME
+	if err := p.waitWhilePaused(ctx, clientConn, metadata["deployment_id"]); err != nil {
+		record.Termination, record.Error = accesslog.ReasonClientClosed, err.Error()
+		if errors.Is(err, errPauseTimeout) {
+			record.Termination = accesslog.ReasonBackendUnavailable
+		}
 		return
 	}
 
-	// 3. Dial Backend
-	backendConn, err := net.Dial("tcp", backendAddr)
+	// 2-3. Resolve & Dial Backend (optionally queued until a backend is available)
+	backendConn, backendAddr, errResp, err := p.connectBackend(ctx, clientConn, metadata)
 	if err != nil {
-		logger.Error("Dial failed", "backend_addr", backendAddr, "error", err, "remote_addr", clientConn.RemoteAddr())
-		_ = p.sendErrorResponse(clientConn, &ErrorResponse{
-			Severity: "FATAL",
-			Code:     "08001",
-			Message:  fmt.Sprintf("failed to connect to backend %s: %v", backendAddr, err),
-		})
+		log.Debug("Client went away while queued", "error", err, "remote_addr", clientConn.RemoteAddr())
+		record.Termination, record.Error = accesslog.ReasonClientClosed, err.Error()
+		return
+	}
+	if errResp != nil {
+		span.SetStatus(codes.Error, errResp.Message)
+		record.Termination, record.Error = accesslog.ReasonBackendUnavailable, errResp.Message
+		if errResp.Code == codeAccessDenied {
+			record.Termination = accesslog.ReasonAccessDenied
+		}
+		_ = p.sendErrorResponse(clientConn, errResp)
 		return
 	}
 	defer backendConn.Close()
+	log.Debug("Connected to backend", "backend_addr", backendAddr, "remote_addr", clientConn.RemoteAddr())
+	span.SetAttributes(attribute.String("server.address", backendAddr))
+	record.Backend = backendAddr
+	tracked.SetBackend(backendAddr)
+	if tracked.Killed() {
+		// Killed while queued, the client connection is already closed
+		return
+	}
+
+	metrics.ConnectionOpened(metadata, core.DatabaseTypePostgresql)
+	defer metrics.ConnectionClosed(metadata, core.DatabaseTypePostgresql)
+
+	for _, observer := range p.Observers {
+		observer.ConnectionOpened(metadata, backendAddr)
+		defer observer.ConnectionClosed(metadata, backendAddr)
+	}
 
 	// 4. Forward Startup Message
-	if _, err := backendConn.Write(rawStartupMsg); err != nil {
-		logger.Error("Failed to forward startup message", "error", err, "remote_addr", clientConn.RemoteAddr())
+	_, startupSpan := tracing.Tracer().Start(ctx, "startup.forward")
+	_, err = backendConn.Write(rawStartupMsg)
+	endSpan(startupSpan, err)
+	if err != nil {
+		log.Error("Failed to forward startup message", "error", err, "remote_addr", clientConn.RemoteAddr())
+		endSpan(span, err)
+		record.Termination, record.Error = accesslog.ReasonStartupFailed, err.Error()
 		return
 	}
 
 	// 5. Pipe Data
+	_, pipeSpan := tracing.Tracer().Start(ctx, "pipe")
+	defer pipeSpan.End()
+
+	toBackend := &countingWriter{w: backendConn, counter: metrics.BytesCounter(metadata, metrics.DirectionClientToBackend), total: &tracked.BytesToBackend}
+	toClient := &countingWriter{w: clientConn, counter: metrics.BytesCounter(metadata, metrics.DirectionBackendToClient), total: &tracked.BytesToClient}
+
+	// Closed once nothing is written to the client from the backend anymore
+	backendDrained := make(chan struct{})
+
+	// Stop the backend stream first so the FATAL message is not interleaved with backend traffic
+	tracked.SetKill(func() {
+		backendConn.Close()
+		select {
+		case <-backendDrained:
+		case <-time.After(2 * time.Second):
+		}
+		_ = p.sendErrorResponse(clientConn, adminShutdown)
+		clientConn.Close()
+	})
+
+	// The side whose stream ends first is the one that terminated the session
+	var terminated sync.Once
 	var wg sync.WaitGroup
 	wg.Add(2)
 
 	go func() {
 		defer wg.Done()
-		io.Copy(backendConn, clientConn)
+		io.Copy(toBackend, clientConn)
+		terminated.Do(func() { record.Termination = accesslog.ReasonClientClosed })
 	}()
 
 	go func() {
 		defer wg.Done()
-		io.Copy(clientConn, backendConn)
+		defer close(backendDrained)
+		io.Copy(toClient, backendConn)
+		terminated.Do(func() { record.Termination = accesslog.ReasonBackendClosed })
 	}()
 
 	wg.Wait()
 }
 
 // handshake performs the initial protocol handshake and returns metadata, the (potentially wrapped) connection, and the raw startup message bytes.
-func (p *PostgresProxy) handshake(conn net.Conn) (core.RoutingMetadata, net.Conn, []byte, error) {
+func (p *PostgresProxy) handshake(ctx context.Context, conn net.Conn) (core.RoutingMetadata, net.Conn, []byte, error) {
 	// Read message length (4 bytes)
 	header := make([]byte, 4)
 	if _, err := io.ReadFull(conn, header); err != nil {
 		return nil, nil, nil, fmt.Errorf("failed to read message length: %w", err)
 	}
 
+	// Direct TLS (sslnegotiation=direct, or an ACME TLS-ALPN-01 validation)
+	// starts with a TLS handshake record instead of a length
+	if _, isTLS := conn.(*tls.Conn); header[0] == tlsHandshakeRecord && p.TLSConfig != nil && !isTLS {
+		tlsConn, err := p.upgradeTLS(ctx, &prefixConn{Conn: conn, prefix: header})
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if tlsConn.ConnectionState().NegotiatedProtocol == acme.ALPNProto {
+			return nil, nil, nil, errACMEChallenge
+		}
+		return p.handshake(ctx, tlsConn)
+	}
+
 	length := int32(binary.BigEndian.Uint32(header))
 	if length < 4 {
 		return nil, nil, nil, fmt.Errorf("invalid message length: %d", length)
@@ -152,9 +342,9 @@ func (p *PostgresProxy) handshake(conn net.Conn) (core.RoutingMetadata, net.Conn
 				if _, err := conn.Write([]byte{'N'}); err != nil {
 					return nil, nil, nil, fmt.Errorf("failed to write SSL rejection response: %w", err)
 				}
-				logger.Info("SSL request rejected - TLS is disabled", "remote_addr", conn.RemoteAddr())
+				log.Info("SSL request rejected - TLS is disabled", "remote_addr", conn.RemoteAddr())
 				// Continue reading the next message (StartupMessage without SSL)
-				return p.handshake(conn)
+				return p.handshake(ctx, conn)
 			}
 
 			// Send 'S' to accept SSL
@@ -162,25 +352,18 @@ func (p *PostgresProxy) handshake(conn net.Conn) (core.RoutingMetadata, net.Conn
 				return nil, nil, nil, fmt.Errorf("failed to write SSL response: %w", err)
 			}
 
-			// Upgrade connection
-			tlsConn := tls.Server(conn, p.TLSConfig)
-			if err := tlsConn.Handshake(); err != nil {
+			tlsConn, err := p.upgradeTLS(ctx, conn)
+			if err != nil {
 				_ = p.sendErrorResponse(conn, &ErrorResponse{
 					Severity: "FATAL",
 					Code:     "08006",
 					Message:  fmt.Sprintf("TLS handshake failed: %v", err),
 				})
-				return nil, nil, nil, fmt.Errorf("tls handshake failed: %w", err)
+				return nil, nil, nil, err
 			}
 
-			state := tlsConn.ConnectionState()
-			logger.Info("TLS Handshake successful",
-				"protocol", tlsVersionName(state.Version),
-				"cipher_suite", tls.CipherSuiteName(state.CipherSuite),
-				"remote_addr", conn.RemoteAddr())
-
 			// Recursively parse the StartupMessage from the encrypted stream
-			return p.handshake(tlsConn)
+			return p.handshake(ctx, tlsConn)
 		}
 	}
 
@@ -213,17 +396,32 @@ func (p *PostgresProxy) handshake(conn net.Conn) (core.RoutingMetadata, net.Conn
 		value = value[:len(value)-1] // Trim null byte
 
 		params[key] = value
-		logger.Info("StartupMessage param", "key", key, "value", value, "remote_addr", conn.RemoteAddr())
 	}
+	log.Debug("StartupMessage received", logger.StartupParams("params", params), "remote_addr", conn.RemoteAddr())
 
-	// Parse username to extract deployment_id and pool status
-	// Format: username.deployment_id[.pool]
+	// Parse username to extract deployment_id, pool status and target role
+	// Format: username.deployment_id[.pool][.ro|.rw]
 	// Examples:
 	//   alice.db-prod.pool     → username=alice, deployment_id=db-prod, pooled=true
 	//   bob.team-1992252154561 → username=bob, deployment_id=team-1992252154561, pooled=false
+	//   carol.db-prod.ro       → username=carol, deployment_id=db-prod, pooled=false, role=replica
+	//
+	// The target role is kept apart from params: "role" is also a real startup
+	// parameter, which the client may send and which is forwarded unchanged.
+	var role string
 	if user, ok := params["user"]; ok {
-		logger.Info("Connection requested", "user", user, "remote_addr", conn.RemoteAddr())
+		log.Debug("Connection requested", "user", user, "remote_addr", conn.RemoteAddr())
 		parts := strings.Split(user, ".")
+		if len(parts) >= 3 {
+			switch parts[len(parts)-1] {
+			case "ro":
+				role = string(core.BackendRoleReplica)
+				parts = parts[:len(parts)-1]
+			case "rw":
+				role = string(core.BackendRolePrimary)
+				parts = parts[:len(parts)-1]
+			}
+		}
 		if len(parts) >= 2 {
 			if parts[len(parts)-1] == "pool" {
 				params["pooled"] = "true"
@@ -241,6 +439,19 @@ func (p *PostgresProxy) handshake(conn net.Conn) (core.RoutingMetadata, net.Conn
 		}
 	}
 
+	// target_session_attrs is a libpq option some drivers also send in the StartupMessage.
+	// An explicit .ro/.rw suffix takes precedence over it.
+	if role == "" {
+		switch params["target_session_attrs"] {
+		case "read-only", "standby":
+			role = string(core.BackendRoleReplica)
+		case "prefer-standby":
+			role = core.RolePreferReplica
+		default:
+			role = string(core.BackendRolePrimary)
+		}
+	}
+
 	// Default database to postgres if not provided OR if it equals the original user
 	// Some PostgreSQL clients (like psql) automatically use username as database when not specified
 	// This causes issues when username is "postgres.team-1992252154561" and gets used as database name
@@ -248,7 +459,7 @@ func (p *PostgresProxy) handshake(conn net.Conn) (core.RoutingMetadata, net.Conn
 	originalUser := params["user"]
 	if dbName, ok := params["database"]; !ok || dbName == "" || dbName == originalUser {
 		params["database"] = "postgres"
-		logger.Info("Database defaulted to postgres", "original_db", dbName, "remote_addr", conn.RemoteAddr())
+		log.Debug("Database defaulted to postgres", "original_db", dbName, "remote_addr", conn.RemoteAddr())
 	}
 
 	// Always rebuild startup message with parsed params
@@ -259,28 +470,96 @@ func (p *PostgresProxy) handshake(conn net.Conn) (core.RoutingMetadata, net.Conn
 
 	// Copy all params except internal metadata (user will be set separately)
 	// Exclude: deployment_id, pooled, username (internal routing metadata)
-	// Include: database, client_encoding, application_name, etc.
+	// Exclude: target_session_attrs (client-side option, rejected by the server)
+	// Include: database, client_encoding, application_name, role, etc.
 	for k, v := range params {
-		if k != "deployment_id" && k != "pooled" && k != "username" && k != "user" {
-			buildParams[k] = v
+		switch k {
+		case "deployment_id", "pooled", "username", "user", "target_session_attrs":
+			continue
 		}
+		buildParams[k] = v
 	}
 
 	// Use parsed username (without deployment_id suffix) or fallback to original
 	// Backend expects: "alice" not "alice.db-prod.pool"
 	if username, ok := params["username"]; ok && username != "" {
 		buildParams["user"] = username
-		logger.Info("Using parsed username", "username", username, "database", buildParams["database"], "remote_addr", conn.RemoteAddr())
+		log.Debug("Using parsed username", "username", username, "database", buildParams["database"], "remote_addr", conn.RemoteAddr())
 	} else if originalUser, ok := params["user"]; ok {
 		buildParams["user"] = originalUser
-		logger.Info("Using original username", "user", originalUser, "database", buildParams["database"], "remote_addr", conn.RemoteAddr())
+		log.Debug("Using original username", "user", originalUser, "database", buildParams["database"], "remote_addr", conn.RemoteAddr())
 	}
 
 	// Rebuild the binary StartupMessage packet with modified parameters
 	rawStartupMsg := rebuildStartupMessage(protocolVersion, buildParams)
+
+	// The routing role replaces the client's own role parameter only in the metadata
+	params["role"] = role
 	return core.RoutingMetadata(params), conn, rawStartupMsg, nil
 }
 
+// upgradeTLS performs the server side of a TLS handshake on conn.
+func (p *PostgresProxy) upgradeTLS(ctx context.Context, conn net.Conn) (*tls.Conn, error) {
+	_, tlsSpan := tracing.Tracer().Start(ctx, "tls.upgrade")
+	tlsConn := tls.Server(conn, p.TLSConfig)
+	if err := tlsConn.Handshake(); err != nil {
+		endSpan(tlsSpan, err)
+		metrics.TLSHandshakeFailed()
+		return nil, fmt.Errorf("tls handshake failed: %w", err)
+	}
+
+	state := tlsConn.ConnectionState()
+	tlsSpan.SetAttributes(
+		attribute.String("tls.protocol.version", tlsVersionName(state.Version)),
+		attribute.String("tls.cipher", tls.CipherSuiteName(state.CipherSuite)),
+		attribute.String("tls.server.name", state.ServerName))
+	tlsSpan.End()
+	log.Debug("TLS Handshake successful",
+		"protocol", tlsVersionName(state.Version),
+		"cipher_suite", tls.CipherSuiteName(state.CipherSuite),
+		"alpn", state.NegotiatedProtocol,
+		"remote_addr", conn.RemoteAddr())
+	return tlsConn, nil
+}
+
+// prefixConn replays bytes already read from Conn before reading further.
+type prefixConn struct {
+	net.Conn
+	prefix []byte
+}
+
+func (c *prefixConn) Read(b []byte) (int, error) {
+	if len(c.prefix) > 0 {
+		n := copy(b, c.prefix)
+		c.prefix = c.prefix[n:]
+		return n, nil
+	}
+	return c.Conn.Read(b)
+}
+
+// endSpan records err on span, if any, and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// countingWriter adds the bytes written through it to a counter and a running total.
+type countingWriter struct {
+	w       io.Writer
+	counter interface{ Add(float64) }
+	total   *atomic.Int64
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	c.counter.Add(float64(n))
+	c.total.Add(int64(n))
+	return n, err
+}
+
 func rebuildStartupMessage(protocolVersion uint32, params map[string]string) []byte {
 	// Calculate total length needed
 	totalLength := 4 + 4 // Length field + protocol version
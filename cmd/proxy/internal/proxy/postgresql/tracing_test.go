@@ -0,0 +1,204 @@
+package postgresql_proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/core"
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/tracing"
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/utils"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// staticResolver resolves every deployment to addr.
+type staticResolver struct{ addr string }
+
+func (r staticResolver) Resolve(context.Context, core.RoutingMetadata, core.DatabaseType) ([]string, error) {
+	return []string{r.addr}, nil
+}
+
+func TestConnectionSpans(t *testing.T) {
+	shutdown, err := tracing.Init(context.Background(), tracing.Options{
+		Exporter:    tracing.ExporterMemory,
+		SampleRatio: 1,
+		ServiceName: "xdatabase-proxy-test",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer shutdown(context.Background())
+
+	// The backend rejects the forwarded StartupMessage and hangs up
+	backend := listen(t)
+	go func() {
+		conn, err := backend.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		readStartupMessage(t, conn)
+		conn.Write(encodeResponse('E', &ErrorResponse{Severity: "FATAL", Code: "28000", Message: "rejected"}))
+	}()
+
+	certPEM, keyPEM, err := utils.GenerateSelfSignedCert(utils.CertOptions{
+		Hosts:        []string{"localhost"},
+		KeyAlgorithm: utils.KeyECDSAP256,
+		Validity:     time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy := &PostgresProxy{
+		TLSConfig: &tls.Config{Certificates: []tls.Certificate{cert}},
+		Resolver:  staticResolver{addr: backend.Addr().String()},
+	}
+
+	front := listen(t)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		conn, err := front.Accept()
+		if err != nil {
+			return
+		}
+		proxy.HandleConnection(conn)
+	}()
+
+	conn, err := net.Dial("tcp", front.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	// SSLRequest, then the StartupMessage over TLS
+	sslRequest := make([]byte, 8)
+	binary.BigEndian.PutUint32(sslRequest[0:4], 8)
+	binary.BigEndian.PutUint32(sslRequest[4:8], sslRequestCode)
+	if _, err := conn.Write(sslRequest); err != nil {
+		t.Fatal(err)
+	}
+	reply := make([]byte, 1)
+	if _, err := io.ReadFull(conn, reply); err != nil || reply[0] != 'S' {
+		t.Fatalf("SSLRequest reply = %q, %v; want S", reply, err)
+	}
+	tlsConn := tls.Client(conn, &tls.Config{InsecureSkipVerify: true})
+	startup := rebuildStartupMessage(196608, map[string]string{"user": "alice.db1", "database": "app"})
+	if _, err := tlsConn.Write(startup); err != nil {
+		t.Fatal(err)
+	}
+	if msgType, _, err := readMessage(tlsConn); err != nil || msgType != 'E' {
+		t.Fatalf("backend reply = %q, %v; want an ErrorResponse", msgType, err)
+	}
+	tlsConn.Close()
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("connection was not closed")
+	}
+
+	spans := map[string]tracetest.SpanStub{}
+	for _, span := range tracing.Spans() {
+		spans[span.Name] = span
+	}
+	root, ok := spans["postgresql.connection"]
+	if !ok {
+		t.Fatalf("no postgresql.connection span in %v", names(spans))
+	}
+	tests := []struct {
+		name   string
+		parent string
+	}{
+		{"handshake", "postgresql.connection"},
+		{"tls.upgrade", "handshake"},
+		{"resolve", "postgresql.connection"},
+		{"dial", "postgresql.connection"},
+		{"startup.forward", "postgresql.connection"},
+		{"pipe", "postgresql.connection"},
+	}
+	for _, tt := range tests {
+		span, ok := spans[tt.name]
+		if !ok {
+			t.Errorf("no %s span in %v", tt.name, names(spans))
+			continue
+		}
+		if span.SpanContext.TraceID() != root.SpanContext.TraceID() {
+			t.Errorf("%s span is not in the connection trace", tt.name)
+		}
+		if parent := spans[tt.parent]; span.Parent.SpanID() != parent.SpanContext.SpanID() {
+			t.Errorf("%s span is not a child of %s", tt.name, tt.parent)
+		}
+	}
+
+	backendAddr := backend.Addr().String()
+	attrs := []struct {
+		span  string
+		key   string
+		value string
+	}{
+		{"postgresql.connection", "db.deployment_id", "db1"},
+		{"postgresql.connection", "db.user", "alice"},
+		{"postgresql.connection", "db.name", "app"},
+		{"postgresql.connection", "server.address", backendAddr},
+		{"postgresql.connection", "tls.protocol.version", "TLSv1.3"},
+		{"tls.upgrade", "tls.protocol.version", "TLSv1.3"},
+		{"dial", "server.address", backendAddr},
+	}
+	for _, tt := range attrs {
+		if got := attr(spans[tt.span], tt.key); got != tt.value {
+			t.Errorf("%s span %s = %q, want %q", tt.span, tt.key, got, tt.value)
+		}
+	}
+}
+
+// attr returns the string value of the span attribute key, or "" if it is not set.
+func attr(span tracetest.SpanStub, key string) string {
+	for _, kv := range span.Attributes {
+		if string(kv.Key) == key {
+			return kv.Value.Emit()
+		}
+	}
+	return ""
+}
+
+func listen(t *testing.T) net.Listener {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	return l
+}
+
+// readStartupMessage reads one untyped, length-prefixed message.
+func readStartupMessage(t *testing.T, conn net.Conn) []byte {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		t.Errorf("failed to read message length: %v", err)
+		return nil
+	}
+	body := make([]byte, binary.BigEndian.Uint32(header)-4)
+	if _, err := io.ReadFull(conn, body); err != nil {
+		t.Errorf("failed to read message body: %v", err)
+	}
+	return body
+}
+
+func names(spans map[string]tracetest.SpanStub) []string {
+	var out []string
+	for name := range spans {
+		out = append(out, name)
+	}
+	return out
+}
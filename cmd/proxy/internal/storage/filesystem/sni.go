@@ -0,0 +1,104 @@
+package filesystem
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// SNIDirectory serves the certificates of a directory by SNI. Each
+// <hostname>.crt file is paired with <hostname>.key; the host name may be a
+// wildcard such as "*.example.com".
+type SNIDirectory struct {
+	Dir string
+}
+
+func NewSNIDirectory(dir string) *SNIDirectory {
+	return &SNIDirectory{Dir: dir}
+}
+
+// Load reads every certificate pair in the directory. Pairs that cannot be
+// loaded are skipped with a warning so one bad file does not hide the others.
+func (d *SNIDirectory) Load() (map[string]*tls.Certificate, error) {
+	entries, err := os.ReadDir(d.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read SNI certificate directory %s: %w", d.Dir, err)
+	}
+	certs := make(map[string]*tls.Certificate)
+	for _, entry := range entries {
+		name := entry.Name()
+		// Secret volumes keep their data in hidden "..<timestamp>" directories
+		if strings.HasPrefix(name, "..") || !strings.HasSuffix(name, ".crt") {
+			continue
+		}
+		host := strings.ToLower(strings.TrimSuffix(name, ".crt"))
+		certFile := filepath.Join(d.Dir, name)
+		keyFile := filepath.Join(d.Dir, strings.TrimSuffix(name, ".crt")+".key")
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			log.Warn("Skipping SNI certificate", "host", host, "error", err)
+			continue
+		}
+		certs[host] = &cert
+	}
+	return certs, nil
+}
+
+// WatchSNICertificates implements core.SNICertificateSource. The directory is
+// reloaded whenever a file in it changes.
+func (d *SNIDirectory) WatchSNICertificates(ctx context.Context, onChange func(map[string]*tls.Certificate)) error {
+	certs, err := d.Load()
+	if err != nil {
+		return err
+	}
+	log.Info("SNI certificates loaded", "dir", d.Dir, "count", len(certs))
+	onChange(certs)
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create SNI certificate watcher: %w", err)
+	}
+	if err := watcher.Add(d.Dir); err != nil {
+		watcher.Close()
+		return fmt.Errorf("failed to watch %s: %w", d.Dir, err)
+	}
+
+	go func() {
+		defer watcher.Close()
+		var pending <-chan time.Time
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if event.Op != fsnotify.Chmod {
+					pending = time.After(reloadDelay)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Warn("SNI certificate watcher error", "error", err)
+			case <-pending:
+				pending = nil
+				certs, err := d.Load()
+				if err != nil {
+					log.Error("Failed to reload SNI certificates, keeping the current ones", "error", err)
+					continue
+				}
+				log.Info("SNI certificates reloaded", "dir", d.Dir, "count", len(certs))
+				onChange(certs)
+			}
+		}
+	}()
+	return nil
+}
@@ -5,8 +5,13 @@ import (
 	"crypto/tls"
 	"fmt"
 	"os"
+	"path/filepath"
 )
 
+// sessionTicketFile is the name of the session ticket keys file, kept next to
+// the key file.
+const sessionTicketFile = "session-tickets.json"
+
 type FileTLSProvider struct {
 	CertFile string
 	KeyFile  string
@@ -36,3 +41,36 @@ func (p *FileTLSProvider) Store(ctx context.Context, certPEM, keyPEM []byte) err
 	}
 	return nil
 }
+
+// LoadSessionTicketKeys implements core.SessionTicketKeyStore.
+func (p *FileTLSProvider) LoadSessionTicketKeys(ctx context.Context) ([]byte, error) {
+	return os.ReadFile(p.sessionTicketPath())
+}
+
+// StoreSessionTicketKeys implements core.SessionTicketKeyStore. The file is
+// replaced by a rename, so replicas sharing the directory never read a
+// partial write.
+func (p *FileTLSProvider) StoreSessionTicketKeys(ctx context.Context, data []byte) error {
+	path := p.sessionTicketPath()
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+sessionTicketFile+"-*")
+	if err != nil {
+		return fmt.Errorf("failed to write session ticket keys: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	// CreateTemp already uses mode 0600
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write session ticket keys: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write session ticket keys: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write session ticket keys: %w", err)
+	}
+	return nil
+}
+
+func (p *FileTLSProvider) sessionTicketPath() string {
+	return filepath.Join(filepath.Dir(p.KeyFile), sessionTicketFile)
+}
@@ -0,0 +1,64 @@
+package filesystem
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/logger"
+)
+
+var log = logger.Component(logger.ComponentTLS)
+
+// reloadDelay coalesces the writes of a rotation (certificate, then key) into one reload.
+const reloadDelay = 200 * time.Millisecond
+
+// WatchCertificate implements core.CertificateWatcher with inotify. The
+// parent directories are watched so that files replaced by rename (cert-manager
+// csi driver, Kubernetes Secret volumes) are picked up as well.
+func (p *FileTLSProvider) WatchCertificate(ctx context.Context, onChange func()) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create certificate watcher: %w", err)
+	}
+	files := map[string]bool{filepath.Clean(p.CertFile): true, filepath.Clean(p.KeyFile): true}
+	dirs := map[string]bool{filepath.Dir(p.CertFile): true, filepath.Dir(p.KeyFile): true}
+	for dir := range dirs {
+		if err := watcher.Add(dir); err != nil {
+			watcher.Close()
+			return fmt.Errorf("failed to watch %s: %w", dir, err)
+		}
+	}
+
+	go func() {
+		defer watcher.Close()
+		var pending <-chan time.Time
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				name := filepath.Clean(event.Name)
+				// Secret volumes swap the "..data" symlink the files point through
+				if event.Op != fsnotify.Chmod && (files[name] || filepath.Base(name) == "..data") {
+					pending = time.After(reloadDelay)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Warn("Certificate watcher error", "error", err)
+			case <-pending:
+				pending = nil
+				log.Info("Certificate files changed, reloading", "cert", p.CertFile, "key", p.KeyFile)
+				onChange()
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,270 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Auth methods
+const (
+	AuthKubernetes = "kubernetes"
+	AuthAppRole    = "approle"
+	AuthToken      = "token"
+)
+
+const (
+	// requestTimeout bounds every Vault API call.
+	requestTimeout = 30 * time.Second
+
+	// loginRetryInterval is the wait after a failed token renewal and login.
+	loginRetryInterval = 30 * time.Second
+)
+
+// errNotFound is returned for Vault paths that do not exist.
+var errNotFound = errors.New("not found")
+
+// statusError is a Vault API error response.
+type statusError struct {
+	status int
+	errors []string
+}
+
+func (e *statusError) Error() string {
+	if len(e.errors) == 0 {
+		return fmt.Sprintf("vault returned %d", e.status)
+	}
+	return fmt.Sprintf("vault returned %d: %s", e.status, strings.Join(e.errors, "; "))
+}
+
+// response is the envelope of Vault API responses.
+type response struct {
+	Data   json.RawMessage `json:"data"`
+	Auth   *authInfo       `json:"auth"`
+	Errors []string        `json:"errors"`
+}
+
+type authInfo struct {
+	ClientToken   string `json:"client_token"`
+	LeaseDuration int    `json:"lease_duration"`
+	Renewable     bool   `json:"renewable"`
+}
+
+// client is a minimal Vault HTTP API client that keeps its token valid.
+type client struct {
+	opts Options
+	http *http.Client
+
+	mu        sync.Mutex
+	token     string
+	ttl       time.Duration // 0 for tokens that do not expire
+	renewable bool
+}
+
+func newClient(opts Options) (*client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if opts.CAFile != "" {
+		pemData, err := os.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read Vault CA file: %w", err)
+		}
+		roots, err := x509.SystemCertPool()
+		if err != nil {
+			roots = x509.NewCertPool()
+		}
+		if !roots.AppendCertsFromPEM(pemData) {
+			return nil, fmt.Errorf("no certificates found in Vault CA file %s", opts.CAFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: roots}
+	}
+	return &client{
+		opts: opts,
+		http: &http.Client{Transport: transport, Timeout: requestTimeout},
+	}, nil
+}
+
+// login obtains a token with the configured auth method. A static token is
+// looked up to learn its TTL.
+func (c *client) login(ctx context.Context) error {
+	var body map[string]string
+	switch c.opts.Auth {
+	case AuthToken:
+		return c.lookupToken(ctx)
+	case AuthKubernetes:
+		jwt, err := os.ReadFile(c.opts.JWTFile)
+		if err != nil {
+			return fmt.Errorf("failed to read service account token: %w", err)
+		}
+		body = map[string]string{"role": c.opts.Role, "jwt": strings.TrimSpace(string(jwt))}
+	case AuthAppRole:
+		body = map[string]string{"role_id": c.opts.RoleID, "secret_id": c.opts.SecretID}
+	default:
+		return fmt.Errorf("unsupported Vault auth method: %s", c.opts.Auth)
+	}
+
+	resp, err := c.request(ctx, http.MethodPost, "auth/"+c.opts.AuthMount+"/login", body, "")
+	if err != nil {
+		return fmt.Errorf("vault %s login failed: %w", c.opts.Auth, err)
+	}
+	if resp.Auth == nil || resp.Auth.ClientToken == "" {
+		return fmt.Errorf("vault %s login returned no token", c.opts.Auth)
+	}
+	c.setToken(resp.Auth.ClientToken, resp.Auth.LeaseDuration, resp.Auth.Renewable)
+	log.Info("Logged in to Vault", "auth", c.opts.Auth, "ttl", c.tokenTTL())
+	return nil
+}
+
+func (c *client) lookupToken(ctx context.Context) error {
+	resp, err := c.request(ctx, http.MethodGet, "auth/token/lookup-self", nil, c.opts.Token)
+	if err != nil {
+		return fmt.Errorf("vault token lookup failed: %w", err)
+	}
+	var data struct {
+		TTL       int  `json:"ttl"`
+		Renewable bool `json:"renewable"`
+	}
+	if err := json.Unmarshal(resp.Data, &data); err != nil {
+		return fmt.Errorf("failed to decode vault token lookup: %w", err)
+	}
+	c.setToken(c.opts.Token, data.TTL, data.Renewable)
+	return nil
+}
+
+// renewToken extends the token's lease. It reports whether the lease got
+// shorter, i.e. the token is approaching its max TTL.
+func (c *client) renewToken(ctx context.Context) (bool, error) {
+	c.mu.Lock()
+	token, ttl, renewable := c.token, c.ttl, c.renewable
+	c.mu.Unlock()
+	if !renewable {
+		return false, fmt.Errorf("token is not renewable")
+	}
+	resp, err := c.request(ctx, http.MethodPost, "auth/token/renew-self", map[string]string{}, token)
+	if err != nil {
+		return false, err
+	}
+	if resp.Auth == nil {
+		return false, fmt.Errorf("token renewal returned no lease")
+	}
+	c.setToken(token, resp.Auth.LeaseDuration, resp.Auth.Renewable)
+	return c.tokenTTL() < ttl, nil
+}
+
+// keepLoggedIn renews the token at two thirds of its TTL, logging in again
+// when it cannot be renewed any further, until ctx is done.
+func (c *client) keepLoggedIn(ctx context.Context) {
+	wait := c.tokenTTL() * 2 / 3
+	for wait > 0 {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+
+		shortened, err := c.renewToken(ctx)
+		if err == nil && (!shortened || c.opts.Auth == AuthToken) {
+			log.Debug("Renewed Vault token", "ttl", c.tokenTTL())
+			wait = c.tokenTTL() * 2 / 3
+			continue
+		}
+		if c.opts.Auth == AuthToken {
+			log.Error("Failed to renew Vault token", "error", err)
+			wait = loginRetryInterval
+			continue
+		}
+		if err := c.login(ctx); err != nil {
+			log.Error("Failed to log in to Vault again", "error", err)
+			wait = loginRetryInterval
+			continue
+		}
+		wait = c.tokenTTL() * 2 / 3
+	}
+}
+
+func (c *client) setToken(token string, ttlSeconds int, renewable bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.token = token
+	c.ttl = time.Duration(ttlSeconds) * time.Second
+	c.renewable = renewable
+}
+
+func (c *client) tokenTTL() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ttl
+}
+
+// do calls the API with the current token. A rejected token is replaced by
+// logging in again once.
+func (c *client) do(ctx context.Context, method, path string, body any) (*response, error) {
+	c.mu.Lock()
+	token := c.token
+	c.mu.Unlock()
+	resp, err := c.request(ctx, method, path, body, token)
+	var statusErr *statusError
+	if errors.As(err, &statusErr) && statusErr.status == http.StatusForbidden && c.opts.Auth != AuthToken {
+		if loginErr := c.login(ctx); loginErr != nil {
+			return nil, fmt.Errorf("%w (login again: %v)", err, loginErr)
+		}
+		c.mu.Lock()
+		token = c.token
+		c.mu.Unlock()
+		return c.request(ctx, method, path, body, token)
+	}
+	return resp, err
+}
+
+func (c *client) request(ctx context.Context, method, path string, body any, token string) (*response, error) {
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(c.opts.Addr, "/")+"/v1/"+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if c.opts.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", c.opts.Namespace)
+	}
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	resp := &response{}
+	if res.StatusCode != http.StatusNoContent {
+		if err := json.NewDecoder(res.Body).Decode(resp); err != nil && err != io.EOF {
+			return nil, fmt.Errorf("failed to decode vault response (%d): %w", res.StatusCode, err)
+		}
+	}
+	switch {
+	case res.StatusCode == http.StatusNotFound && len(resp.Errors) == 0:
+		return nil, errNotFound
+	case res.StatusCode >= 400:
+		return nil, &statusError{status: res.StatusCode, errors: resp.Errors}
+	}
+	return resp, nil
+}
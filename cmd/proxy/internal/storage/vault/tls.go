@@ -0,0 +1,356 @@
+package vault
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/core"
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/logger"
+)
+
+var log = logger.Component(logger.ComponentTLS)
+
+// kvPollInterval is how often the KV secret is checked for a certificate
+// stored by another instance or an operator.
+const kvPollInterval = time.Minute
+
+// KV v2 keys, named like the keys of a kubernetes.io/tls Secret.
+const (
+	kvCertKey = "tls.crt"
+	kvKeyKey  = "tls.key"
+)
+
+// Session ticket keys are kept in a KV v2 secret next to the certificate's,
+// named by appending kvSessionTicketSuffix.
+const (
+	kvSessionTicketSuffix = "-session-tickets"
+	kvSessionTicketKey    = "keys"
+)
+
+// Options configure the Vault connection and where certificates come from.
+type Options struct {
+	Addr      string
+	Namespace string // Vault Enterprise namespace
+	CAFile    string // optional extra roots for Vault's HTTPS certificate
+
+	Auth      string // AuthKubernetes, AuthAppRole or AuthToken
+	AuthMount string // mount path of the auth method
+	Role      string // Kubernetes auth role
+	JWTFile   string // service account token for Kubernetes auth
+	RoleID    string
+	SecretID  string
+	Token     string
+
+	PKIMount string
+	PKIRole  string // when set, certificates are issued from this PKI role
+	KVMount  string
+	KVPath   string // when set, the certificate is read from and stored in this KV v2 secret
+
+	Hosts    []string      // names requested from PKI; the first DNS name is the common name
+	Validity time.Duration // TTL requested from PKI
+}
+
+// Provider implements core.TLSProvider with a Vault KV v2 secret. Without a
+// KV path, stored certificates are kept in memory, so each instance issues
+// its own from PKI.
+type Provider struct {
+	client *client
+	opts   Options
+
+	mu            sync.Mutex
+	cert          *tls.Certificate // last certificate read or stored
+	version       int              // KV version of cert, 0 when the secret does not exist
+	ticketVersion int              // KV version of the session ticket keys last read or stored
+}
+
+// PKIProvider is a Provider that issues its certificates from a Vault PKI role.
+type PKIProvider struct {
+	*Provider
+}
+
+// NewProvider logs in to Vault and returns a Provider, or a PKIProvider when
+// opts.PKIRole is set.
+func NewProvider(ctx context.Context, opts Options) (core.TLSProvider, error) {
+	client, err := newClient(opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := client.login(ctx); err != nil {
+		return nil, err
+	}
+	p := &Provider{client: client, opts: opts}
+	if opts.PKIRole != "" {
+		return &PKIProvider{Provider: p}, nil
+	}
+	return p, nil
+}
+
+func (p *Provider) GetCertificate(ctx context.Context) (*tls.Certificate, error) {
+	if p.opts.KVPath == "" {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if p.cert == nil {
+			return nil, os.ErrNotExist
+		}
+		return p.cert, nil
+	}
+
+	certPEM, keyPEM, version, err := p.readKV(ctx)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	// Remembered even for an unusable secret, so Store can replace it
+	p.version = version
+	if err != nil {
+		return nil, err
+	}
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse x509 key pair from vault %s: %w", p.kvName(), err)
+	}
+	p.cert = &cert
+	return &cert, nil
+}
+
+// Store writes the pair to the KV secret. The write is check-and-set against
+// the version last read, so it fails instead of overwriting a certificate
+// stored concurrently by another instance.
+func (p *Provider) Store(ctx context.Context, certPEM, keyPEM []byte) error {
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.opts.KVPath == "" {
+		p.cert = &cert
+		return nil
+	}
+
+	body := map[string]any{
+		"options": map[string]int{"cas": p.version},
+		"data":    map[string]string{kvCertKey: string(certPEM), kvKeyKey: string(keyPEM)},
+	}
+	resp, err := p.client.do(ctx, http.MethodPost, p.opts.KVMount+"/data/"+p.opts.KVPath, body)
+	if err != nil {
+		return fmt.Errorf("failed to write vault %s: %w", p.kvName(), err)
+	}
+	var data struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(resp.Data, &data); err != nil {
+		return fmt.Errorf("failed to decode vault %s write: %w", p.kvName(), err)
+	}
+	p.cert, p.version = &cert, data.Version
+	return nil
+}
+
+// WatchCertificate implements core.CertificateWatcher. It keeps the Vault
+// token renewed and polls the KV secret for new versions, until ctx is done.
+func (p *Provider) WatchCertificate(ctx context.Context, onChange func()) error {
+	go p.client.keepLoggedIn(ctx)
+	if p.opts.KVPath == "" {
+		return nil
+	}
+
+	go func() {
+		ticker := time.NewTicker(kvPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			_, _, version, err := p.readKV(ctx)
+			if err != nil {
+				log.Warn("Failed to check vault certificate", "path", p.kvName(), "error", err)
+				continue
+			}
+			p.mu.Lock()
+			changed := version != p.version
+			p.mu.Unlock()
+			if changed {
+				log.Info("Vault certificate changed, reloading", "path", p.kvName(), "version", version)
+				onChange()
+			}
+		}
+	}()
+	return nil
+}
+
+func (p *Provider) readKV(ctx context.Context) ([]byte, []byte, int, error) {
+	resp, err := p.client.do(ctx, http.MethodGet, p.opts.KVMount+"/data/"+p.opts.KVPath, nil)
+	if err != nil {
+		if errors.Is(err, errNotFound) {
+			return nil, nil, 0, fmt.Errorf("vault %s: %w", p.kvName(), os.ErrNotExist)
+		}
+		return nil, nil, 0, fmt.Errorf("failed to read vault %s: %w", p.kvName(), err)
+	}
+	var data struct {
+		Data     map[string]string `json:"data"`
+		Metadata struct {
+			Version int `json:"version"`
+		} `json:"metadata"`
+	}
+	if err := json.Unmarshal(resp.Data, &data); err != nil {
+		return nil, nil, 0, fmt.Errorf("failed to decode vault %s: %w", p.kvName(), err)
+	}
+	// A deleted latest version has no data
+	if data.Data == nil {
+		return nil, nil, data.Metadata.Version, fmt.Errorf("vault %s is deleted: %w", p.kvName(), os.ErrNotExist)
+	}
+	certPEM, ok := data.Data[kvCertKey]
+	if !ok {
+		return nil, nil, data.Metadata.Version, fmt.Errorf("vault %s missing %s", p.kvName(), kvCertKey)
+	}
+	keyPEM, ok := data.Data[kvKeyKey]
+	if !ok {
+		return nil, nil, data.Metadata.Version, fmt.Errorf("vault %s missing %s", p.kvName(), kvKeyKey)
+	}
+	return []byte(certPEM), []byte(keyPEM), data.Metadata.Version, nil
+}
+
+// LoadSessionTicketKeys implements core.SessionTicketKeyStore. Without a KV
+// path nothing is shared and it returns errors.ErrUnsupported.
+func (p *Provider) LoadSessionTicketKeys(ctx context.Context) ([]byte, error) {
+	if p.opts.KVPath == "" {
+		return nil, errors.ErrUnsupported
+	}
+	path := p.opts.KVPath + kvSessionTicketSuffix
+	resp, err := p.client.do(ctx, http.MethodGet, p.opts.KVMount+"/data/"+path, nil)
+	if err != nil {
+		if errors.Is(err, errNotFound) {
+			p.setTicketVersion(0)
+			return nil, fmt.Errorf("vault %s/%s: %w", p.opts.KVMount, path, os.ErrNotExist)
+		}
+		return nil, fmt.Errorf("failed to read vault %s/%s: %w", p.opts.KVMount, path, err)
+	}
+	var data struct {
+		Data     map[string]string `json:"data"`
+		Metadata struct {
+			Version int `json:"version"`
+		} `json:"metadata"`
+	}
+	if err := json.Unmarshal(resp.Data, &data); err != nil {
+		return nil, fmt.Errorf("failed to decode vault %s/%s: %w", p.opts.KVMount, path, err)
+	}
+	// Remembered even for a deleted version, so Store can replace it
+	p.setTicketVersion(data.Metadata.Version)
+	keys, ok := data.Data[kvSessionTicketKey]
+	if !ok {
+		return nil, fmt.Errorf("vault %s/%s has no %s: %w", p.opts.KVMount, path, kvSessionTicketKey, os.ErrNotExist)
+	}
+	return []byte(keys), nil
+}
+
+// StoreSessionTicketKeys implements core.SessionTicketKeyStore. Like Store,
+// the write is check-and-set against the version last read, so two replicas
+// rotating at once cannot both win.
+func (p *Provider) StoreSessionTicketKeys(ctx context.Context, data []byte) error {
+	if p.opts.KVPath == "" {
+		return errors.ErrUnsupported
+	}
+	p.mu.Lock()
+	version := p.ticketVersion
+	p.mu.Unlock()
+
+	path := p.opts.KVPath + kvSessionTicketSuffix
+	body := map[string]any{
+		"options": map[string]int{"cas": version},
+		"data":    map[string]string{kvSessionTicketKey: string(data)},
+	}
+	resp, err := p.client.do(ctx, http.MethodPost, p.opts.KVMount+"/data/"+path, body)
+	if err != nil {
+		return fmt.Errorf("failed to write vault %s/%s: %w", p.opts.KVMount, path, err)
+	}
+	var written struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(resp.Data, &written); err != nil {
+		return fmt.Errorf("failed to decode vault %s/%s write: %w", p.opts.KVMount, path, err)
+	}
+	p.setTicketVersion(written.Version)
+	return nil
+}
+
+func (p *Provider) setTicketVersion(version int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.ticketVersion = version
+}
+
+func (p *Provider) kvName() string {
+	return p.opts.KVMount + "/" + p.opts.KVPath
+}
+
+// IssueCertificate implements core.CertificateIssuer with the PKI role. The
+// certificate is followed by its CA chain.
+func (p *PKIProvider) IssueCertificate(ctx context.Context) ([]byte, []byte, error) {
+	var dnsNames, ips []string
+	for _, host := range p.opts.Hosts {
+		if net.ParseIP(host) != nil {
+			ips = append(ips, host)
+		} else {
+			dnsNames = append(dnsNames, host)
+		}
+	}
+	body := map[string]string{
+		"ttl":    fmt.Sprintf("%ds", int(p.opts.Validity.Seconds())),
+		"format": "pem",
+	}
+	if len(dnsNames) > 0 {
+		body["common_name"] = dnsNames[0]
+		body["alt_names"] = strings.Join(dnsNames[1:], ",")
+	}
+	if len(ips) > 0 {
+		body["ip_sans"] = strings.Join(ips, ",")
+	}
+
+	resp, err := p.client.do(ctx, http.MethodPost, p.opts.PKIMount+"/issue/"+p.opts.PKIRole, body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("vault %s/issue/%s: %w", p.opts.PKIMount, p.opts.PKIRole, err)
+	}
+	var data struct {
+		Certificate string   `json:"certificate"`
+		IssuingCA   string   `json:"issuing_ca"`
+		CAChain     []string `json:"ca_chain"`
+		PrivateKey  string   `json:"private_key"`
+		Serial      string   `json:"serial_number"`
+	}
+	if err := json.Unmarshal(resp.Data, &data); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode vault certificate: %w", err)
+	}
+	if data.Certificate == "" || data.PrivateKey == "" {
+		return nil, nil, fmt.Errorf("vault %s/issue/%s returned no certificate", p.opts.PKIMount, p.opts.PKIRole)
+	}
+
+	chain := data.CAChain
+	if len(chain) == 0 && data.IssuingCA != "" {
+		chain = []string{data.IssuingCA}
+	}
+	certPEM := strings.TrimSpace(data.Certificate) + "\n"
+	for _, ca := range chain {
+		certPEM += strings.TrimSpace(ca) + "\n"
+	}
+	log.Info("Issued certificate from Vault PKI", "role", p.opts.PKIRole, "serial", data.Serial)
+	return []byte(certPEM), []byte(strings.TrimSpace(data.PrivateKey) + "\n"), nil
+}
+
+// VerifyIssued rejects self-signed certificates, e.g. one generated before
+// TLS_VAULT_PKI_ROLE was set, so they are replaced by an issued one.
+func (p *PKIProvider) VerifyIssued(leaf *x509.Certificate) error {
+	if leaf.CheckSignature(leaf.SignatureAlgorithm, leaf.RawTBSCertificate, leaf.Signature) == nil {
+		return fmt.Errorf("certificate is self-signed, not issued by vault %s", p.opts.PKIMount)
+	}
+	return nil
+}
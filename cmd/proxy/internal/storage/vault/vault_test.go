@@ -0,0 +1,488 @@
+package vault
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/ca"
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/core"
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/discovery/memory"
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/utils"
+)
+
+// fakeVault is an httptest stand-in for the Vault endpoints the provider uses:
+// AppRole and Kubernetes login, token lookup and renewal, KV v2 and PKI issue.
+type fakeVault struct {
+	t *testing.T
+
+	mu       sync.Mutex
+	lease    int   // lease_duration of logins, lookups and renewals
+	renewals []int // lease_duration of successive renewals, after which lease applies
+	tokens   map[string]bool
+	logins   int
+	renewed  int
+	kv       map[string]kvEntry
+	issued   []map[string]string
+	caStore  core.TLSProvider // CA signing the PKI certificates
+}
+
+type kvEntry struct {
+	version int
+	data    map[string]string
+}
+
+const (
+	testRoleID   = "role-id"
+	testSecretID = "secret-id"
+	testK8sRole  = "proxy"
+	testJWT      = "service-account-jwt"
+	staticToken  = "static-token"
+)
+
+func newFakeVault(t *testing.T, lease int) (*fakeVault, *httptest.Server) {
+	v := &fakeVault{
+		t:       t,
+		lease:   lease,
+		tokens:  map[string]bool{staticToken: true},
+		kv:      make(map[string]kvEntry),
+		caStore: memory.NewMemoryTLSProvider(),
+	}
+	server := httptest.NewServer(v)
+	t.Cleanup(server.Close)
+	return v, server
+}
+
+func (v *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	var body map[string]any
+	if r.Body != nil {
+		json.NewDecoder(r.Body).Decode(&body)
+	}
+	path := strings.TrimPrefix(r.URL.Path, "/v1/")
+	token := r.Header.Get("X-Vault-Token")
+
+	switch {
+	case r.Method == http.MethodPost && strings.HasSuffix(path, "/login"):
+		v.login(w, path, body)
+		return
+	case !v.tokens[token]:
+		reply(w, http.StatusForbidden, map[string]any{"errors": []string{"permission denied"}})
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && path == "auth/token/lookup-self":
+		reply(w, http.StatusOK, map[string]any{"data": map[string]any{"ttl": v.lease, "renewable": true}})
+	case r.Method == http.MethodPost && path == "auth/token/renew-self":
+		lease := v.lease
+		if v.renewed < len(v.renewals) {
+			lease = v.renewals[v.renewed]
+		}
+		v.renewed++
+		reply(w, http.StatusOK, map[string]any{"auth": map[string]any{"client_token": token, "lease_duration": lease, "renewable": true}})
+	case strings.HasPrefix(path, "secret/data/"):
+		v.kvRequest(w, r.Method, strings.TrimPrefix(path, "secret/data/"), body)
+	case r.Method == http.MethodPost && strings.HasPrefix(path, "pki/issue/"):
+		v.issue(w, body)
+	default:
+		reply(w, http.StatusNotFound, map[string]any{"errors": []string{}})
+	}
+}
+
+func (v *fakeVault) login(w http.ResponseWriter, path string, body map[string]any) {
+	var ok bool
+	switch path {
+	case "auth/approle/login":
+		ok = body["role_id"] == testRoleID && body["secret_id"] == testSecretID
+	case "auth/kubernetes/login", "auth/k8s-prod/login":
+		ok = body["role"] == testK8sRole && body["jwt"] == testJWT
+	}
+	if !ok {
+		reply(w, http.StatusBadRequest, map[string]any{"errors": []string{"invalid credentials"}})
+		return
+	}
+	v.logins++
+	token := fmt.Sprintf("token-%d", v.logins)
+	v.tokens[token] = true
+	reply(w, http.StatusOK, map[string]any{"auth": map[string]any{"client_token": token, "lease_duration": v.lease, "renewable": true}})
+}
+
+// kvRequest implements KV v2 reads and check-and-set writes.
+func (v *fakeVault) kvRequest(w http.ResponseWriter, method, path string, body map[string]any) {
+	entry, exists := v.kv[path]
+	if method == http.MethodGet {
+		if !exists {
+			reply(w, http.StatusNotFound, map[string]any{"errors": []string{}})
+			return
+		}
+		reply(w, http.StatusOK, map[string]any{"data": map[string]any{"data": entry.data, "metadata": map[string]any{"version": entry.version}}})
+		return
+	}
+
+	if options, ok := body["options"].(map[string]any); ok {
+		if cas, ok := options["cas"].(float64); ok && int(cas) != entry.version {
+			reply(w, http.StatusBadRequest, map[string]any{"errors": []string{"check-and-set parameter did not match the current version"}})
+			return
+		}
+	}
+	data := make(map[string]string)
+	for key, value := range body["data"].(map[string]any) {
+		data[key] = value.(string)
+	}
+	v.kv[path] = kvEntry{version: entry.version + 1, data: data}
+	reply(w, http.StatusOK, map[string]any{"data": map[string]any{"version": entry.version + 1}})
+}
+
+func (v *fakeVault) issue(w http.ResponseWriter, body map[string]any) {
+	request := make(map[string]string)
+	for key, value := range body {
+		request[key], _ = value.(string)
+	}
+	v.issued = append(v.issued, request)
+
+	var hosts []string
+	for _, key := range []string{"common_name", "alt_names", "ip_sans"} {
+		if request[key] != "" {
+			hosts = append(hosts, strings.Split(request[key], ",")...)
+		}
+	}
+	pki, err := ca.NewProvider(context.Background(), memory.NewMemoryTLSProvider(), v.caStore, true, hosts, utils.KeyECDSAP256, time.Hour)
+	if err != nil {
+		v.t.Errorf("failed to create CA: %v", err)
+	}
+	certPEM, keyPEM, err := pki.IssueCertificate(context.Background())
+	if err != nil {
+		v.t.Errorf("failed to issue certificate: %v", err)
+	}
+	reply(w, http.StatusOK, map[string]any{"data": map[string]any{
+		"certificate":   string(certPEM),
+		"issuing_ca":    string(pki.CACertificate()),
+		"ca_chain":      []string{string(pki.CACertificate())},
+		"private_key":   string(keyPEM),
+		"serial_number": "01:02",
+	}})
+}
+
+func reply(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func (v *fakeVault) counts() (logins, renewed int) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.logins, v.renewed
+}
+
+func (v *fakeVault) kvEntry(path string) kvEntry {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.kv[path]
+}
+
+func (v *fakeVault) issueRequests() []map[string]string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.issued
+}
+
+// jwtFile writes the service account token read by Kubernetes auth.
+func jwtFile(t *testing.T, jwt string) string {
+	path := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(path, []byte(jwt+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLogin(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      Options
+		jwt       string
+		wantToken string
+		wantErr   bool
+	}{
+		{name: "approle", opts: Options{Auth: AuthAppRole, AuthMount: "approle", RoleID: testRoleID, SecretID: testSecretID}, wantToken: "token-1"},
+		{name: "approle wrong secret", opts: Options{Auth: AuthAppRole, AuthMount: "approle", RoleID: testRoleID, SecretID: "wrong"}, wantErr: true},
+		{name: "kubernetes", opts: Options{Auth: AuthKubernetes, AuthMount: "kubernetes", Role: testK8sRole}, jwt: testJWT, wantToken: "token-1"},
+		{name: "kubernetes custom mount", opts: Options{Auth: AuthKubernetes, AuthMount: "k8s-prod", Role: testK8sRole}, jwt: testJWT, wantToken: "token-1"},
+		{name: "kubernetes wrong role", opts: Options{Auth: AuthKubernetes, AuthMount: "kubernetes", Role: "other"}, jwt: testJWT, wantErr: true},
+		{name: "kubernetes wrong jwt", opts: Options{Auth: AuthKubernetes, AuthMount: "kubernetes", Role: testK8sRole}, jwt: "forged", wantErr: true},
+		{name: "token", opts: Options{Auth: AuthToken, Token: staticToken}, wantToken: staticToken},
+		{name: "unknown token", opts: Options{Auth: AuthToken, Token: "unknown"}, wantErr: true},
+		{name: "unsupported method", opts: Options{Auth: "userpass"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, server := newFakeVault(t, 3600)
+			tt.opts.Addr = server.URL
+			if tt.jwt != "" {
+				tt.opts.JWTFile = jwtFile(t, tt.jwt)
+			}
+			c, err := newClient(tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = c.login(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("login() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if c.token != tt.wantToken || c.tokenTTL() != time.Hour || !c.renewable {
+				t.Errorf("token = %q, ttl %s, renewable %v; want %q, 1h, true", c.token, c.tokenTTL(), c.renewable, tt.wantToken)
+			}
+		})
+	}
+}
+
+func TestKeepLoggedIn(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        Options
+		lease       int   // lease_duration in seconds, renewed at two thirds
+		renewals    []int // lease_duration of the first renewals
+		wantLogins  int
+		wantRenewed int
+	}{
+		{name: "renews the lease", opts: Options{Auth: AuthAppRole, RoleID: testRoleID, SecretID: testSecretID}, lease: 1, wantLogins: 1, wantRenewed: 2},
+		{name: "logs in again at max TTL", opts: Options{Auth: AuthAppRole, RoleID: testRoleID, SecretID: testSecretID}, lease: 2, renewals: []int{1}, wantLogins: 2, wantRenewed: 1},
+		{name: "kubernetes logs in again at max TTL", opts: Options{Auth: AuthKubernetes, Role: testK8sRole}, lease: 2, renewals: []int{1}, wantLogins: 2, wantRenewed: 1},
+		{name: "token keeps renewing at max TTL", opts: Options{Auth: AuthToken, Token: staticToken}, lease: 2, renewals: []int{1}, wantLogins: 0, wantRenewed: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			v, server := newFakeVault(t, tt.lease)
+			v.renewals = tt.renewals
+			tt.opts.Addr = server.URL
+			tt.opts.AuthMount = tt.opts.Auth
+			if tt.opts.Auth == AuthKubernetes {
+				tt.opts.JWTFile = jwtFile(t, testJWT)
+			}
+			c, err := newClient(tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := c.login(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go c.keepLoggedIn(ctx)
+
+			deadline := time.Now().Add(10 * time.Second)
+			for {
+				logins, renewed := v.counts()
+				if logins >= tt.wantLogins && renewed >= tt.wantRenewed {
+					if logins != tt.wantLogins {
+						t.Errorf("logins = %d, want %d", logins, tt.wantLogins)
+					}
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatalf("logins = %d, renewals = %d; want %d and %d", logins, renewed, tt.wantLogins, tt.wantRenewed)
+				}
+				time.Sleep(50 * time.Millisecond)
+			}
+		})
+	}
+}
+
+func TestStoreCheckAndSet(t *testing.T) {
+	v, server := newFakeVault(t, 3600)
+	opts := Options{Addr: server.URL, Auth: AuthAppRole, AuthMount: "approle", RoleID: testRoleID, SecretID: testSecretID, KVMount: "secret", KVPath: "proxy/tls"}
+	ctx := context.Background()
+	newProvider := func() *Provider {
+		provider, err := NewProvider(ctx, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return provider.(*Provider)
+	}
+	pair := func(host string) ([]byte, []byte) {
+		certPEM, keyPEM, err := utils.GenerateSelfSignedCert(utils.CertOptions{Hosts: []string{host}, KeyAlgorithm: utils.KeyECDSAP256, Validity: time.Hour})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return certPEM, keyPEM
+	}
+	first, second := newProvider(), newProvider()
+
+	tests := []struct {
+		name     string
+		provider *Provider
+		read     bool // GetCertificate before storing
+		host     string
+		wantErr  bool
+		version  int // KV version afterwards
+	}{
+		{name: "first write of a missing secret", provider: first, read: true, host: "a.example.com", version: 1},
+		{name: "write against a stale read", provider: second, read: false, host: "b.example.com", wantErr: true, version: 1},
+		{name: "write after reading the current version", provider: second, read: true, host: "b.example.com", version: 2},
+		{name: "write of the previous writer", provider: first, read: false, host: "c.example.com", wantErr: true, version: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.read {
+				_, err := tt.provider.GetCertificate(ctx)
+				if err != nil && !errors.Is(err, os.ErrNotExist) {
+					t.Fatal(err)
+				}
+			}
+			certPEM, keyPEM := pair(tt.host)
+			err := tt.provider.Store(ctx, certPEM, keyPEM)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Store() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			entry := v.kvEntry(opts.KVPath)
+			if entry.version != tt.version {
+				t.Errorf("KV version = %d, want %d", entry.version, tt.version)
+			}
+			if !tt.wantErr && entry.data[kvCertKey] != string(certPEM) {
+				t.Error("stored certificate not written to KV")
+			}
+		})
+	}
+
+	// A revoked token is replaced by logging in again
+	v.mu.Lock()
+	clear(v.tokens)
+	v.mu.Unlock()
+	cert, err := second.GetCertificate(ctx)
+	if err != nil {
+		t.Fatalf("GetCertificate() after the token was revoked: %v", err)
+	}
+	if cert.Leaf == nil || cert.Leaf.DNSNames[0] != "b.example.com" {
+		t.Errorf("read certificate for %v, want b.example.com", cert.Leaf.DNSNames)
+	}
+}
+
+func TestSessionTicketKeysCheckAndSet(t *testing.T) {
+	v, server := newFakeVault(t, 3600)
+	opts := Options{Addr: server.URL, Auth: AuthToken, Token: staticToken, KVMount: "secret", KVPath: "proxy/tls"}
+	ctx := context.Background()
+	newProvider := func() *Provider {
+		provider, err := NewProvider(ctx, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return provider.(*Provider)
+	}
+	first, second := newProvider(), newProvider()
+
+	tests := []struct {
+		name     string
+		provider *Provider
+		load     bool // LoadSessionTicketKeys before storing
+		keys     string
+		wantErr  bool
+		version  int // KV version afterwards
+	}{
+		{name: "first rotation", provider: first, load: true, keys: "k1", version: 1},
+		{name: "rotation without reading", provider: second, load: false, keys: "k2", wantErr: true, version: 1},
+		{name: "rotation after reading", provider: second, load: true, keys: "k2", version: 2},
+		{name: "concurrent rotation", provider: first, load: false, keys: "k3", wantErr: true, version: 2},
+		{name: "rotation after adopting", provider: first, load: true, keys: "k3", version: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.load {
+				_, err := tt.provider.LoadSessionTicketKeys(ctx)
+				if err != nil && !errors.Is(err, os.ErrNotExist) {
+					t.Fatal(err)
+				}
+			}
+			err := tt.provider.StoreSessionTicketKeys(ctx, []byte(tt.keys))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("StoreSessionTicketKeys() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			entry := v.kvEntry(opts.KVPath + kvSessionTicketSuffix)
+			if entry.version != tt.version {
+				t.Errorf("KV version = %d, want %d", entry.version, tt.version)
+			}
+			if !tt.wantErr && entry.data[kvSessionTicketKey] != tt.keys {
+				t.Errorf("stored keys = %q, want %q", entry.data[kvSessionTicketKey], tt.keys)
+			}
+		})
+	}
+}
+
+func TestIssueCertificate(t *testing.T) {
+	tests := []struct {
+		name    string
+		hosts   []string
+		request map[string]string
+	}{
+		{
+			name:    "one name",
+			hosts:   []string{"db.example.com"},
+			request: map[string]string{"common_name": "db.example.com", "alt_names": "", "ttl": "86400s", "format": "pem"},
+		},
+		{
+			name:    "names and addresses",
+			hosts:   []string{"10.0.0.1", "db.example.com", "db.internal", "::1"},
+			request: map[string]string{"common_name": "db.example.com", "alt_names": "db.internal", "ip_sans": "10.0.0.1,::1", "ttl": "86400s", "format": "pem"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, server := newFakeVault(t, 3600)
+			provider, err := NewProvider(context.Background(), Options{
+				Addr: server.URL, Auth: AuthToken, Token: staticToken,
+				PKIMount: "pki", PKIRole: "proxy", Hosts: tt.hosts, Validity: 24 * time.Hour,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			issuer, ok := provider.(*PKIProvider)
+			if !ok {
+				t.Fatalf("NewProvider() = %T, want a PKIProvider", provider)
+			}
+			certPEM, keyPEM, err := issuer.IssueCertificate(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			issued := v.issueRequests()
+			if len(issued) != 1 {
+				t.Fatalf("%d issue requests, want 1", len(issued))
+			}
+			for key, want := range tt.request {
+				if got := issued[0][key]; got != want {
+					t.Errorf("request %s = %q, want %q", key, got, want)
+				}
+			}
+			cert, err := tls.X509KeyPair(certPEM, keyPEM)
+			if err != nil {
+				t.Fatalf("issued pair does not load: %v", err)
+			}
+			if len(cert.Certificate) != 2 {
+				t.Errorf("chain has %d certificates, want the leaf and its CA", len(cert.Certificate))
+			}
+			if err := issuer.VerifyIssued(cert.Leaf); err != nil {
+				t.Errorf("VerifyIssued() = %v for a PKI certificate", err)
+			}
+			if got := len(cert.Leaf.DNSNames) + len(cert.Leaf.IPAddresses); got != len(tt.hosts) {
+				t.Errorf("certificate has %d names, want %v", got, tt.hosts)
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package tickets
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/core"
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/logger"
+)
+
+var log = logger.Component(logger.ComponentTLS)
+
+const (
+	// keyCount is the number of keys kept. The newest encrypts new tickets and
+	// all of them decrypt, so a ticket stays valid for keyCount-1 rotations.
+	keyCount = 3
+
+	// checkInterval is how often the stored keys are read, so a key rotated by
+	// another replica is adopted quickly.
+	checkInterval = time.Minute
+)
+
+// key is a session ticket key as stored by the provider.
+type key struct {
+	Key     []byte    `json:"key"`
+	Created time.Time `json:"created"`
+}
+
+type rotator struct {
+	store    core.SessionTicketKeyStore // nil when the provider cannot store keys
+	rotation time.Duration
+	apply    func([][32]byte)
+
+	applied []key
+	failing bool
+}
+
+// Rotate shares the session ticket keys through provider, rotating them every
+// rotation, and passes them newest first to apply until ctx is done. The
+// replica that finds the newest key expired rotates it; the others adopt it
+// on their next check. The first check runs before Rotate returns. Providers
+// that are no core.SessionTicketKeyStore, or cannot share the keys, leave
+// each replica with Go's own per-process keys.
+func Rotate(ctx context.Context, provider core.TLSProvider, rotation time.Duration, apply func([][32]byte)) {
+	store, _ := provider.(core.SessionTicketKeyStore)
+	r := &rotator{store: store, rotation: rotation, apply: apply}
+	if !r.check(ctx) {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(checkInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			r.check(ctx)
+		}
+	}()
+}
+
+// check loads the stored keys, rotates them when due and applies them when
+// they changed. It returns false when the provider cannot share keys.
+func (r *rotator) check(ctx context.Context) bool {
+	keys, err := r.load(ctx)
+	if errors.Is(err, errors.ErrUnsupported) {
+		log.Info("TLS provider does not share session ticket keys, each replica uses its own")
+		return false
+	}
+	if err != nil {
+		r.fail("Failed to load session ticket keys", err)
+		return true
+	}
+
+	if len(keys) == 0 || time.Since(keys[0].Created) >= r.rotation {
+		if keys, err = r.rotate(ctx, keys); err != nil {
+			r.fail("Failed to rotate session ticket keys", err)
+			return true
+		}
+		log.Info("Rotated TLS session ticket keys", "keys", len(keys))
+	}
+	if r.failing {
+		log.Info("Session ticket keys are shared again")
+		r.failing = false
+	}
+
+	if !r.changed(keys) {
+		return true
+	}
+	ticketKeys := make([][32]byte, len(keys))
+	for i, k := range keys {
+		copy(ticketKeys[i][:], k.Key)
+	}
+	r.apply(ticketKeys)
+	r.applied = keys
+	log.Debug("Applied TLS session ticket keys", "keys", len(keys), "created", keys[0].Created)
+	return true
+}
+
+func (r *rotator) load(ctx context.Context) ([]key, error) {
+	if r.store == nil {
+		return nil, errors.ErrUnsupported
+	}
+	data, err := r.store.LoadSessionTicketKeys(ctx)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var keys []key
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("failed to decode session ticket keys: %w", err)
+	}
+	valid := keys[:0]
+	for _, k := range keys {
+		if len(k.Key) == 32 {
+			valid = append(valid, k)
+		}
+	}
+	return valid, nil
+}
+
+// rotate stores a new key in front of keys, dropping the oldest.
+func (r *rotator) rotate(ctx context.Context, keys []key) ([]key, error) {
+	newKey := key{Key: make([]byte, 32), Created: time.Now().UTC()}
+	if _, err := rand.Read(newKey.Key); err != nil {
+		return nil, err
+	}
+	keys = append([]key{newKey}, keys...)
+	if len(keys) > keyCount {
+		keys = keys[:keyCount]
+	}
+	data, err := json.Marshal(keys)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.store.StoreSessionTicketKeys(ctx, data); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (r *rotator) changed(keys []key) bool {
+	if len(keys) != len(r.applied) {
+		return true
+	}
+	for i := range keys {
+		if string(keys[i].Key) != string(r.applied[i].Key) {
+			return true
+		}
+	}
+	return false
+}
+
+// fail logs a failed check once until the keys are shared again; until then
+// the keys applied last, or Go's per-process keys, stay in use.
+func (r *rotator) fail(msg string, err error) {
+	if r.failing {
+		log.Debug(msg, "error", err)
+		return
+	}
+	log.Warn(msg, "error", err)
+	r.failing = true
+}
@@ -0,0 +1,200 @@
+package tickets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/core"
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/discovery/memory"
+)
+
+// keyStore is a TLS provider that stores session ticket keys in memory.
+type keyStore struct {
+	*memory.MemoryTLSProvider
+
+	data     []byte
+	loadErr  error
+	storeErr error
+	stores   int
+}
+
+func newKeyStore(keys ...key) *keyStore {
+	s := &keyStore{MemoryTLSProvider: memory.NewMemoryTLSProvider()}
+	if keys != nil {
+		s.data, _ = json.Marshal(keys)
+	}
+	return s
+}
+
+func (s *keyStore) LoadSessionTicketKeys(context.Context) ([]byte, error) {
+	if s.loadErr != nil {
+		return nil, s.loadErr
+	}
+	if s.data == nil {
+		return nil, os.ErrNotExist
+	}
+	return s.data, nil
+}
+
+func (s *keyStore) StoreSessionTicketKeys(_ context.Context, data []byte) error {
+	if s.storeErr != nil {
+		return s.storeErr
+	}
+	s.data = data
+	s.stores++
+	return nil
+}
+
+func (s *keyStore) keys(t *testing.T) []key {
+	t.Helper()
+	var keys []key
+	if err := json.Unmarshal(s.data, &keys); err != nil {
+		t.Fatalf("stored keys are invalid: %v", err)
+	}
+	return keys
+}
+
+func testKey(b byte, age time.Duration) key {
+	k := key{Key: make([]byte, 32), Created: time.Now().Add(-age).UTC()}
+	k.Key[0] = b
+	return k
+}
+
+func TestCheck(t *testing.T) {
+	const rotation = time.Hour
+	tests := []struct {
+		name       string
+		store      *keyStore
+		wantStores int  // rotations written
+		wantKeys   int  // keys applied, 0 when apply is not called
+		wantFirst  byte // first byte of the newest applied key, 0 for a new random key
+	}{
+		{name: "no keys stored", store: newKeyStore(), wantStores: 1, wantKeys: 1},
+		{name: "fresh keys adopted", store: newKeyStore(testKey(2, time.Minute), testKey(1, 2*time.Hour)), wantKeys: 2, wantFirst: 2},
+		{name: "expired key rotated", store: newKeyStore(testKey(1, 2*time.Hour)), wantStores: 1, wantKeys: 2},
+		{
+			name:       "oldest key dropped",
+			store:      newKeyStore(testKey(3, 2*time.Hour), testKey(2, 3*time.Hour), testKey(1, 4*time.Hour)),
+			wantStores: 1,
+			wantKeys:   keyCount,
+		},
+		{
+			name:      "invalid keys skipped",
+			store:     newKeyStore(testKey(2, time.Minute), key{Key: []byte("short"), Created: time.Now()}),
+			wantKeys:  1,
+			wantFirst: 2,
+		},
+		{name: "load failure", store: &keyStore{loadErr: errors.New("unavailable")}},
+		{name: "store failure", store: &keyStore{storeErr: errors.New("conflict")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var applied [][32]byte
+			r := &rotator{store: tt.store, rotation: rotation, apply: func(keys [][32]byte) { applied = keys }}
+			if !r.check(context.Background()) {
+				t.Fatal("check() = false for a provider that shares keys")
+			}
+			if tt.store.stores != tt.wantStores {
+				t.Errorf("%d rotations stored, want %d", tt.store.stores, tt.wantStores)
+			}
+			if len(applied) != tt.wantKeys {
+				t.Fatalf("%d keys applied, want %d", len(applied), tt.wantKeys)
+			}
+			if tt.wantKeys == 0 {
+				if !r.failing {
+					t.Error("failure not recorded")
+				}
+				return
+			}
+			if tt.wantFirst != 0 && applied[0][0] != tt.wantFirst {
+				t.Errorf("newest applied key is %d, want %d", applied[0][0], tt.wantFirst)
+			}
+			stored := tt.store.keys(t)
+			if tt.wantStores > 0 && applied[0] != [32]byte(stored[0].Key) {
+				t.Error("the rotated key is not the newest applied key")
+			}
+		})
+	}
+}
+
+func TestCheckAdoptsAndRecovers(t *testing.T) {
+	store := newKeyStore()
+	var applied int
+	apply := func([][32]byte) { applied++ }
+	first := &rotator{store: store, rotation: time.Hour, apply: apply}
+	second := &rotator{store: store, rotation: time.Hour, apply: apply}
+	ctx := context.Background()
+
+	// The first replica creates the key, the second adopts it
+	first.check(ctx)
+	second.check(ctx)
+	if store.stores != 1 || applied != 2 {
+		t.Fatalf("%d rotations and %d applications, want 1 and 2", store.stores, applied)
+	}
+	if string(first.applied[0].Key) != string(second.applied[0].Key) {
+		t.Error("replicas use different keys")
+	}
+
+	// Unchanged keys are not applied again
+	second.check(ctx)
+	if applied != 2 {
+		t.Errorf("unchanged keys applied again")
+	}
+
+	// A failed load keeps the applied keys until the store recovers
+	store.loadErr = errors.New("unavailable")
+	second.check(ctx)
+	if !second.failing || len(second.applied) != 1 {
+		t.Fatalf("failing = %v with %d keys after a failed load", second.failing, len(second.applied))
+	}
+	store.loadErr = nil
+	second.check(ctx)
+	if second.failing {
+		t.Error("still failing after the store recovered")
+	}
+
+	// An expired key is rotated by the replica that checks first
+	var keys []key
+	json.Unmarshal(store.data, &keys)
+	keys[0].Created = time.Now().Add(-2 * time.Hour)
+	store.data, _ = json.Marshal(keys)
+	second.check(ctx)
+	first.check(ctx)
+	if store.stores != 2 || len(first.applied) != 2 || string(first.applied[0].Key) != string(second.applied[0].Key) {
+		t.Errorf("%d rotations, first has %d keys; want 2 rotations and shared keys", store.stores, len(first.applied))
+	}
+}
+
+func TestRotateUnsupported(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider core.TLSProvider
+	}{
+		{name: "provider without key storage", provider: memory.NewMemoryTLSProvider()},
+		{name: "storage that cannot share", provider: &keyStore{MemoryTLSProvider: memory.NewMemoryTLSProvider(), loadErr: errors.ErrUnsupported}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			applied := false
+			Rotate(ctx, tt.provider, time.Hour, func([][32]byte) { applied = true })
+			if applied {
+				t.Error("keys applied for a provider that cannot share them")
+			}
+		})
+	}
+
+	// The first check runs before Rotate returns
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var applied [][32]byte
+	Rotate(ctx, newKeyStore(), time.Hour, func(keys [][32]byte) { applied = keys })
+	if len(applied) != 1 {
+		t.Errorf("Rotate() applied %d keys before returning, want 1", len(applied))
+	}
+}
@@ -0,0 +1,146 @@
+package tlspolicy
+
+import (
+	"crypto/tls"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Profiles, modelled on the Mozilla server side TLS recommendations.
+const (
+	// ProfileModern accepts TLS 1.3 only.
+	ProfileModern = "modern"
+	// ProfileIntermediate accepts TLS 1.2 with AEAD ECDHE suites and TLS 1.3.
+	ProfileIntermediate = "intermediate"
+	// ProfileLegacy also accepts TLS 1.0 and 1.1, CBC and RSA key exchange
+	// suites for old clients and drivers. Those clients need an RSA
+	// certificate, so generated keys default to RSA under this profile.
+	ProfileLegacy = "legacy"
+)
+
+var intermediateSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+}
+
+var legacySuites = append(slices.Clone(intermediateSuites),
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
+	tls.TLS_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_RSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_RSA_WITH_AES_128_CBC_SHA,
+	tls.TLS_RSA_WITH_AES_256_CBC_SHA,
+)
+
+var versions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+var curves = map[string]tls.CurveID{
+	"x25519": tls.X25519,
+	"p-256":  tls.CurveP256,
+	"p-384":  tls.CurveP384,
+	"p-521":  tls.CurveP521,
+}
+
+// Policy is the TLS policy of the proxy listener. Zero values keep Go's defaults.
+type Policy struct {
+	MinVersion       uint16
+	MaxVersion       uint16
+	CipherSuites     []uint16 // TLS 1.0-1.2 only; TLS 1.3 suites are not configurable
+	CurvePreferences []tls.CurveID
+}
+
+// New returns the policy of profile with the non-empty overrides applied.
+// Versions are "1.0" to "1.3", cipher suites use their IANA names
+// (TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256) and curves are X25519, P-256,
+// P-384 or P-521.
+func New(profile, minVersion, maxVersion string, cipherSuites, curvePreferences []string) (*Policy, error) {
+	var p Policy
+	switch strings.ToLower(profile) {
+	case ProfileModern:
+		p.MinVersion = tls.VersionTLS13
+	case ProfileIntermediate:
+		p.MinVersion = tls.VersionTLS12
+		p.CipherSuites = intermediateSuites
+	case ProfileLegacy:
+		p.MinVersion = tls.VersionTLS10
+		p.CipherSuites = legacySuites
+	default:
+		return nil, fmt.Errorf("unsupported TLS_PROFILE: %s (supported: modern, intermediate, legacy)", profile)
+	}
+
+	if minVersion != "" {
+		v, ok := versions[minVersion]
+		if !ok {
+			return nil, fmt.Errorf("unsupported TLS_MIN_VERSION: %s (supported: 1.0, 1.1, 1.2, 1.3)", minVersion)
+		}
+		p.MinVersion = v
+	}
+	if maxVersion != "" {
+		v, ok := versions[maxVersion]
+		if !ok {
+			return nil, fmt.Errorf("unsupported TLS_MAX_VERSION: %s (supported: 1.0, 1.1, 1.2, 1.3)", maxVersion)
+		}
+		p.MaxVersion = v
+		if v < p.MinVersion {
+			return nil, fmt.Errorf("TLS_MAX_VERSION %s is below the minimum version %s", maxVersion, tls.VersionName(p.MinVersion))
+		}
+	}
+
+	if len(cipherSuites) > 0 {
+		p.CipherSuites = nil
+		for _, name := range cipherSuites {
+			id, err := cipherSuite(name)
+			if err != nil {
+				return nil, err
+			}
+			p.CipherSuites = append(p.CipherSuites, id)
+		}
+	}
+
+	for _, name := range curvePreferences {
+		id, ok := curves[strings.ToLower(name)]
+		if !ok {
+			return nil, fmt.Errorf("unsupported TLS_CURVE_PREFERENCES entry: %s (supported: X25519, P-256, P-384, P-521)", name)
+		}
+		p.CurvePreferences = append(p.CurvePreferences, id)
+	}
+	return &p, nil
+}
+
+func cipherSuite(name string) (uint16, error) {
+	for _, suite := range tls.CipherSuites() {
+		if !strings.EqualFold(suite.Name, name) {
+			continue
+		}
+		if slices.Equal(suite.SupportedVersions, []uint16{tls.VersionTLS13}) {
+			return 0, fmt.Errorf("TLS_CIPHER_SUITES entry %s is a TLS 1.3 suite, which cannot be configured", name)
+		}
+		return suite.ID, nil
+	}
+	for _, suite := range tls.InsecureCipherSuites() {
+		if strings.EqualFold(suite.Name, name) {
+			return 0, fmt.Errorf("TLS_CIPHER_SUITES entry %s is insecure and not supported", name)
+		}
+	}
+	return 0, fmt.Errorf("unknown TLS_CIPHER_SUITES entry: %s", name)
+}
+
+// Apply sets the policy on config.
+func (p *Policy) Apply(config *tls.Config) {
+	config.MinVersion = p.MinVersion
+	config.MaxVersion = p.MaxVersion
+	config.CipherSuites = p.CipherSuites
+	config.CurvePreferences = p.CurvePreferences
+}
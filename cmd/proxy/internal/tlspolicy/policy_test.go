@@ -0,0 +1,99 @@
+package tlspolicy
+
+import (
+	"crypto/tls"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name     string
+		profile  string
+		min, max string
+		suites   []string
+		curves   []string
+		want     Policy
+		wantErr  string // substring of the error, empty for success
+	}{
+		{name: "modern", profile: "modern", want: Policy{MinVersion: tls.VersionTLS13}},
+		{name: "intermediate", profile: "Intermediate", want: Policy{MinVersion: tls.VersionTLS12, CipherSuites: intermediateSuites}},
+		{name: "legacy", profile: "legacy", want: Policy{MinVersion: tls.VersionTLS10, CipherSuites: legacySuites}},
+		{name: "unknown profile", profile: "paranoid", wantErr: "unsupported TLS_PROFILE"},
+		{
+			name:    "version overrides",
+			profile: "intermediate", min: "1.3", max: "1.3",
+			want: Policy{MinVersion: tls.VersionTLS13, MaxVersion: tls.VersionTLS13, CipherSuites: intermediateSuites},
+		},
+		{
+			name:    "lower minimum",
+			profile: "modern", min: "1.2",
+			want: Policy{MinVersion: tls.VersionTLS12},
+		},
+		{name: "unknown minimum", profile: "modern", min: "1.4", wantErr: "unsupported TLS_MIN_VERSION"},
+		{name: "unknown maximum", profile: "modern", max: "TLS1.2", wantErr: "unsupported TLS_MAX_VERSION"},
+		{name: "maximum below minimum", profile: "modern", max: "1.2", wantErr: "below the minimum version TLS 1.3"},
+		{
+			name:    "cipher suites",
+			profile: "intermediate",
+			suites:  []string{"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384", "tls_ecdhe_ecdsa_with_chacha20_poly1305_sha256"},
+			want: Policy{MinVersion: tls.VersionTLS12, CipherSuites: []uint16{
+				tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384, tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+			}},
+		},
+		{name: "TLS 1.3 suite", profile: "intermediate", suites: []string{"TLS_AES_128_GCM_SHA256"}, wantErr: "TLS 1.3 suite"},
+		{name: "insecure suite", profile: "legacy", suites: []string{"TLS_RSA_WITH_RC4_128_SHA"}, wantErr: "insecure"},
+		{name: "unknown suite", profile: "intermediate", suites: []string{"TLS_FANCY"}, wantErr: "unknown TLS_CIPHER_SUITES"},
+		{
+			name:    "curves",
+			profile: "modern",
+			curves:  []string{"X25519", "p-384"},
+			want:    Policy{MinVersion: tls.VersionTLS13, CurvePreferences: []tls.CurveID{tls.X25519, tls.CurveP384}},
+		},
+		{name: "unknown curve", profile: "modern", curves: []string{"P-224"}, wantErr: "unsupported TLS_CURVE_PREFERENCES"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := New(tt.profile, tt.min, tt.max, tt.suites, tt.curves)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("New() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.MinVersion != tt.want.MinVersion || got.MaxVersion != tt.want.MaxVersion ||
+				!slices.Equal(got.CipherSuites, tt.want.CipherSuites) || !slices.Equal(got.CurvePreferences, tt.want.CurvePreferences) {
+				t.Errorf("New() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIntermediateSuitesAreSecure(t *testing.T) {
+	insecure := make(map[uint16]bool)
+	for _, suite := range tls.InsecureCipherSuites() {
+		insecure[suite.ID] = true
+	}
+	for _, id := range intermediateSuites {
+		if insecure[id] {
+			t.Errorf("intermediate profile includes insecure suite %s", tls.CipherSuiteName(id))
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	policy, err := New("intermediate", "", "1.3", nil, []string{"X25519"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &tls.Config{MinVersion: tls.VersionTLS10}
+	policy.Apply(config)
+	if config.MinVersion != tls.VersionTLS12 || config.MaxVersion != tls.VersionTLS13 ||
+		!slices.Equal(config.CipherSuites, intermediateSuites) || !slices.Equal(config.CurvePreferences, []tls.CurveID{tls.X25519}) {
+		t.Errorf("Apply() set %+v", config)
+	}
+}
@@ -0,0 +1,98 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/hasirciogluhq/xdatabase-proxy"
+
+// Exporter names accepted by Init.
+const (
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+	ExporterMemory = "memory" // keeps every span for Spans, for tests
+)
+
+// memory holds the spans of the memory exporter.
+var memory = tracetest.NewInMemoryExporter()
+
+// Options configures the tracer provider.
+type Options struct {
+	Exporter    string  // otlp, stdout or memory
+	SampleRatio float64 // fraction of connections traced, 1 traces all
+	ServiceName string
+}
+
+// Init installs a global tracer provider and returns its shutdown function.
+// The OTLP exporter is configured through the standard OTEL_EXPORTER_OTLP_* variables.
+// Until Init is called, Tracer returns a no-op tracer.
+func Init(ctx context.Context, opts Options) (func(context.Context) error, error) {
+	exporter, err := newExporter(ctx, opts.Exporter)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		semconv.ServiceName(opts.ServiceName),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build trace resource: %w", err)
+	}
+
+	// The memory exporter receives spans as they end, so Spans sees them at once
+	processor := sdktrace.WithBatcher(exporter)
+	if opts.Exporter == ExporterMemory {
+		processor = sdktrace.WithSyncer(exporter)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		processor,
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(opts.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	return provider.Shutdown, nil
+}
+
+func newExporter(ctx context.Context, name string) (sdktrace.SpanExporter, error) {
+	switch name {
+	case ExporterOTLP, "":
+		exporter, err := otlptracehttp.New(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+		}
+		return exporter, nil
+	case ExporterStdout:
+		return stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case ExporterMemory:
+		memory.Reset()
+		return memory, nil
+	default:
+		return nil, fmt.Errorf("unknown trace exporter: %s", name)
+	}
+}
+
+// Spans returns the spans ended since Init with the memory exporter, in the
+// order they ended.
+func Spans() tracetest.SpanStubs {
+	return memory.GetSpans()
+}
+
+// Tracer returns the proxy's tracer from the global provider.
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
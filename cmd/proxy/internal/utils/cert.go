@@ -1,43 +1,169 @@
 package utils
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
+	"fmt"
 	"math/big"
+	"net"
+	"os"
+	"strings"
 	"time"
 )
 
-// GenerateSelfSignedCert generates a self-signed certificate and private key.
-// It returns the PEM-encoded certificate and private key bytes.
-func GenerateSelfSignedCert() ([]byte, []byte, error) {
-	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+// KeyAlgorithm selects the key type of generated certificates.
+type KeyAlgorithm string
+
+const (
+	KeyECDSAP256 KeyAlgorithm = "ecdsa-p256"
+	KeyECDSAP384 KeyAlgorithm = "ecdsa-p384"
+	KeyEd25519   KeyAlgorithm = "ed25519"
+	KeyRSA2048   KeyAlgorithm = "rsa-2048"
+	KeyRSA4096   KeyAlgorithm = "rsa-4096"
+)
+
+// KeyAlgorithms lists the supported key algorithms.
+var KeyAlgorithms = []KeyAlgorithm{KeyECDSAP256, KeyECDSAP384, KeyEd25519, KeyRSA2048, KeyRSA4096}
+
+// clockSkew backdates generated certificates for clients with a slow clock.
+const clockSkew = 5 * time.Minute
+
+// CertOptions configure GenerateSelfSignedCert.
+type CertOptions struct {
+	Hosts        []string // DNS names and IPs; the first DNS name is also the common name
+	KeyAlgorithm KeyAlgorithm
+	Validity     time.Duration
+}
+
+// GenerateSelfSignedCert generates a self-signed certificate and private key
+// valid for opts.Hosts, which may be DNS names or IP addresses.
+// It returns the PEM-encoded certificate and PKCS#8 private key.
+func GenerateSelfSignedCert(opts CertOptions) ([]byte, []byte, error) {
+	key, err := GenerateKey(opts.KeyAlgorithm)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := RandomSerial()
 	if err != nil {
 		return nil, nil, err
 	}
 
+	now := time.Now()
 	template := x509.Certificate{
-		SerialNumber: big.NewInt(1),
+		SerialNumber: serial,
 		Subject: pkix.Name{
 			Organization: []string{"xdatabase-proxy"},
 		},
-		NotBefore: time.Now(),
-		NotAfter:  time.Now().Add(time.Hour * 24 * 365),
+		NotBefore: now.Add(-clockSkew),
+		NotAfter:  now.Add(opts.Validity),
 
-		KeyUsage:              x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
+		KeyUsage:              x509.KeyUsageDigitalSignature,
 		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
 		BasicConstraintsValid: true,
 	}
+	// RSA key exchange (TLS 1.2 without ECDHE) encrypts with the certificate key
+	if _, ok := key.(*rsa.PrivateKey); ok {
+		template.KeyUsage |= x509.KeyUsageKeyEncipherment
+	}
+	for _, host := range opts.Hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	if len(template.DNSNames) > 0 {
+		template.Subject.CommonName = template.DNSNames[0]
+	}
 
-	derBytes, err := x509.CreateCertificate(rand.Reader, &template, &template, &priv.PublicKey, priv)
+	derBytes, err := x509.CreateCertificate(rand.Reader, &template, &template, key.Public(), key)
 	if err != nil {
 		return nil, nil, err
 	}
+	return EncodePair(derBytes, key)
+}
+
+// GenerateKey creates a private key for algorithm.
+func GenerateKey(algorithm KeyAlgorithm) (crypto.Signer, error) {
+	var key crypto.Signer
+	var err error
+	switch algorithm {
+	case KeyECDSAP256:
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case KeyECDSAP384:
+		key, err = ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case KeyEd25519:
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+	case KeyRSA2048:
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+	case KeyRSA4096:
+		key, err = rsa.GenerateKey(rand.Reader, 4096)
+	default:
+		return nil, fmt.Errorf("unsupported key algorithm: %s", algorithm)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate %s key: %w", algorithm, err)
+	}
+	return key, nil
+}
 
-	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: derBytes})
-	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(priv)})
+// RandomSerial returns a random 128-bit certificate serial number.
+func RandomSerial() (*big.Int, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+	return serial, nil
+}
 
+// EncodePair PEM-encodes a DER certificate and its private key (PKCS#8).
+func EncodePair(der []byte, key crypto.Signer) ([]byte, []byte, error) {
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode private key: %w", err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
 	return certPEM, keyPEM, nil
 }
+
+// DefaultHosts returns the names a generated certificate covers when none are
+// configured: the hostname, the pod IP and, with a service name, the
+// Service's DNS names in namespace. podIP and namespace normally come from
+// the downward API (POD_IP, POD_NAMESPACE).
+func DefaultHosts(podIP, service, namespace string) []string {
+	var hosts []string
+	add := func(host string) {
+		host = strings.ToLower(strings.TrimSpace(host))
+		for _, existing := range hosts {
+			if existing == host {
+				return
+			}
+		}
+		if host != "" {
+			hosts = append(hosts, host)
+		}
+	}
+
+	if hostname, err := os.Hostname(); err == nil {
+		add(hostname)
+	}
+	add("localhost")
+	add(podIP)
+	if service != "" {
+		add(service)
+		if namespace != "" {
+			add(service + "." + namespace)
+			add(service + "." + namespace + ".svc")
+			add(service + "." + namespace + ".svc.cluster.local")
+		}
+	}
+	return hosts
+}
@@ -5,68 +5,95 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"strings"
 
 	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/api"
 	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/config"
 	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/core"
 	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/factory"
 	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/logger"
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/tracing"
 )
 
 func main() {
 	ctx := context.Background()
 
-	// Load configuration from environment
-	cfg, err := config.LoadFromEnv()
+	// Subcommands
+	if len(os.Args) > 1 && (!strings.HasPrefix(os.Args[1], "-") || os.Args[1] == "-h" || os.Args[1] == "--help") {
+		os.Exit(runCommand(os.Args[1:]))
+	}
+
+	// Load configuration from flags, environment and config file
+	cfg, err := config.Load(os.Args[1:])
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Configuration error: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Configuration error:\n%s\n", indent(err))
 		os.Exit(1)
 	}
 
 	// Initialize logger
-	logger.Init()
+	logger.InitWithOptions(logger.Options{Level: logLevel(cfg), Format: cfg.LogFormat, StartupParams: startupParams(cfg)})
+	logger.ToggleDebugOnSignal()
 	logger.Info("Starting xdatabase-proxy...",
 		"database", cfg.DatabaseType,
 		"runtime", cfg.Runtime,
 		"discovery", cfg.DiscoveryMode,
 		"tls_mode", cfg.TLSMode)
 
+	// Initialize tracing (optional)
+	if cfg.TracingEnabled {
+		shutdownTracing, err := tracing.Init(ctx, tracing.Options{
+			Exporter:    cfg.TracingExporter,
+			SampleRatio: cfg.TracingSampleRatio,
+			ServiceName: "xdatabase-proxy",
+		})
+		if err != nil {
+			logger.Fatal("Failed to initialize tracing", "error", err)
+		}
+		defer shutdownTracing(context.Background())
+		logger.Info("Tracing enabled", "exporter", cfg.TracingExporter, "sample_ratio", cfg.TracingSampleRatio)
+	}
+
 	// Start health server
 	healthServer := api.NewHealthServer(":" + cfg.HealthServerPort)
 	healthServer.Start()
 	logger.Info("Health server started", "port", cfg.HealthServerPort)
 
-	// Create backend resolver
-	resolverFactory := factory.NewResolverFactory(cfg)
-	resolver, clientset, err := resolverFactory.Create(ctx)
+	// Create backend health checker (optional)
+	checker := factory.NewHealthCheckFactory(cfg).Create(ctx)
+	if checker != nil {
+		healthServer.SetBackendChecker(checker)
+	}
+
+	// Create connection access log (optional)
+	accessLog, err := factory.NewAccessLogFactory(cfg).Create()
 	if err != nil {
-		logger.Fatal("Failed to create backend resolver", "error", err)
+		logger.Fatal("Failed to create access log", "error", err)
 	}
+	defer accessLog.Close()
 
-	// Create TLS provider (optional)
-	var tlsProvider core.TLSProvider
-	if cfg.TLSEnabled {
-		tlsFactory := factory.NewTLSFactory(cfg)
-		var err error
-		tlsProvider, err = tlsFactory.Create(ctx, clientset)
-		if err != nil {
-			logger.Fatal("Failed to create TLS provider", "error", err)
-		}
+	// Track live connections for the admin API and console
+	registry := core.NewConnectionRegistry()
+	healthServer.SetConnectionRegistry(registry)
 
-		// Ensure certificate exists (load or generate)
-		if err := tlsFactory.EnsureCertificate(ctx, tlsProvider); err != nil {
-			logger.Fatal("Failed to ensure certificate", "error", err)
-		}
-		logger.Info("TLS enabled and configured")
-	} else {
-		logger.Warn("TLS is disabled - connections will not be encrypted")
+	app := &proxyApp{
+		ctx:          ctx,
+		args:         os.Args[1:],
+		startCfg:     cfg,
+		healthServer: healthServer,
+		checker:      checker,
+		accessLog:    accessLog,
+		registry:     registry,
 	}
 
-	// Create protocol-specific proxy handler
-	proxyFactory := factory.NewProxyFactory(cfg)
-	connectionHandler, err := proxyFactory.Create(ctx, tlsProvider, resolver)
+	// Create resolver, TLS provider and protocol-specific proxy handler
+	gen, err := app.build(ctx, cfg, nil)
 	if err != nil {
-		logger.Fatal("Failed to create proxy handler", "error", err)
+		logger.Fatal("Failed to start proxy", "error", err)
+	}
+	if cfg.TLSEnabled {
+		logger.Info("TLS enabled and configured")
+	} else {
+		logger.Warn("TLS is disabled - connections will not be encrypted")
 	}
 
 	// Start TCP listener
@@ -77,17 +104,23 @@ func main() {
 	logger.Info("Proxy listening", "port", cfg.ProxyStartPort, "database", cfg.DatabaseType)
 
 	// Create and start server
-	server := &core.Server{
+	app.server = &core.Server{
 		Listener:          listener,
-		ConnectionHandler: connectionHandler,
+		ConnectionHandler: gen.handler,
+		Registry:          registry,
 	}
+	app.apply(gen)
+
+	// Reload on SIGHUP and POST /reload
+	app.reloadOnSignal()
+	healthServer.SetReloader(app.Reload)
 
 	// Mark as ready
 	healthServer.SetReady(true)
 	logger.Info("Proxy is ready to accept connections")
 
 	// Start serving (blocking)
-	if err := server.Serve(); err != nil {
+	if err := app.server.Serve(); err != nil {
 		logger.Fatal("Server error", "error", err)
 	}
 }
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/accesslog"
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/api"
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/ca"
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/certcache"
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/config"
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/core"
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/factory"
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/health"
+	"github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/logger"
+	postgresql_proxy "github.com/hasirciogluhq/xdatabase-proxy/cmd/proxy/internal/proxy/postgresql"
+
+	k8s "k8s.io/client-go/kubernetes"
+)
+
+// generation is the set of components built from one configuration.
+// A reload builds a new generation and swaps it in for new connections;
+// established connections keep running on the generation that accepted them.
+type generation struct {
+	cfg         *config.Config
+	resolver    core.BackendResolver
+	clientset   *k8s.Clientset
+	stopResolve context.CancelFunc // stops the resolver's background work
+	certs       *certcache.Cache   // nil when TLS is disabled
+	stopTLS     context.CancelFunc // stops watching and renewing the certificate
+	handler     core.ConnectionHandler
+}
+
+// proxyApp holds the components that live for the whole process and the
+// current generation.
+type proxyApp struct {
+	ctx      context.Context
+	args     []string
+	startCfg *config.Config
+
+	healthServer *api.HealthServer
+	checker      *health.Checker
+	accessLog    *accesslog.Logger
+	registry     *core.ConnectionRegistry
+	server       *core.Server
+
+	mu      sync.Mutex
+	current *generation
+}
+
+// build creates a generation for cfg. Components whose settings did not
+// change since prev are reused, so a reload does not restart discovery or
+// regenerate an in-memory certificate.
+func (a *proxyApp) build(ctx context.Context, cfg *config.Config, prev *generation) (*generation, error) {
+	gen := &generation{cfg: cfg}
+
+	// Backend resolver
+	if prev != nil && prev.cfg.SameDiscovery(cfg) {
+		gen.resolver, gen.clientset, gen.stopResolve = prev.resolver, prev.clientset, prev.stopResolve
+	} else {
+		resolverCtx, stop := context.WithCancel(a.ctx)
+		resolver, clientset, err := factory.NewResolverFactory(cfg, a.checker).Create(resolverCtx)
+		if err != nil {
+			stop()
+			return nil, fmt.Errorf("failed to create backend resolver: %w", err)
+		}
+		gen.resolver, gen.clientset, gen.stopResolve = resolver, clientset, stop
+	}
+	fail := func(err error) (*generation, error) {
+		if prev == nil || gen.resolver != prev.resolver {
+			gen.stopResolve()
+		}
+		if gen.certs != nil && (prev == nil || gen.certs != prev.certs) {
+			gen.stopTLS()
+		}
+		return nil, err
+	}
+
+	// TLS provider and certificate (optional)
+	if cfg.TLSEnabled {
+		tlsFactory := factory.NewTLSFactory(cfg)
+		if prev != nil && prev.certs != nil && prev.cfg.SameTLSProvider(cfg) {
+			if err := tlsFactory.EnsureCertificate(ctx, prev.certs.Provider()); err != nil {
+				return fail(fmt.Errorf("failed to ensure certificate: %w", err))
+			}
+			// Pick up a certificate that changed without a watch event
+			gen.certs, gen.stopTLS = prev.certs, prev.stopTLS
+			if err := gen.certs.Refresh(ctx); err != nil {
+				return fail(err)
+			}
+		} else {
+			tlsCtx, stopTLS := context.WithCancel(a.ctx)
+			certs, err := newCertificates(ctx, tlsCtx, tlsFactory, gen.clientset)
+			if err != nil {
+				stopTLS()
+				return fail(err)
+			}
+			gen.certs, gen.stopTLS = certs, stopTLS
+		}
+	}
+
+	// Protocol-specific proxy handler
+	handler, err := factory.NewProxyFactory(cfg, a.checker, a.accessLog, a.registry).Create(ctx, gen.certs, gen.resolver)
+	if err != nil {
+		return fail(fmt.Errorf("failed to create proxy handler: %w", err))
+	}
+	if proxy, ok := handler.(*postgresql_proxy.PostgresProxy); ok {
+		if prev != nil {
+			if prevProxy, ok := prev.handler.(*postgresql_proxy.PostgresProxy); ok {
+				proxy.AdoptState(prevProxy)
+			}
+		}
+		if proxy.Console != nil {
+			proxy.Console.Reload = func(ctx context.Context) error {
+				_, err := a.Reload(ctx)
+				return err
+			}
+		}
+	}
+	gen.handler = handler
+	return gen, nil
+}
+
+// newCertificates creates the TLS provider, ensures its certificate and
+// serves it from a cache that is watched, renewed and extended with SNI
+// certificates and shared session ticket keys until tlsCtx is done. The
+// provider's own background work, e.g. a leader election, also runs with tlsCtx.
+func newCertificates(ctx, tlsCtx context.Context, tlsFactory *factory.TLSFactory, clientset *k8s.Clientset) (*certcache.Cache, error) {
+	provider, err := tlsFactory.Create(tlsCtx, clientset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create TLS provider: %w", err)
+	}
+	// Ensure certificate exists (load or generate)
+	if err := tlsFactory.EnsureCertificate(ctx, provider); err != nil {
+		return nil, fmt.Errorf("failed to ensure certificate: %w", err)
+	}
+
+	certs, err := certcache.New(ctx, provider)
+	if err != nil {
+		return nil, err
+	}
+	if err := certs.Watch(tlsCtx); err != nil {
+		return nil, err
+	}
+	tlsFactory.RenewBeforeExpiry(tlsCtx, certs)
+	if err := tlsFactory.WatchSNI(tlsCtx, certs, clientset); err != nil {
+		return nil, fmt.Errorf("failed to load SNI certificates: %w", err)
+	}
+	tlsFactory.ShareSessionTicketKeys(tlsCtx, certs)
+	return certs, nil
+}
+
+// apply makes gen serve new connections and admin requests.
+func (a *proxyApp) apply(gen *generation) {
+	a.healthServer.SetAdminToken(gen.cfg.AdminToken)
+	var caPEM []byte
+	if gen.certs != nil {
+		if provider, ok := gen.certs.Provider().(*ca.Provider); ok {
+			caPEM = provider.CACertificate()
+		}
+	}
+	a.healthServer.SetCACertificate(caPEM)
+	store, _ := gen.resolver.(core.RouteStore)
+	a.healthServer.SetRouteStore(store)
+	if a.server != nil {
+		a.server.SetConnectionHandler(gen.handler)
+	}
+	a.current = gen
+}
+
+// Reload re-reads the configuration from the same flags, environment and
+// config file as at startup and swaps in the rebuilt components. On error the
+// running configuration is kept. It returns the changed settings that need a
+// restart to take effect.
+func (a *proxyApp) Reload(ctx context.Context) ([]string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	cfg, err := config.Load(a.args)
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	restartRequired := a.startCfg.RestartRequired(cfg)
+	// The proxy protocol cannot change without a new listener
+	cfg.DatabaseType = a.startCfg.DatabaseType
+
+	prev := a.current
+	gen, err := a.build(ctx, cfg, prev)
+	if err != nil {
+		return nil, err
+	}
+	a.apply(gen)
+	applyLogging(prev.cfg, cfg)
+	if gen.resolver != prev.resolver {
+		prev.stopResolve()
+	}
+	if prev.certs != nil && gen.certs != prev.certs {
+		prev.stopTLS()
+	}
+
+	logger.Info("Configuration reloaded",
+		"discovery", cfg.DiscoveryMode,
+		"resolver_rebuilt", gen.resolver != prev.resolver,
+		"tls_enabled", cfg.TLSEnabled,
+		"restart_required", restartRequired)
+	if len(restartRequired) > 0 {
+		logger.Warn("Changed settings take effect after a restart", "settings", strings.Join(restartRequired, ", "))
+	}
+	return restartRequired, nil
+}
+
+// reloadOnSignal reloads the configuration on SIGHUP.
+func (a *proxyApp) reloadOnSignal() {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGHUP)
+
+	go func() {
+		for range sigCh {
+			logger.Info("Configuration reload requested by SIGHUP")
+			if _, err := a.Reload(a.ctx); err != nil {
+				logger.Error("Configuration reload failed, keeping the running configuration", "error", err)
+			}
+		}
+	}()
+}
+
+// logLevel returns the configured global log level name.
+func logLevel(cfg *config.Config) string {
+	switch {
+	case cfg.LogLevel != "":
+		return cfg.LogLevel
+	case cfg.Debug:
+		return "debug"
+	default:
+		return "info"
+	}
+}
+
+func startupParams(cfg *config.Config) []string {
+	if cfg.LogStartupParams == "" {
+		return nil
+	}
+	return strings.Split(cfg.LogStartupParams, ",")
+}
+
+// applyLogging applies the logging settings that changed between prev and cfg,
+// leaving levels changed at runtime alone otherwise.
+func applyLogging(prev, cfg *config.Config) {
+	if logLevel(cfg) != logLevel(prev) {
+		if level, err := logger.ParseLevel(logLevel(cfg)); err == nil {
+			logger.SetLevel(level)
+		}
+	}
+	if cfg.LogStartupParams != prev.LogStartupParams {
+		if params := startupParams(cfg); params != nil {
+			logger.SetStartupParamAllowlist(params)
+		} else {
+			logger.ResetStartupParamAllowlist()
+		}
+	}
+}